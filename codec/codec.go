@@ -0,0 +1,166 @@
+// Package codec decodes receipts from and encodes responses to the wire
+// formats the REST API negotiates: JSON, XML, CSV and MessagePack.
+package codec
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/receipt-processor/models"
+)
+
+var (
+	ErrMalformed            = errors.New("malformed body")
+	ErrUnknownField         = errors.New("unknown field")
+	ErrTrailingData         = errors.New("unexpected data after receipt")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrNotAcceptable        = errors.New("no acceptable media type")
+)
+
+// Field is one named value of a response. Values are strings or ints.
+type Field struct {
+	Name  string
+	Value any
+}
+
+// Record is a flat response, such as {"id": "..."}, {"points": 28} or
+// {"held": true}, with its fields in the order they are written. Values
+// are strings, ints or bools; every codec encodes each natively where its
+// format can.
+type Record []Field
+
+// Codec converts between one wire format and the API's types. Decoders
+// wrap read errors, so callers can still detect a body that hit its size
+// limit.
+type Codec interface {
+	// ContentType is the media type written in responses.
+	ContentType() string
+	// DecodeReceipt reads exactly one receipt. In strict mode fields the
+	// receipt does not define are rejected with ErrUnknownField. An empty
+	// body is reported as io.EOF.
+	DecodeReceipt(r io.Reader, strict bool) (models.Receipt, error)
+	EncodeRecord(w io.Writer, record Record) error
+}
+
+var (
+	JSON    Codec = jsonCodec{}
+	XML     Codec = xmlCodec{}
+	CSV     Codec = csvCodec{}
+	MsgPack Codec = msgpackCodec{}
+)
+
+// mediaTypes maps every accepted media type, including aliases, to its
+// codec. Responses always use the codec's own ContentType.
+var mediaTypes = map[string]Codec{
+	"application/json":        JSON,
+	"application/xml":         XML,
+	"text/xml":                XML,
+	"text/csv":                CSV,
+	"application/msgpack":     MsgPack,
+	"application/x-msgpack":   MsgPack,
+	"application/vnd.msgpack": MsgPack,
+}
+
+// ForContentType picks the decoder for a request's Content-Type. Requests
+// without one are treated as JSON.
+func ForContentType(contentType string) (Codec, error) {
+	if strings.TrimSpace(contentType) == "" {
+		return JSON, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+	if c, ok := mediaTypes[mediaType]; ok {
+		return c, nil
+	}
+	return nil, ErrUnsupportedMediaType
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// ForAccept picks the encoder for a request's Accept header, honouring
+// quality values and wildcards. A missing header, or one that allows
+// anything, selects JSON. Media types given q=0 are never chosen, even
+// through a wildcard.
+func ForAccept(accept string) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, nil
+	}
+
+	var ranges []acceptRange
+	excluded := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		} else {
+			excluded[mediaType] = true
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return specificity(ranges[i].mediaType) > specificity(ranges[j].mediaType)
+	})
+
+	for _, r := range ranges {
+		if !strings.HasSuffix(r.mediaType, "/*") {
+			if c, ok := mediaTypes[r.mediaType]; ok {
+				return c, nil
+			}
+			continue
+		}
+		// Within a wildcard prefer codecs in a fixed order, by the type
+		// they respond with, skipping those the client refused.
+		prefix := strings.TrimSuffix(r.mediaType, "*")
+		if r.mediaType == "*/*" {
+			prefix = ""
+		}
+		for _, c := range []Codec{JSON, XML, CSV, MsgPack} {
+			if strings.HasPrefix(c.ContentType(), prefix) && !excludes(excluded, c) {
+				return c, nil
+			}
+		}
+	}
+	return nil, ErrNotAcceptable
+}
+
+// excludes reports whether the client refused a codec under any of its
+// media types.
+func excludes(excluded map[string]bool, c Codec) bool {
+	for mediaType, candidate := range mediaTypes {
+		if candidate == c && excluded[mediaType] {
+			return true
+		}
+	}
+	return false
+}
+
+func specificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
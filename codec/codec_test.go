@@ -0,0 +1,299 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/receipt-processor/models"
+)
+
+var testReceipt = models.Receipt{
+	Retailer:     "Target",
+	PurchaseDate: "2022-01-01",
+	PurchaseTime: "13:01",
+	Items: []models.Item{
+		{ShortDescription: "Pepsi 12PK", Price: "1.25"},
+		{ShortDescription: "Dasani", Price: "6.49"},
+	},
+	Total: "7.74",
+}
+
+// msgpackReceipt encodes a receipt with an optional extra top-level key.
+func msgpackReceipt(receipt models.Receipt, extra string) []byte {
+	n := 5
+	if extra != "" {
+		n++
+	}
+	buf := appendMapHeader(nil, n)
+	buf = appendString(appendString(buf, "retailer"), receipt.Retailer)
+	buf = appendString(appendString(buf, "purchaseDate"), receipt.PurchaseDate)
+	buf = appendString(appendString(buf, "purchaseTime"), receipt.PurchaseTime)
+	buf = appendString(appendString(buf, "total"), receipt.Total)
+	buf = appendString(buf, "items")
+	buf = append(buf, 0x90|byte(len(receipt.Items)))
+	for _, item := range receipt.Items {
+		buf = appendMapHeader(buf, 2)
+		buf = appendString(appendString(buf, "shortDescription"), item.ShortDescription)
+		buf = appendString(appendString(buf, "price"), item.Price)
+	}
+	if extra != "" {
+		buf = appendInt(appendString(buf, extra), 1)
+	}
+	return buf
+}
+
+func TestDecodeReceipt(t *testing.T) {
+	testCases := []struct {
+		name  string
+		codec Codec
+		body  string
+	}{
+		{"json", JSON, `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",
+			"items":[{"shortDescription":"Pepsi 12PK","price":"1.25"},{"shortDescription":"Dasani","price":"6.49"}],
+			"total":"7.74"}`},
+		{"xml", XML, `<?xml version="1.0"?>
+<receipt>
+  <retailer>Target</retailer>
+  <purchaseDate>2022-01-01</purchaseDate>
+  <purchaseTime>13:01</purchaseTime>
+  <items>
+    <item><shortDescription>Pepsi 12PK</shortDescription><price>1.25</price></item>
+    <item><shortDescription>Dasani</shortDescription><price>6.49</price></item>
+  </items>
+  <total>7.74</total>
+</receipt>
+<!-- printed by POS 4 -->`},
+		{"csv", CSV, "total,retailer,purchaseDate,purchaseTime,shortDescription,price\n" +
+			"7.74,Target,2022-01-01,13:01,Pepsi 12PK,1.25\n" +
+			"7.74,Target,2022-01-01,13:01,Dasani,6.49\n"},
+		{"msgpack", MsgPack, string(msgpackReceipt(testReceipt, ""))},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt, err := tc.codec.DecodeReceipt(strings.NewReader(tc.body), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(receipt, testReceipt) {
+				t.Errorf("expected %+v, got %+v", testReceipt, receipt)
+			}
+		})
+	}
+}
+
+func TestDecodeReceiptComponents(t *testing.T) {
+	expected := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		TimeZone:     "America/Chicago",
+		Currency:     "CAD",
+		Items: []models.Item{
+			{ShortDescription: "Pepsi 12PK", Price: "3.75", Quantity: "3", UnitPrice: "1.25", SKU: "PEP-12", UPC: "012000001291"},
+		},
+		Subtotal:  "3.75",
+		Discounts: []models.Discount{{Description: "Coupon", Amount: "0.50"}},
+		Tax:       "0.25",
+		Total:     "3.50",
+	}
+
+	testCases := []struct {
+		name  string
+		codec Codec
+		body  string
+	}{
+		{"xml", XML, `<receipt>
+  <retailer>Target</retailer><purchaseDate>2022-01-01</purchaseDate><purchaseTime>13:01</purchaseTime>
+  <timeZone>America/Chicago</timeZone><currency>CAD</currency>
+  <items><item>
+    <shortDescription>Pepsi 12PK</shortDescription><price>3.75</price>
+    <quantity>3</quantity><unitPrice>1.25</unitPrice><sku>PEP-12</sku><upc>012000001291</upc>
+  </item></items>
+  <subtotal>3.75</subtotal>
+  <discounts><discount><description>Coupon</description><amount>0.50</amount></discount></discounts>
+  <tax>0.25</tax><total>3.50</total>
+</receipt>`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt, err := tc.codec.DecodeReceipt(strings.NewReader(tc.body), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(receipt, expected) {
+				t.Errorf("expected %+v, got %+v", expected, receipt)
+			}
+		})
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		body := "retailer,purchaseDate,purchaseTime,timeZone,currency,subtotal,tax,total,shortDescription,price,quantity,unitPrice,sku,upc\n" +
+			"Target,2022-01-01,13:01,America/Chicago,CAD,3.75,0.25,4.00,Pepsi 12PK,3.75,3,1.25,PEP-12,012000001291\n"
+		receipt, err := CSV.DecodeReceipt(strings.NewReader(body), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csvExpected := expected
+		csvExpected.Discounts = nil
+		csvExpected.Total = "4.00"
+		if !reflect.DeepEqual(receipt, csvExpected) {
+			t.Errorf("expected %+v, got %+v", csvExpected, receipt)
+		}
+	})
+}
+
+func TestDecodeReceiptErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		codec    Codec
+		body     string
+		strict   bool
+		expected error
+	}{
+		{"json empty", JSON, "", false, io.EOF},
+		{"json trailing data", JSON, `{"retailer":"Target"} {}`, false, ErrTrailingData},
+		{"json unknown field", JSON, `{"store":"Target"}`, true, ErrUnknownField},
+		{"xml empty", XML, "", false, io.EOF},
+		{"xml malformed", XML, "<receipt><retailer>", false, ErrMalformed},
+		{"xml trailing data", XML, "<receipt></receipt><receipt></receipt>", false, ErrTrailingData},
+		{"xml unknown element", XML, "<receipt><store>Target</store></receipt>", true, ErrUnknownField},
+		{"csv empty", CSV, "", false, io.EOF},
+		{"csv missing column", CSV, "retailer,total\nTarget,1.00\n", false, ErrMalformed},
+		{"csv unknown column", CSV, "retailer,purchaseDate,purchaseTime,total,shortDescription,price,barcode\n", true, ErrUnknownField},
+		{"csv inconsistent rows", CSV, "retailer,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+			"Target,2022-01-01,13:01,7.74,Pepsi,1.25\n" +
+			"Walmart,2022-01-01,13:01,7.74,Dasani,6.49\n", false, ErrMalformed},
+		{"msgpack empty", MsgPack, "", false, io.EOF},
+		{"msgpack truncated", MsgPack, string(msgpackReceipt(testReceipt, "")[:10]), false, ErrMalformed},
+		{"msgpack trailing data", MsgPack, string(append(msgpackReceipt(testReceipt, ""), 0xc0)), false, ErrTrailingData},
+		{"msgpack unknown key", MsgPack, string(msgpackReceipt(testReceipt, "store")), true, ErrUnknownField},
+		{"msgpack not a map", MsgPack, "\x01", false, ErrMalformed},
+		{"msgpack nesting", MsgPack, strings.Repeat("\x91", 100) + "\xc0", false, ErrMalformed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.codec.DecodeReceipt(strings.NewReader(tc.body), tc.strict)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	t.Run("msgpack unknown key allowed when lenient", func(t *testing.T) {
+		receipt, err := MsgPack.DecodeReceipt(bytes.NewReader(msgpackReceipt(testReceipt, "store")), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Retailer != "Target" {
+			t.Errorf("expected retailer Target, got %q", receipt.Retailer)
+		}
+	})
+}
+
+func TestEncodeRecord(t *testing.T) {
+	record := Record{{Name: "error", Value: "The receipt is invalid."}, {Name: "points", Value: 28}, {Name: "held", Value: true}}
+	testCases := []struct {
+		codec    Codec
+		expected string
+	}{
+		{JSON, `{"error":"The receipt is invalid.","points":28,"held":true}` + "\n"},
+		{XML, xmlHeader() + "<response><error>The receipt is invalid.</error><points>28</points><held>true</held></response>\n"},
+		{CSV, "error,points,held\nThe receipt is invalid.,28,true\n"},
+		{MsgPack, "\x83\xa5error\xb7The receipt is invalid.\xa6points\x1c\xa4held\xc3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.codec.ContentType(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tc.codec.EncodeRecord(&buf, record); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestEncodeRecordMsgpackBool(t *testing.T) {
+	for _, held := range []bool{true, false} {
+		var buf bytes.Buffer
+		if err := MsgPack.EncodeRecord(&buf, Record{{Name: "held", Value: held}}); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := readMsgpack(bufio.NewReader(&buf), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value := decoded.(map[string]any)["held"]; value != held {
+			t.Errorf("expected held to decode as the bool %v, got %#v", held, value)
+		}
+	}
+}
+
+func xmlHeader() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+}
+
+func TestForContentType(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		expected    Codec
+	}{
+		{"", JSON},
+		{"application/json; charset=utf-8", JSON},
+		{"text/xml", XML},
+		{"application/xml", XML},
+		{"text/csv", CSV},
+		{"application/x-msgpack", MsgPack},
+		{"application/vnd.msgpack", MsgPack},
+	}
+	for _, tc := range testCases {
+		c, err := ForContentType(tc.contentType)
+		if err != nil || c != tc.expected {
+			t.Errorf("%q: expected %s, got %v (%v)", tc.contentType, tc.expected.ContentType(), c, err)
+		}
+	}
+
+	for _, contentType := range []string{"text/plain", "application/yaml", "not a type;;"} {
+		if _, err := ForContentType(contentType); !errors.Is(err, ErrUnsupportedMediaType) {
+			t.Errorf("%q: expected ErrUnsupportedMediaType, got %v", contentType, err)
+		}
+	}
+}
+
+func TestForAccept(t *testing.T) {
+	testCases := []struct {
+		accept   string
+		expected Codec
+	}{
+		{"", JSON},
+		{"*/*", JSON},
+		{"application/xml", XML},
+		{"text/html, application/xml;q=0.9, */*;q=0.1", XML},
+		{"application/json;q=0.5, application/msgpack", MsgPack},
+		{"text/*", CSV},
+		{"application/json;q=0, */*", XML},
+		{"application/json;q=0.8, text/csv;q=0.8", JSON},
+	}
+	for _, tc := range testCases {
+		c, err := ForAccept(tc.accept)
+		if err != nil || c != tc.expected {
+			t.Errorf("%q: expected %s, got %v (%v)", tc.accept, tc.expected.ContentType(), c, err)
+		}
+	}
+
+	for _, accept := range []string{"text/html", "image/*", "application/json;q=0", "text/csv;q=0, text/*"} {
+		if _, err := ForAccept(accept); !errors.Is(err, ErrNotAcceptable) {
+			t.Errorf("%q: expected ErrNotAcceptable, got %v", accept, err)
+		}
+	}
+}
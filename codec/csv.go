@@ -0,0 +1,136 @@
+package codec
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/receipt-processor/models"
+)
+
+type csvCodec struct{}
+
+// csvColumns are the columns of the CSV receipt layout: a header row naming
+// them, in any order, followed by one row per item. The receipt columns
+// repeat on every row and must agree:
+//
+//	retailer,purchaseDate,purchaseTime,total,shortDescription,price
+//	Target,2022-01-01,13:01,7.74,Pepsi 12PK,1.25
+//	Target,2022-01-01,13:01,7.74,Dasani,6.49
+//
+// The optional receipt columns timeZone, subtotal, tax, tip and currency
+// repeat like the required ones; quantity, unitPrice, sku and upc describe each row's
+// item. Discounts cannot be expressed in this layout.
+var csvColumns = []string{"retailer", "purchaseDate", "purchaseTime", "total", "shortDescription", "price"}
+
+var csvOptionalColumns = []string{"timeZone", "subtotal", "tax", "tip", "currency", "quantity", "unitPrice", "sku", "upc"}
+
+var errInconsistentRows = errors.New("receipt columns differ between rows")
+
+func (csvCodec) ContentType() string { return "text/csv" }
+
+func (csvCodec) DecodeReceipt(r io.Reader, strict bool) (models.Receipt, error) {
+	var receipt models.Receipt
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return receipt, err
+		}
+		return receipt, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[name] = i
+	}
+	for _, column := range csvColumns {
+		if _, ok := index[column]; !ok {
+			return receipt, fmt.Errorf("%w: missing column %q", ErrMalformed, column)
+		}
+	}
+	if strict {
+		for _, name := range header {
+			if !knownColumn(name) {
+				return receipt, fmt.Errorf("%w: column %q", ErrUnknownField, name)
+			}
+		}
+	}
+
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return receipt, fmt.Errorf("%w: %w", ErrMalformed, err)
+		}
+
+		column := func(name string) string {
+			if i, ok := index[name]; ok {
+				return record[i]
+			}
+			return ""
+		}
+
+		fields := models.Receipt{
+			Retailer:     column("retailer"),
+			PurchaseDate: column("purchaseDate"),
+			PurchaseTime: column("purchaseTime"),
+			TimeZone:     column("timeZone"),
+			Subtotal:     column("subtotal"),
+			Tax:          column("tax"),
+			Tip:          column("tip"),
+			Currency:     column("currency"),
+			Total:        column("total"),
+		}
+		if row == 0 {
+			receipt = fields
+		} else if fields.Retailer != receipt.Retailer || fields.PurchaseDate != receipt.PurchaseDate ||
+			fields.PurchaseTime != receipt.PurchaseTime || fields.TimeZone != receipt.TimeZone ||
+			fields.Subtotal != receipt.Subtotal || fields.Tax != receipt.Tax || fields.Tip != receipt.Tip ||
+			fields.Currency != receipt.Currency || fields.Total != receipt.Total {
+			return receipt, fmt.Errorf("%w: row %d: %w", ErrMalformed, row+2, errInconsistentRows)
+		}
+
+		receipt.Items = append(receipt.Items, models.Item{
+			ShortDescription: column("shortDescription"),
+			Price:            column("price"),
+			Quantity:         column("quantity"),
+			UnitPrice:        column("unitPrice"),
+			SKU:              column("sku"),
+			UPC:              column("upc"),
+		})
+	}
+	return receipt, nil
+}
+
+func knownColumn(name string) bool {
+	for _, columns := range [][]string{csvColumns, csvOptionalColumns} {
+		for _, column := range columns {
+			if name == column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// EncodeRecord writes a header row of field names and a single row of
+// values.
+func (csvCodec) EncodeRecord(w io.Writer, record Record) error {
+	names := make([]string, len(record))
+	values := make([]string, len(record))
+	for i, field := range record {
+		names[i] = field.Name
+		values[i] = formatValue(field.Value)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(names)
+	writer.Write(values)
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,63 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/receipt-processor/models"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) DecodeReceipt(r io.Reader, strict bool) (models.Receipt, error) {
+	var receipt models.Receipt
+	decoder := json.NewDecoder(r)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(&receipt); err != nil {
+		if errors.Is(err, io.EOF) {
+			return receipt, err
+		}
+		if strings.HasPrefix(err.Error(), "json: unknown field") {
+			return receipt, fmt.Errorf("%w: %w", ErrUnknownField, err)
+		}
+		return receipt, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		if err != nil {
+			return receipt, fmt.Errorf("%w: %w", ErrTrailingData, err)
+		}
+		return receipt, ErrTrailingData
+	}
+	return receipt, nil
+}
+
+func (jsonCodec) EncodeRecord(w io.Writer, record Record) error {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range record {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(field.Name)
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
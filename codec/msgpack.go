@@ -0,0 +1,397 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/receipt-processor/models"
+)
+
+type msgpackCodec struct{}
+
+// maxMsgpackDepth bounds how deeply arrays and maps may nest, so a hostile
+// body cannot exhaust the stack.
+const maxMsgpackDepth = 32
+
+var errMsgpackDepth = errors.New("msgpack: nesting too deep")
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+// DecodeReceipt reads a MessagePack map with the same keys as the JSON
+// layout; items is an array of maps.
+func (msgpackCodec) DecodeReceipt(r io.Reader, strict bool) (models.Receipt, error) {
+	var receipt models.Receipt
+	br := bufio.NewReader(r)
+
+	if _, err := br.Peek(1); err != nil {
+		if errors.Is(err, io.EOF) {
+			return receipt, io.EOF
+		}
+		return receipt, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	value, err := readMsgpack(br, 0)
+	if err != nil {
+		return receipt, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		if err != nil {
+			return receipt, fmt.Errorf("%w: %w", ErrTrailingData, err)
+		}
+		return receipt, ErrTrailingData
+	}
+
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return receipt, fmt.Errorf("%w: receipt must be a map", ErrMalformed)
+	}
+	for key, v := range fields {
+		var err error
+		switch key {
+		case "retailer":
+			receipt.Retailer, err = msgpackString(key, v)
+		case "purchaseDate":
+			receipt.PurchaseDate, err = msgpackString(key, v)
+		case "purchaseTime":
+			receipt.PurchaseTime, err = msgpackString(key, v)
+		case "timeZone":
+			receipt.TimeZone, err = msgpackString(key, v)
+		case "total":
+			receipt.Total, err = msgpackString(key, v)
+		case "subtotal":
+			receipt.Subtotal, err = msgpackString(key, v)
+		case "tax":
+			receipt.Tax, err = msgpackString(key, v)
+		case "tip":
+			receipt.Tip, err = msgpackString(key, v)
+		case "currency":
+			receipt.Currency, err = msgpackString(key, v)
+		case "items":
+			receipt.Items, err = msgpackItems(v, strict)
+		case "discounts":
+			receipt.Discounts, err = msgpackDiscounts(v, strict)
+		default:
+			if strict {
+				err = fmt.Errorf("%w: %q", ErrUnknownField, key)
+			}
+		}
+		if err != nil {
+			return models.Receipt{}, err
+		}
+	}
+	return receipt, nil
+}
+
+func msgpackItems(value any, strict bool) ([]models.Item, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: items must be an array", ErrMalformed)
+	}
+
+	items := make([]models.Item, 0, len(list))
+	for _, entry := range list {
+		fields, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: item must be a map", ErrMalformed)
+		}
+		var item models.Item
+		for key, v := range fields {
+			var err error
+			switch key {
+			case "shortDescription":
+				item.ShortDescription, err = msgpackString(key, v)
+			case "price":
+				item.Price, err = msgpackString(key, v)
+			case "quantity":
+				item.Quantity, err = msgpackString(key, v)
+			case "unitPrice":
+				item.UnitPrice, err = msgpackString(key, v)
+			case "sku":
+				item.SKU, err = msgpackString(key, v)
+			case "upc":
+				item.UPC, err = msgpackString(key, v)
+			default:
+				if strict {
+					err = fmt.Errorf("%w: %q", ErrUnknownField, key)
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func msgpackDiscounts(value any, strict bool) ([]models.Discount, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: discounts must be an array", ErrMalformed)
+	}
+
+	discounts := make([]models.Discount, 0, len(list))
+	for _, entry := range list {
+		fields, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: discount must be a map", ErrMalformed)
+		}
+		var discount models.Discount
+		for key, v := range fields {
+			var err error
+			switch key {
+			case "description":
+				discount.Description, err = msgpackString(key, v)
+			case "amount":
+				discount.Amount, err = msgpackString(key, v)
+			default:
+				if strict {
+					err = fmt.Errorf("%w: %q", ErrUnknownField, key)
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		discounts = append(discounts, discount)
+	}
+	return discounts, nil
+}
+
+// msgpackString accepts a string or nil, matching how JSON null leaves a
+// string field empty.
+func msgpackString(key string, value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("%w: %s must be a string", ErrMalformed, key)
+	}
+}
+
+// readMsgpack decodes one value into nil, bool, int64, uint64, float64,
+// string, []byte, []any or map[string]any. Map keys must be strings.
+func readMsgpack(r *bufio.Reader, depth int) (any, error) {
+	if depth > maxMsgpackDepth {
+		return nil, errMsgpackDepth
+	}
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return readMsgpackMap(r, int(b&0x0f), depth)
+	case b&0xf0 == 0x90:
+		return readMsgpackArray(r, int(b&0x0f), depth)
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, int(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readLength(r, b-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, n)
+	case 0xca:
+		bits, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		bits, err := readUint(r, 8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return readUint(r, 1<<(b-0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		u, err := readUint(r, size)
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readLength(r, b-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(r, n)
+	case 0xdc, 0xdd:
+		n, err := readLength(r, b-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n, depth)
+	case 0xde, 0xdf:
+		n, err := readLength(r, b-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n, depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", b)
+}
+
+// readLength reads a big-endian length of 1, 2 or 4 bytes for width 0, 1
+// or 2.
+func readLength(r *bufio.Reader, width byte) (int, error) {
+	n, err := readUint(r, 1<<width)
+	return int(n), err
+}
+
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// readBytes reads n bytes without trusting n for the allocation, since the
+// length prefix comes from the client.
+func readBytes(r *bufio.Reader, n int) ([]byte, error) {
+	buf := make([]byte, 0, min(n, 4096))
+	for len(buf) < n {
+		chunk := min(n-len(buf), 4096)
+		start := len(buf)
+		buf = append(buf, make([]byte, chunk)...)
+		if _, err := io.ReadFull(r, buf[start:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	return buf, nil
+}
+
+func readMsgpackString(r *bufio.Reader, n int) (string, error) {
+	b, err := readBytes(r, n)
+	return string(b), err
+}
+
+func readMsgpackArray(r *bufio.Reader, n, depth int) ([]any, error) {
+	list := make([]any, 0, min(n, 64))
+	for i := 0; i < n; i++ {
+		v, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func readMsgpackMap(r *bufio.Reader, n, depth int) (map[string]any, error) {
+	m := make(map[string]any, min(n, 64))
+	for i := 0; i < n; i++ {
+		k, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, errors.New("msgpack: map keys must be strings")
+		}
+		v, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// unexpectedEOF reports a body that ends mid-value, keeping other read
+// errors such as a size limit intact.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// EncodeRecord writes a record as a map of its fields.
+func (msgpackCodec) EncodeRecord(w io.Writer, record Record) error {
+	buf := appendMapHeader(nil, len(record))
+	for _, field := range record {
+		buf = appendString(buf, field.Name)
+		switch v := field.Value.(type) {
+		case string:
+			buf = appendString(buf, v)
+		case int:
+			buf = appendInt(buf, int64(v))
+		case bool:
+			buf = appendBool(buf, v)
+		default:
+			buf = appendString(buf, fmt.Sprint(v))
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, 0xdf), uint32(n))
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+	return append(buf, s...)
+}
+
+func appendBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 0xc3)
+	}
+	return append(buf, 0xc2)
+}
+
+func appendInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		return append(buf, byte(n))
+	case n < 0 && n >= -32:
+		return append(buf, byte(int8(n)))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(int32(n)))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(n))
+	}
+}
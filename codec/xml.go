@@ -0,0 +1,186 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/receipt-processor/models"
+)
+
+type xmlCodec struct{}
+
+// xmlReceipt is the XML layout of a receipt:
+//
+//	<receipt>
+//	  <retailer>Target</retailer>
+//	  <purchaseDate>2022-01-01</purchaseDate>
+//	  <purchaseTime>13:01</purchaseTime>
+//	  <items>
+//	    <item><shortDescription>Pepsi 12PK</shortDescription><price>1.25</price></item>
+//	  </items>
+//	  <total>1.25</total>
+//	</receipt>
+//
+// The optional fields use the JSON names too, with discounts nested as
+// <discounts><discount>. Elements it does not define are collected so
+// strict mode can reject them.
+type xmlReceipt struct {
+	Retailer     string        `xml:"retailer"`
+	PurchaseDate string        `xml:"purchaseDate"`
+	PurchaseTime string        `xml:"purchaseTime"`
+	TimeZone     string        `xml:"timeZone"`
+	Items        []xmlItem     `xml:"items>item"`
+	Subtotal     string        `xml:"subtotal"`
+	Discounts    []xmlDiscount `xml:"discounts>discount"`
+	Tax          string        `xml:"tax"`
+	Tip          string        `xml:"tip"`
+	Currency     string        `xml:"currency"`
+	Total        string        `xml:"total"`
+	Unknown      []xmlAnyTag   `xml:",any"`
+}
+
+type xmlItem struct {
+	ShortDescription string      `xml:"shortDescription"`
+	Price            string      `xml:"price"`
+	Quantity         string      `xml:"quantity"`
+	UnitPrice        string      `xml:"unitPrice"`
+	SKU              string      `xml:"sku"`
+	UPC              string      `xml:"upc"`
+	Unknown          []xmlAnyTag `xml:",any"`
+}
+
+type xmlDiscount struct {
+	Description string      `xml:"description"`
+	Amount      string      `xml:"amount"`
+	Unknown     []xmlAnyTag `xml:",any"`
+}
+
+type xmlAnyTag struct {
+	XMLName xml.Name
+}
+
+func (xmlCodec) ContentType() string { return "application/xml" }
+
+func (xmlCodec) DecodeReceipt(r io.Reader, strict bool) (models.Receipt, error) {
+	var decoded xmlReceipt
+	decoder := xml.NewDecoder(r)
+	if err := decoder.Decode(&decoded); err != nil {
+		if errors.Is(err, io.EOF) {
+			return models.Receipt{}, err
+		}
+		return models.Receipt{}, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+
+	if strict {
+		if len(decoded.Unknown) > 0 {
+			return models.Receipt{}, fmt.Errorf("%w: <%s>", ErrUnknownField, decoded.Unknown[0].XMLName.Local)
+		}
+		for _, item := range decoded.Items {
+			if len(item.Unknown) > 0 {
+				return models.Receipt{}, fmt.Errorf("%w: <%s>", ErrUnknownField, item.Unknown[0].XMLName.Local)
+			}
+		}
+		for _, discount := range decoded.Discounts {
+			if len(discount.Unknown) > 0 {
+				return models.Receipt{}, fmt.Errorf("%w: <%s>", ErrUnknownField, discount.Unknown[0].XMLName.Local)
+			}
+		}
+	}
+
+	if err := expectEnd(decoder); err != nil {
+		return models.Receipt{}, err
+	}
+
+	receipt := models.Receipt{
+		Retailer:     decoded.Retailer,
+		PurchaseDate: decoded.PurchaseDate,
+		PurchaseTime: decoded.PurchaseTime,
+		TimeZone:     decoded.TimeZone,
+		Subtotal:     decoded.Subtotal,
+		Tax:          decoded.Tax,
+		Tip:          decoded.Tip,
+		Currency:     decoded.Currency,
+		Total:        decoded.Total,
+	}
+	for _, item := range decoded.Items {
+		receipt.Items = append(receipt.Items, models.Item{
+			ShortDescription: item.ShortDescription,
+			Price:            item.Price,
+			Quantity:         item.Quantity,
+			UnitPrice:        item.UnitPrice,
+			SKU:              item.SKU,
+			UPC:              item.UPC,
+		})
+	}
+	for _, discount := range decoded.Discounts {
+		receipt.Discounts = append(receipt.Discounts, models.Discount{Description: discount.Description, Amount: discount.Amount})
+	}
+	return receipt, nil
+}
+
+// expectEnd allows only whitespace, comments and processing instructions
+// after the root element.
+func expectEnd(decoder *xml.Decoder) error {
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrTrailingData, err)
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return ErrTrailingData
+			}
+		case xml.Comment, xml.ProcInst:
+		default:
+			return ErrTrailingData
+		}
+	}
+}
+
+// EncodeRecord writes a record as a <response> element with one child per
+// field, e.g. <response><id>...</id></response>.
+func (xmlCodec) EncodeRecord(w io.Writer, record Record) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	root := xml.StartElement{Name: xml.Name{Local: "response"}}
+	if err := encoder.EncodeToken(root); err != nil {
+		return err
+	}
+	for _, field := range record {
+		start := xml.StartElement{Name: xml.Name{Local: field.Name}}
+		if err := encoder.EncodeElement(formatValue(field.Value), start); err != nil {
+			return err
+		}
+	}
+	if err := encoder.EncodeToken(root.End()); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
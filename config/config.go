@@ -0,0 +1,510 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/receipt-processor/currency"
+	"github.com/receipt-processor/fraud"
+	"github.com/receipt-processor/graphqlapi"
+	"github.com/receipt-processor/handlers"
+	"github.com/receipt-processor/ratelimit"
+	"github.com/receipt-processor/rescore"
+	"github.com/receipt-processor/server"
+)
+
+const EnvPrefix = "RECEIPT_"
+
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+type TLSConfig struct {
+	CertFile       string   `json:"certFile"`
+	KeyFile        string   `json:"keyFile"`
+	ClientCAFile   string   `json:"clientCAFile"`
+	ClientAuth     string   `json:"clientAuth"`
+	ReloadInterval Duration `json:"reloadInterval"`
+}
+
+func (t TLSConfig) Options() server.TLSOptions {
+	return server.TLSOptions{
+		CertFile:     t.CertFile,
+		KeyFile:      t.KeyFile,
+		ClientCAFile: t.ClientCAFile,
+		ClientAuth:   t.ClientAuth,
+	}
+}
+
+type StoreConfig struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+}
+
+type LogConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+type TimeoutsConfig struct {
+	Read     Duration `json:"read"`
+	Write    Duration `json:"write"`
+	Idle     Duration `json:"idle"`
+	Shutdown Duration `json:"shutdown"`
+}
+
+type WebhookConfig struct {
+	Workers          int      `json:"workers"`
+	QueueSize        int      `json:"queueSize"`
+	MaxAttempts      int      `json:"maxAttempts"`
+	Timeout          Duration `json:"timeout"`
+	MaxSubscriptions int      `json:"maxSubscriptions"`
+	MaxDeadLetters   int      `json:"maxDeadLetters"`
+}
+
+type StreamConfig struct {
+	ReplaySize int `json:"replaySize"`
+	BufferSize int `json:"bufferSize"`
+}
+
+type CurrencyConfig struct {
+	Base      string `json:"base"`
+	RatesFile string `json:"ratesFile"`
+}
+
+type ProcessingConfig struct {
+	Mode      string `json:"mode"`
+	Workers   int    `json:"workers"`
+	QueueSize int    `json:"queueSize"`
+}
+
+type FraudConfig struct {
+	HoldScore        int           `json:"holdScore"`
+	FutureTolerance  Duration      `json:"futureTolerance"`
+	Window           Duration      `json:"window"`
+	VelocityLimit    int           `json:"velocityLimit"`
+	BonusRatio       float64       `json:"bonusRatio"`
+	BonusMinReceipts int           `json:"bonusMinReceipts"`
+	Weights          fraud.Weights `json:"weights"`
+}
+
+type Config struct {
+	Addr            string                   `json:"addr"`
+	GRPCAddr        string                   `json:"grpcAddr"`
+	TLS             TLSConfig                `json:"tls"`
+	Store           StoreConfig              `json:"store"`
+	Limits          handlers.Limits          `json:"limits"`
+	Reconcile       handlers.ReconcilePolicy `json:"reconciliation"`
+	Processing      ProcessingConfig         `json:"processing"`
+	Currency        CurrencyConfig           `json:"currency"`
+	RateLimits      ratelimit.Config         `json:"rateLimits"`
+	RulesFile       string                   `json:"rulesFile"`
+	TenantsFile     string                   `json:"tenantsFile"`
+	RetailersFile   string                   `json:"retailersFile"`
+	Fraud           FraudConfig              `json:"fraud"`
+	AdminToken      string                   `json:"adminToken"`
+	RescorePageSize int                      `json:"rescorePageSize"`
+	RescoreMaxJobs  int                      `json:"rescoreMaxJobs"`
+	Log             LogConfig                `json:"log"`
+	Timeouts        TimeoutsConfig           `json:"timeouts"`
+	Webhooks        WebhookConfig            `json:"webhooks"`
+	Stream          StreamConfig             `json:"stream"`
+	GraphQL         graphqlapi.Limits        `json:"graphql"`
+}
+
+func Default() Config {
+	rateLimits := ratelimit.Config{
+		Default: ratelimit.DefaultConfig.Default,
+		Routes:  make(map[string]ratelimit.Limit, len(ratelimit.DefaultConfig.Routes)),
+	}
+	for route, limit := range ratelimit.DefaultConfig.Routes {
+		rateLimits.Routes[route] = limit
+	}
+
+	return Config{
+		Addr:            ":8080",
+		GRPCAddr:        ":9090",
+		TLS:             TLSConfig{ClientAuth: "none", ReloadInterval: Duration{30 * time.Second}},
+		Store:           StoreConfig{Backend: "memory"},
+		Limits:          handlers.DefaultLimits,
+		Reconcile:       handlers.DefaultReconcilePolicy,
+		Processing:      ProcessingConfig{Mode: "sync", Workers: 4, QueueSize: 1000},
+		RescorePageSize: rescore.DefaultPageSize,
+		RescoreMaxJobs:  rescore.DefaultMaxJobs,
+		Currency:        CurrencyConfig{Base: currency.Legacy},
+		RateLimits:      rateLimits,
+		Fraud: FraudConfig{
+			HoldScore:        fraud.DefaultConfig.HoldScore,
+			FutureTolerance:  Duration{fraud.DefaultConfig.FutureTolerance},
+			Window:           Duration{fraud.DefaultConfig.Window},
+			VelocityLimit:    fraud.DefaultConfig.VelocityLimit,
+			BonusRatio:       fraud.DefaultConfig.BonusRatio,
+			BonusMinReceipts: fraud.DefaultConfig.BonusMinReceipts,
+			Weights:          fraud.DefaultConfig.Weights,
+		},
+		Log: LogConfig{Level: "info", Format: "json"},
+		Timeouts: TimeoutsConfig{
+			Read:     Duration{server.DefaultTimeouts.Read},
+			Write:    Duration{server.DefaultTimeouts.Write},
+			Idle:     Duration{server.DefaultTimeouts.Idle},
+			Shutdown: Duration{server.DefaultTimeouts.Shutdown},
+		},
+		Webhooks: WebhookConfig{
+			Workers:          4,
+			QueueSize:        1000,
+			MaxAttempts:      5,
+			Timeout:          Duration{10 * time.Second},
+			MaxSubscriptions: 10,
+			MaxDeadLetters:   1000,
+		},
+		Stream:  StreamConfig{ReplaySize: 1000, BufferSize: 64},
+		GraphQL: graphqlapi.DefaultLimits,
+	}
+}
+
+// setting is a single value that can be overridden by an environment
+// variable and a command-line flag of the same name.
+type setting struct {
+	name  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+func stringSetting(name, usage string, field func(c *Config) *string) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func intSetting(name, usage string, field func(c *Config) *int) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func durationSetting(name, usage string, field func(c *Config) *Duration) setting {
+	return setting{name, usage, func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field(c).Duration = d
+		return nil
+	}}
+}
+
+var settings = []setting{
+	stringSetting("addr", "listen address", func(c *Config) *string { return &c.Addr }),
+	stringSetting("grpc-addr", "gRPC listen address; empty disables gRPC", func(c *Config) *string { return &c.GRPCAddr }),
+	stringSetting("tls-cert", "TLS certificate file", func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tls-key", "TLS private key file", func(c *Config) *string { return &c.TLS.KeyFile }),
+	stringSetting("tls-client-ca", "CA file for verifying client certificates", func(c *Config) *string { return &c.TLS.ClientCAFile }),
+	stringSetting("tls-client-auth", "client certificates: none, request or require", func(c *Config) *string { return &c.TLS.ClientAuth }),
+	durationSetting("tls-reload-interval", "how often to check certificate files for changes", func(c *Config) *Duration { return &c.TLS.ReloadInterval }),
+	stringSetting("store-backend", "store backend: memory or file", func(c *Config) *string { return &c.Store.Backend }),
+	stringSetting("store-path", "snapshot file for the file store backend", func(c *Config) *string { return &c.Store.Path }),
+	setting{"max-body-bytes", "maximum request body size in bytes", func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.Limits.MaxBodyBytes = n
+		return nil
+	}},
+	intSetting("max-items", "maximum items per receipt", func(c *Config) *int { return &c.Limits.MaxItems }),
+	intSetting("max-retailer-length", "maximum retailer name length", func(c *Config) *int { return &c.Limits.MaxRetailerLength }),
+	intSetting("max-description-length", "maximum item description length", func(c *Config) *int { return &c.Limits.MaxDescriptionLength }),
+	setting{"strict", "reject unknown JSON fields", func(c *Config, value string) error {
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		c.Limits.Strict = strict
+		return nil
+	}},
+	setting{"reconciliation-policy", "mismatched totals: reject, warn or review", func(c *Config, value string) error {
+		c.Reconcile = handlers.ReconcilePolicy(value)
+		return nil
+	}},
+	stringSetting("processing-mode", "receipt processing: sync or async", func(c *Config) *string { return &c.Processing.Mode }),
+	intSetting("processing-workers", "concurrent receipt processing workers in async mode", func(c *Config) *int { return &c.Processing.Workers }),
+	intSetting("processing-queue-size", "receipts queued for processing in async mode", func(c *Config) *int { return &c.Processing.QueueSize }),
+	stringSetting("base-currency", "currency receipts are converted to for scoring", func(c *Config) *string { return &c.Currency.Base }),
+	stringSetting("exchange-rates-file", "JSON file with exchange rates to the base currency", func(c *Config) *string { return &c.Currency.RatesFile }),
+	stringSetting("rules-file", "JSON file with the default scoring rules", func(c *Config) *string { return &c.RulesFile }),
+	stringSetting("tenants-file", "JSON file with tenant definitions", func(c *Config) *string { return &c.TenantsFile }),
+	stringSetting("retailers-file", "JSON file with canonical retailers and their aliases", func(c *Config) *string { return &c.RetailersFile }),
+	intSetting("fraud-hold-score", "risk score at which points are held; 0 never holds", func(c *Config) *int { return &c.Fraud.HoldScore }),
+	durationSetting("fraud-window", "how far back member submissions count towards fraud heuristics", func(c *Config) *Duration { return &c.Fraud.Window }),
+	intSetting("fraud-velocity-limit", "receipts a member may submit within the fraud window", func(c *Config) *int { return &c.Fraud.VelocityLimit }),
+	stringSetting("admin-token", "bearer token for the admin review and rescore endpoints; empty disables them", func(c *Config) *string { return &c.AdminToken }),
+	intSetting("rescore-page-size", "receipts a rescore job reads from the store at a time", func(c *Config) *int { return &c.RescorePageSize }),
+	intSetting("rescore-max-jobs", "rescore jobs and their change reports kept per tenant", func(c *Config) *int { return &c.RescoreMaxJobs }),
+	stringSetting("log-level", "log level: debug, info, warn or error", func(c *Config) *string { return &c.Log.Level }),
+	stringSetting("log-format", "log format: json or text", func(c *Config) *string { return &c.Log.Format }),
+	intSetting("webhook-workers", "concurrent webhook deliveries", func(c *Config) *int { return &c.Webhooks.Workers }),
+	intSetting("webhook-max-attempts", "delivery attempts before a webhook is dead-lettered", func(c *Config) *int { return &c.Webhooks.MaxAttempts }),
+	intSetting("webhook-max-subscriptions", "webhook subscriptions per tenant", func(c *Config) *int { return &c.Webhooks.MaxSubscriptions }),
+	intSetting("webhook-max-dead-letters", "dead-lettered webhook deliveries kept per tenant", func(c *Config) *int { return &c.Webhooks.MaxDeadLetters }),
+	intSetting("graphql-max-depth", "maximum GraphQL query depth", func(c *Config) *int { return &c.GraphQL.MaxDepth }),
+	intSetting("graphql-max-complexity", "maximum GraphQL query complexity", func(c *Config) *int { return &c.GraphQL.MaxComplexity }),
+	intSetting("graphql-max-mutations", "maximum GraphQL mutations per operation", func(c *Config) *int { return &c.GraphQL.MaxMutations }),
+	durationSetting("read-timeout", "HTTP read timeout", func(c *Config) *Duration { return &c.Timeouts.Read }),
+	durationSetting("write-timeout", "HTTP write timeout", func(c *Config) *Duration { return &c.Timeouts.Write }),
+	durationSetting("idle-timeout", "HTTP idle timeout", func(c *Config) *Duration { return &c.Timeouts.Idle }),
+	durationSetting("shutdown-timeout", "time allowed for in-flight requests on shutdown", func(c *Config) *Duration { return &c.Timeouts.Shutdown }),
+}
+
+// EnvName returns the environment variable for a setting, e.g. store-path
+// becomes RECEIPT_STORE_PATH.
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+type flagValue struct {
+	setting setting
+	value   string
+}
+
+func (f *flagValue) String() string { return f.value }
+
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+// Load merges the defaults, the config file, environment variables and
+// command-line flags, each overriding the one before. It reports whether
+// --print-config was requested.
+func Load(args []string, getenv func(string) string) (Config, bool, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("receipt-processor", flag.ContinueOnError)
+	configFile := fs.String("config", getenv(EnvName("config")), "JSON config file")
+	printConfig := fs.Bool("print-config", false, "print the merged configuration and exit")
+
+	for _, s := range settings {
+		fs.Var(&flagValue{setting: s}, s.name, fmt.Sprintf("%s (env %s)", s.usage, EnvName(s.name)))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return cfg, false, fmt.Errorf("reading config file: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			return cfg, false, fmt.Errorf("parsing config file %s: %w", *configFile, err)
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(EnvName(s.name)); value != "" {
+			if err := s.set(&cfg, value); err != nil {
+				return cfg, false, fmt.Errorf("invalid %s: %w", EnvName(s.name), err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if v, ok := f.Value.(*flagValue); ok && flagErr == nil {
+			if err := v.setting.set(&cfg, v.value); err != nil {
+				flagErr = fmt.Errorf("invalid -%s: %w", f.Name, err)
+			}
+		}
+	})
+	if flagErr != nil {
+		return cfg, false, flagErr
+	}
+
+	return cfg, *printConfig, cfg.Validate()
+}
+
+// Redacted returns a copy of the config with secrets masked, for printing.
+func (c Config) Redacted() Config {
+	if c.AdminToken != "" {
+		c.AdminToken = "REDACTED"
+	}
+	return c
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr must not be empty"))
+	}
+	if c.GRPCAddr != "" && c.GRPCAddr == c.Addr {
+		errs = append(errs, errors.New("grpcAddr must differ from addr"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls certFile and keyFile must be set together"))
+	}
+	switch c.TLS.ClientAuth {
+	case "none":
+	case "request", "require":
+		if c.TLS.CertFile == "" {
+			errs = append(errs, errors.New("tls clientAuth requires a server certificate"))
+		}
+		if c.TLS.ClientCAFile == "" {
+			errs = append(errs, errors.New("tls clientAuth requires clientCAFile"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown tls clientAuth %q", c.TLS.ClientAuth))
+	}
+	if c.TLS.CertFile != "" && c.TLS.ReloadInterval.Duration <= 0 {
+		errs = append(errs, errors.New("tls reloadInterval must be positive"))
+	}
+
+	switch c.Store.Backend {
+	case "memory":
+	case "file":
+		if c.Store.Path == "" {
+			errs = append(errs, errors.New("store path is required for the file backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown store backend %q", c.Store.Backend))
+	}
+
+	if c.Limits.MaxBodyBytes < 0 || c.Limits.MaxItems < 0 ||
+		c.Limits.MaxRetailerLength < 0 || c.Limits.MaxDescriptionLength < 0 {
+		errs = append(errs, errors.New("limits must not be negative"))
+	}
+	for name, charset := range map[string]handlers.Charset{
+		"retailerCharset": c.Limits.RetailerCharset, "descriptionCharset": c.Limits.DescriptionCharset,
+	} {
+		if err := charset.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("limits %s: %w", name, err))
+		}
+	}
+
+	if !c.Reconcile.Valid() {
+		errs = append(errs, fmt.Errorf("unknown reconciliation policy %q", c.Reconcile))
+	}
+	switch c.Processing.Mode {
+	case "sync":
+	case "async":
+		if c.Processing.Workers < 1 || c.Processing.QueueSize < 1 {
+			errs = append(errs, errors.New("processing workers and queueSize must be positive"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown processing mode %q", c.Processing.Mode))
+	}
+	if c.RescorePageSize < 1 || c.RescoreMaxJobs < 1 {
+		errs = append(errs, errors.New("rescorePageSize and rescoreMaxJobs must be positive"))
+	}
+	if _, err := currency.MinorUnits(c.Currency.Base); err != nil {
+		errs = append(errs, fmt.Errorf("currency base: %w", err))
+	}
+
+	if c.Fraud.HoldScore < 0 || c.Fraud.VelocityLimit < 0 || c.Fraud.BonusMinReceipts < 0 ||
+		c.Fraud.FutureTolerance.Duration < 0 || c.Fraud.Window.Duration <= 0 {
+		errs = append(errs, errors.New("fraud settings must not be negative and window must be positive"))
+	}
+	if c.Fraud.BonusRatio < 0 || c.Fraud.BonusRatio > 1 {
+		errs = append(errs, errors.New("fraud bonusRatio must be between 0 and 1"))
+	}
+	w := c.Fraud.Weights
+	if w.FutureDate < 0 || w.RoundTotal < 0 || w.Velocity < 0 || w.BonusRatio < 0 {
+		errs = append(errs, errors.New("fraud weights must not be negative"))
+	}
+
+	if c.Webhooks.Workers < 1 || c.Webhooks.QueueSize < 1 || c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhook workers, queueSize and maxAttempts must be positive"))
+	}
+	if c.Webhooks.MaxSubscriptions < 1 || c.Webhooks.MaxDeadLetters < 1 {
+		errs = append(errs, errors.New("webhook maxSubscriptions and maxDeadLetters must be positive"))
+	}
+
+	if c.Stream.ReplaySize < 0 || c.Stream.BufferSize < 1 {
+		errs = append(errs, errors.New("stream replaySize must not be negative and bufferSize must be positive"))
+	}
+
+	if c.GraphQL.MaxDepth < 1 || c.GraphQL.MaxComplexity < 1 || c.GraphQL.MaxMutations < 1 {
+		errs = append(errs, errors.New("graphql maxDepth, maxComplexity and maxMutations must be positive"))
+	}
+
+	if _, err := c.Log.SlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("unknown log format %q", c.Log.Format))
+	}
+
+	for name, d := range map[string]Duration{
+		"read": c.Timeouts.Read, "write": c.Timeouts.Write,
+		"idle": c.Timeouts.Idle, "shutdown": c.Timeouts.Shutdown,
+	} {
+		if d.Duration < 0 {
+			errs = append(errs, fmt.Errorf("%s timeout must not be negative", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return level, fmt.Errorf("unknown log level %q", l.Level)
+	}
+	return level, nil
+}
+
+func (t TimeoutsConfig) ServerTimeouts() server.Timeouts {
+	return server.Timeouts{
+		Read:     t.Read.Duration,
+		Write:    t.Write.Duration,
+		Idle:     t.Idle.Duration,
+		Shutdown: t.Shutdown.Duration,
+	}
+}
+
+func (f FraudConfig) Assessor() fraud.Config {
+	return fraud.Config{
+		HoldScore:        f.HoldScore,
+		FutureTolerance:  f.FutureTolerance.Duration,
+		Window:           f.Window.Duration,
+		VelocityLimit:    f.VelocityLimit,
+		BonusRatio:       f.BonusRatio,
+		BonusMinReceipts: f.BonusMinReceipts,
+		Weights:          f.Weights,
+	}
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/fraud"
+	"github.com/receipt-processor/handlers"
+)
+
+func envMap(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, printConfig, err := Load(nil, envMap(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if printConfig {
+		t.Error("expected print-config to be off by default")
+	}
+	if cfg.Addr != ":8080" || cfg.Store.Backend != "memory" || cfg.Log.Level != "info" {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.Timeouts.Shutdown.Duration != 30*time.Second {
+		t.Errorf("expected 30s shutdown timeout, got %v", cfg.Timeouts.Shutdown)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"addr": ":9000",
+		"log": {"level": "debug"},
+		"limits": {"maxItems": 50},
+		"timeouts": {"read": "5s"}
+	}`)
+
+	t.Run("file overrides defaults", func(t *testing.T) {
+		cfg, _, err := Load([]string{"--config", path}, envMap(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Addr != ":9000" || cfg.Log.Level != "debug" || cfg.Limits.MaxItems != 50 {
+			t.Errorf("expected file values, got %+v", cfg)
+		}
+		if cfg.Log.Format != "json" || cfg.Limits.MaxBodyBytes != 1<<20 {
+			t.Errorf("expected unset file values to keep defaults, got %+v", cfg)
+		}
+		if cfg.Timeouts.Read.Duration != 5*time.Second {
+			t.Errorf("expected 5s read timeout, got %v", cfg.Timeouts.Read)
+		}
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		env := envMap(map[string]string{
+			"RECEIPT_CONFIG":    path,
+			"RECEIPT_ADDR":      ":9100",
+			"RECEIPT_MAX_ITEMS": "75",
+		})
+		cfg, _, err := Load(nil, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Addr != ":9100" || cfg.Limits.MaxItems != 75 || cfg.Log.Level != "debug" {
+			t.Errorf("unexpected merged config: %+v", cfg)
+		}
+	})
+
+	t.Run("flags override env", func(t *testing.T) {
+		env := envMap(map[string]string{"RECEIPT_ADDR": ":9100", "RECEIPT_STRICT": "false"})
+		cfg, printConfig, err := Load([]string{"--config", path, "--addr", ":9200", "--strict", "true", "--print-config"}, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Addr != ":9200" || !cfg.Limits.Strict {
+			t.Errorf("expected flag values, got %+v", cfg)
+		}
+		if !printConfig {
+			t.Error("expected print-config to be requested")
+		}
+	})
+}
+
+func TestLoadDoesNotMutateRateLimitDefaults(t *testing.T) {
+	path := writeConfigFile(t, `{"rateLimits": {"routes": {"/metrics": {"rate": 1, "burst": 1}}}}`)
+	if _, _, err := Load([]string{"--config", path}, envMap(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := Default().RateLimits.Routes["/metrics"]; ok {
+		t.Error("expected loading a config file not to change the defaults")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		expected string
+	}{
+		{"bad env value", nil, map[string]string{"RECEIPT_MAX_ITEMS": "many"}, "RECEIPT_MAX_ITEMS"},
+		{"bad flag value", []string{"--read-timeout", "soon"}, nil, "-read-timeout"},
+		{"unknown flag", []string{"--bogus"}, nil, "bogus"},
+		{"missing config file", []string{"--config", "/nonexistent/config.json"}, nil, "reading config file"},
+		{"file backend without path", []string{"--store-backend", "file"}, nil, "store path"},
+		{"unknown backend", []string{"--store-backend", "redis"}, nil, "unknown store backend"},
+		{"half TLS", []string{"--tls-cert", "cert.pem"}, nil, "tls"},
+		{"client auth without CA", []string{"--tls-cert", "c.pem", "--tls-key", "k.pem", "--tls-client-auth", "require"}, nil, "clientCAFile"},
+		{"client auth without TLS", []string{"--tls-client-ca", "ca.pem", "--tls-client-auth", "request"}, nil, "server certificate"},
+		{"unknown client auth", []string{"--tls-client-auth", "maybe"}, nil, "clientAuth"},
+		{"bad log level", []string{"--log-level", "loud"}, nil, "log level"},
+		{"bad log format", []string{"--log-format", "xml"}, nil, "log format"},
+		{"negative limit", []string{"--max-items", "-1"}, nil, "negative"},
+		{"no webhook workers", []string{"--webhook-workers", "0"}, nil, "webhook"},
+		{"no webhook subscriptions", []string{"--webhook-max-subscriptions", "0"}, nil, "maxSubscriptions"},
+		{"no GraphQL depth", []string{"--graphql-max-depth", "0"}, nil, "graphql"},
+		{"no GraphQL mutations", []string{"--graphql-max-mutations", "0"}, nil, "graphql"},
+		{"unknown reconciliation policy", []string{"--reconciliation-policy", "ignore"}, nil, "reconciliation policy"},
+		{"unknown base currency", []string{"--base-currency", "usd"}, nil, "currency base"},
+		{"negative fraud hold score", []string{"--fraud-hold-score", "-1"}, nil, "fraud"},
+		{"no fraud window", []string{"--fraud-window", "0s"}, nil, "fraud"},
+		{"unknown processing mode", []string{"--processing-mode", "batch"}, nil, "processing mode"},
+		{"no rescore page size", []string{"--rescore-page-size", "0"}, nil, "rescorePageSize"},
+		{"no rescore jobs kept", []string{"--rescore-max-jobs", "0"}, nil, "rescoreMaxJobs"},
+		{"no processing workers", []string{"--processing-mode", "async", "--processing-workers", "0"}, nil, "processing"},
+		{"shared gRPC address", []string{"--addr", ":8080", "--grpc-addr", ":8080"}, nil, "grpcAddr"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := Load(tc.args, envMap(tc.env))
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownFileFields(t *testing.T) {
+	path := writeConfigFile(t, `{"addr": ":8081", "adminTokn": "secret"}`)
+	if _, _, err := Load([]string{"--config", path}, envMap(nil)); err == nil || !strings.Contains(err.Error(), "adminTokn") {
+		t.Errorf("expected the misspelt field to be rejected, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg, _, err := Load([]string{"--admin-token", "s3cret"}, envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redacted := cfg.Redacted(); redacted.AdminToken != "REDACTED" || cfg.AdminToken != "s3cret" {
+		t.Errorf("expected only the copy to be redacted, got %q and %q", redacted.AdminToken, cfg.AdminToken)
+	}
+	if Default().Redacted().AdminToken != "" {
+		t.Error("expected an unset token to stay empty")
+	}
+}
+
+func TestLoadMutualTLS(t *testing.T) {
+	args := []string{
+		"--tls-cert", "server.pem", "--tls-key", "server.key",
+		"--tls-client-ca", "ca.pem", "--tls-client-auth", "require",
+		"--tls-reload-interval", "5s",
+	}
+	cfg, _, err := Load(args, envMap(nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts := cfg.TLS.Options()
+	if opts.ClientCAFile != "ca.pem" || opts.ClientAuth != "require" {
+		t.Errorf("unexpected TLS options: %+v", opts)
+	}
+	if cfg.TLS.ReloadInterval.Duration != 5*time.Second {
+		t.Errorf("expected 5s reload interval, got %v", cfg.TLS.ReloadInterval)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if got := EnvName("store-path"); got != "RECEIPT_STORE_PATH" {
+		t.Errorf("expected RECEIPT_STORE_PATH, got %s", got)
+	}
+}
+
+func TestLoadCharsets(t *testing.T) {
+	path := writeConfigFile(t, `{"limits": {"retailerCharset": {"scripts": ["Latin", "Han"]}}}`)
+	cfg, _, err := Load([]string{"--config", path}, envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Limits.RetailerCharset.Scripts) != 2 || cfg.Limits.RetailerCharset.Punctuation != handlers.DefaultRetailerCharset.Punctuation {
+		t.Errorf("expected scripts with the default punctuation, got %+v", cfg.Limits.RetailerCharset)
+	}
+
+	path = writeConfigFile(t, `{"limits": {"descriptionCharset": {"scripts": ["Klingon"]}}}`)
+	if _, _, err := Load([]string{"--config", path}, envMap(nil)); err == nil || !strings.Contains(err.Error(), "Klingon") {
+		t.Errorf("expected an unknown script error, got %v", err)
+	}
+}
+
+func TestLoadFraud(t *testing.T) {
+	path := writeConfigFile(t, `{"fraud": {"holdScore": 80, "window": "30m", "weights": {"round_total": 0}}}`)
+	cfg, _, err := Load([]string{"--config", path, "--fraud-velocity-limit", "5"}, envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fraud.DefaultConfig
+	expected.HoldScore = 80
+	expected.Window = 30 * time.Minute
+	expected.VelocityLimit = 5
+	expected.Weights.RoundTotal = 0
+	if actual := cfg.Fraud.Assessor(); actual != expected {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	path = writeConfigFile(t, `{"fraud": {"bonusRatio": 1.5}}`)
+	if _, _, err := Load([]string{"--config", path}, envMap(nil)); err == nil || !strings.Contains(err.Error(), "bonusRatio") {
+		t.Errorf("expected a bonusRatio error, got %v", err)
+	}
+}
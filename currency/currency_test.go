@@ -0,0 +1,150 @@
+package currency
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	testCases := []struct {
+		amount   string
+		digits   int
+		expected int64
+		valid    bool
+	}{
+		{"10.00", 2, 1000, true},
+		{"0.05", 2, 5, true},
+		{"1200", 0, 1200, true},
+		{"1.250", 3, 1250, true},
+		{"10", 2, 0, false},
+		{"10.0", 2, 0, false},
+		{"1200.00", 0, 0, false},
+		{"-1.00", 2, 0, false},
+		{".50", 2, 0, false},
+		{"1e3", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		minor, err := ParseAmount(tc.amount, tc.digits)
+		if (err == nil) != tc.valid || minor != tc.expected {
+			t.Errorf("ParseAmount(%q, %d) = %d, %v", tc.amount, tc.digits, minor, err)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	testCases := []struct {
+		minor    int64
+		digits   int
+		expected string
+	}{
+		{1000, 2, "10.00"},
+		{5, 2, "0.05"},
+		{-5, 2, "-0.05"},
+		{1200, 0, "1200"},
+		{-1250, 3, "-1.250"},
+		{0, 2, "0.00"},
+	}
+
+	for _, tc := range testCases {
+		if got := FormatAmount(tc.minor, tc.digits); got != tc.expected {
+			t.Errorf("FormatAmount(%d, %d) = %q, expected %q", tc.minor, tc.digits, got, tc.expected)
+		}
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	for code, expected := range map[string]int{"USD": 2, "CAD": 2, "JPY": 0, "KWD": 3} {
+		if digits, err := MinorUnits(code); err != nil || digits != expected {
+			t.Errorf("MinorUnits(%s) = %d, %v", code, digits, err)
+		}
+	}
+	for _, code := range []string{"", "usd", "XYZ"} {
+		if _, err := MinorUnits(code); !errors.Is(err, ErrUnknownCurrency) {
+			t.Errorf("expected %q to be unknown, got %v", code, err)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	table, err := NewTable("USD", []Rate{
+		{Currency: "CAD", Rate: "0.75", Effective: "2023-06-01"},
+		{Currency: "CAD", Rate: "0.7", Effective: "2022-01-01"},
+		{Currency: "JPY", Rate: "0.0067", Effective: "2022-01-01"},
+		{Currency: "KWD", Rate: "3.25", Effective: "2022-01-01"},
+		{Currency: "ISK", Rate: "0.005", Effective: "2022-01-01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		minor    int64
+		code     string
+		date     string
+		expected int64
+		err      error
+	}{
+		{"base currency", 1234, "USD", "2020-01-01", 1234, nil},
+		{"earlier rate", 1000, "CAD", "2023-05-31", 700, nil},
+		{"later rate on its effective date", 1000, "CAD", "2023-06-01", 750, nil},
+		{"whole yen", 1200, "JPY", "2022-03-01", 804, nil},
+		{"rounds to the nearest cent", 75, "JPY", "2022-03-01", 50, nil},
+		{"rounds half up", 3, "ISK", "2022-03-01", 2, nil},
+		{"three decimals", 1250, "KWD", "2022-03-01", 406, nil},
+		{"before any rate", 1000, "CAD", "2021-12-31", 0, ErrNoRate},
+		{"no rates at all", 1000, "EUR", "2022-03-01", 0, ErrNoRate},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			converted, err := table.Convert(tc.minor, tc.code, tc.date)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if converted != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, converted)
+			}
+		})
+	}
+}
+
+func TestNewTableErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		base  string
+		rates []Rate
+	}{
+		{"unknown base", "XYZ", nil},
+		{"unknown currency", "USD", []Rate{{Currency: "XYZ", Rate: "1", Effective: "2022-01-01"}}},
+		{"bad date", "USD", []Rate{{Currency: "CAD", Rate: "0.7", Effective: "01/01/2022"}}},
+		{"zero rate", "USD", []Rate{{Currency: "CAD", Rate: "0", Effective: "2022-01-01"}}},
+		{"non-numeric rate", "USD", []Rate{{Currency: "CAD", Rate: "cheap", Effective: "2022-01-01"}}},
+	}
+
+	for _, tc := range testCases {
+		if _, err := NewTable(tc.base, tc.rates); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	data := `[{"currency": "CAD", "rate": "0.74", "effective": "2024-01-01"}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := LoadTable("USD", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.CanConvert("CAD", "2024-02-01"); err != nil {
+		t.Errorf("expected CAD to convert, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package currency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+)
+
+var ErrNoRate = errors.New("no exchange rate")
+
+// Rate is the value of one unit of Currency in the base currency from
+// Effective (YYYY-MM-DD) until the currency's next rate takes effect.
+type Rate struct {
+	Currency  string `json:"currency"`
+	Rate      string `json:"rate"`
+	Effective string `json:"effective"`
+}
+
+type rate struct {
+	effective string
+	value     *big.Rat
+}
+
+// Table converts amounts to a base currency using locally configured
+// rates. It is read-only once built.
+type Table struct {
+	base  string
+	rates map[string][]rate
+}
+
+// Default is the table used for scoring. It converts nothing until main
+// installs the configured rates.
+var Default = &Table{base: Legacy}
+
+// NewTable builds a table for the base currency. Rates for the same
+// currency may be given in any order.
+func NewTable(base string, rates []Rate) (*Table, error) {
+	if _, err := MinorUnits(base); err != nil {
+		return nil, err
+	}
+
+	t := &Table{base: base, rates: make(map[string][]rate)}
+	for _, r := range rates {
+		if _, err := MinorUnits(r.Currency); err != nil {
+			return nil, err
+		}
+		if _, err := time.Parse("2006-01-02", r.Effective); err != nil {
+			return nil, fmt.Errorf("rate for %s: invalid effective date %q", r.Currency, r.Effective)
+		}
+		value, ok := new(big.Rat).SetString(r.Rate)
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("rate for %s: invalid rate %q", r.Currency, r.Rate)
+		}
+		t.rates[r.Currency] = append(t.rates[r.Currency], rate{effective: r.Effective, value: value})
+	}
+	for _, list := range t.rates {
+		sort.Slice(list, func(i, j int) bool { return list[i].effective < list[j].effective })
+	}
+	return t, nil
+}
+
+// LoadTable reads rates from a JSON array of Rate.
+func LoadTable(base, path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rates []Rate
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("parsing exchange rates %s: %w", path, err)
+	}
+	return NewTable(base, rates)
+}
+
+func (t *Table) Base() string {
+	return t.base
+}
+
+// rateOn finds the rate in effect on a date, YYYY-MM-DD.
+func (t *Table) rateOn(code, date string) (*big.Rat, error) {
+	if code == t.base {
+		return big.NewRat(1, 1), nil
+	}
+	list := t.rates[code]
+	i := sort.Search(len(list), func(i int) bool { return list[i].effective > date })
+	if i == 0 {
+		return nil, fmt.Errorf("%w for %s on %s", ErrNoRate, code, date)
+	}
+	return list[i-1].value, nil
+}
+
+// CanConvert reports whether an amount in code on date can be converted.
+func (t *Table) CanConvert(code, date string) error {
+	_, err := t.rateOn(code, date)
+	return err
+}
+
+// Convert turns minor units of code into minor units of the base
+// currency at the rate in effect on date, rounding half away from zero.
+func (t *Table) Convert(minor int64, code, date string) (int64, error) {
+	value, err := t.rateOn(code, date)
+	if err != nil {
+		return 0, err
+	}
+	from, err := MinorUnits(code)
+	if err != nil {
+		return 0, err
+	}
+	to, _ := MinorUnits(t.base)
+
+	converted := new(big.Rat).Mul(big.NewRat(minor, 1), value)
+	converted.Mul(converted, new(big.Rat).SetFrac(pow10(to), pow10(from)))
+	return roundRat(converted), nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func roundRat(r *big.Rat) int64 {
+	num := new(big.Int).Abs(r.Num())
+	q, m := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if new(big.Int).Mul(m, big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
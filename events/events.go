@@ -0,0 +1,162 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type Event struct {
+	ID        uint64    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	ReceiptID string    `json:"receiptId"`
+	Retailer  string    `json:"retailer"`
+	Points    int       `json:"points"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Filter struct {
+	Tenant   string
+	Retailer string
+}
+
+// Match reports whether the event passes the filter. Retailers are compared
+// case-insensitively; empty fields match everything.
+func (f Filter) Match(e Event) bool {
+	if f.Tenant != "" && f.Tenant != e.Tenant {
+		return false
+	}
+	if f.Retailer != "" && !strings.EqualFold(strings.TrimSpace(f.Retailer), strings.TrimSpace(e.Retailer)) {
+		return false
+	}
+	return true
+}
+
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	filter Filter
+	bus    *Bus
+}
+
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+// Bus fans processed-receipt events out to subscribers and keeps the most
+// recent events so reconnecting clients can resume.
+type Bus struct {
+	replay      []Event
+	replaySize  int
+	bufferSize  int
+	nextID      uint64
+	subscribers map[*Subscription]struct{}
+	closed      bool
+	mu          sync.Mutex
+}
+
+func NewBus(replaySize, bufferSize int) *Bus {
+	return &Bus{
+		replaySize:  replaySize,
+		bufferSize:  bufferSize,
+		nextID:      1,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the event the next ID and delivers it to every matching
+// subscriber. Subscribers whose buffer is full are dropped rather than
+// blocking the publisher; their channel is closed.
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.ID = b.nextID
+	b.nextID++
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+
+	if b.replaySize > 0 {
+		if len(b.replay) == b.replaySize {
+			b.replay = append(b.replay[:0:0], b.replay[1:]...)
+		}
+		b.replay = append(b.replay, e)
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+	return e
+}
+
+// Subscribe registers a subscriber and returns the buffered events after
+// lastEventID that match the filter. The second result is false when
+// lastEventID is older than the replay buffer, meaning events were missed.
+func (b *Bus) Subscribe(filter Filter, lastEventID uint64) (*Subscription, []Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, b.bufferSize)
+	sub := &Subscription{C: ch, ch: ch, filter: filter, bus: b}
+	if b.closed {
+		close(ch)
+		return sub, nil, true
+	}
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventID == 0 {
+		return sub, nil, true
+	}
+
+	complete := len(b.replay) == 0 || b.replay[0].ID <= lastEventID+1
+	var missed []Event
+	for _, e := range b.replay {
+		if e.ID > lastEventID && filter.Match(e) {
+			missed = append(missed, e)
+		}
+	}
+	return sub, missed, complete
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Close ends every subscription by closing its channel, so streams finish
+// when the server shuts down. Later subscriptions start out closed.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Closed reports whether the bus has been closed.
+func (b *Bus) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
@@ -0,0 +1,127 @@
+package events
+
+import "testing"
+
+func TestBusPublishSubscribe(t *testing.T) {
+	bus := NewBus(10, 10)
+	sub, replay, _ := bus.Subscribe(Filter{Tenant: "acme"}, 0)
+	defer sub.Close()
+
+	if len(replay) != 0 {
+		t.Errorf("expected no replay for a new subscriber, got %d", len(replay))
+	}
+
+	bus.Publish(Event{Tenant: "globex", ReceiptID: "g-1"})
+	published := bus.Publish(Event{Tenant: "acme", ReceiptID: "a-1"})
+
+	got := <-sub.C
+	if got.ReceiptID != "a-1" || got.ID != published.ID || got.ID != 2 {
+		t.Errorf("expected only the matching event, got %+v", got)
+	}
+	if got.Timestamp.IsZero() {
+		t.Error("expected a timestamp to be assigned")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	event := Event{Tenant: "acme", Retailer: "Target "}
+
+	testCases := []struct {
+		name     string
+		filter   Filter
+		expected bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"matching tenant", Filter{Tenant: "acme"}, true},
+		{"other tenant", Filter{Tenant: "globex"}, false},
+		{"retailer ignores case and spaces", Filter{Retailer: "target"}, true},
+		{"other retailer", Filter{Retailer: "Walmart"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.Match(event); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestBusReplay(t *testing.T) {
+	bus := NewBus(3, 10)
+	for _, retailer := range []string{"A", "B", "A", "B", "A"} {
+		bus.Publish(Event{Tenant: "acme", Retailer: retailer})
+	}
+
+	t.Run("resume within buffer", func(t *testing.T) {
+		sub, replay, complete := bus.Subscribe(Filter{Tenant: "acme"}, 3)
+		defer sub.Close()
+
+		if !complete {
+			t.Error("expected replay to be complete")
+		}
+		if len(replay) != 2 || replay[0].ID != 4 || replay[1].ID != 5 {
+			t.Errorf("expected events 4 and 5, got %+v", replay)
+		}
+	})
+
+	t.Run("resume with filter", func(t *testing.T) {
+		sub, replay, _ := bus.Subscribe(Filter{Retailer: "A"}, 3)
+		defer sub.Close()
+
+		if len(replay) != 1 || replay[0].ID != 5 {
+			t.Errorf("expected event 5, got %+v", replay)
+		}
+	})
+
+	t.Run("resume beyond buffer", func(t *testing.T) {
+		sub, replay, complete := bus.Subscribe(Filter{}, 1)
+		defer sub.Close()
+
+		if complete {
+			t.Error("expected replay to report missed events")
+		}
+		if len(replay) != 3 {
+			t.Errorf("expected the 3 buffered events, got %d", len(replay))
+		}
+	})
+}
+
+func TestBusDropsSlowSubscriber(t *testing.T) {
+	bus := NewBus(0, 1)
+	slow, _, _ := bus.Subscribe(Filter{}, 0)
+
+	bus.Publish(Event{ReceiptID: "1"})
+	bus.Publish(Event{ReceiptID: "2"})
+
+	if bus.Subscribers() != 0 {
+		t.Errorf("expected slow subscriber to be dropped, got %d subscribers", bus.Subscribers())
+	}
+
+	<-slow.C
+	if _, ok := <-slow.C; ok {
+		t.Error("expected dropped subscriber's channel to be closed")
+	}
+
+	slow.Close()
+}
+
+func TestBusClose(t *testing.T) {
+	bus := NewBus(10, 10)
+	sub, _, _ := bus.Subscribe(Filter{}, 0)
+
+	bus.Close()
+	if _, ok := <-sub.C; ok {
+		t.Error("expected closing the bus to close subscriptions")
+	}
+	if bus.Subscribers() != 0 || !bus.Closed() {
+		t.Errorf("expected a closed bus without subscribers, got %d", bus.Subscribers())
+	}
+	sub.Close()
+
+	late, _, _ := bus.Subscribe(Filter{}, 0)
+	if _, ok := <-late.C; ok {
+		t.Error("expected subscriptions to a closed bus to start closed")
+	}
+	bus.Publish(Event{ReceiptID: "1"})
+}
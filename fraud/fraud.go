@@ -0,0 +1,203 @@
+// Package fraud scores how likely a receipt is to be fabricated, from
+// heuristics on the receipt itself and on the recent submissions of the
+// member who sent it.
+package fraud
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/processor"
+	"github.com/receipt-processor/timezone"
+)
+
+// MemberHeader identifies the end user submitting a receipt on behalf of a
+// tenant. Submissions without one are grouped under the tenant.
+const MemberHeader = "X-Member-ID"
+
+// Reasons reported in an assessment.
+const (
+	ReasonFutureDate = "future_date"
+	ReasonRoundTotal = "round_total"
+	ReasonVelocity   = "velocity"
+	ReasonBonusRatio = "bonus_ratio"
+)
+
+// unknownZoneSlack is how far ahead of UTC a receipt without a time zone
+// may have been printed.
+const unknownZoneSlack = 14 * time.Hour
+
+// Weights are the points each heuristic adds to the risk score. A zero
+// weight disables the heuristic.
+type Weights struct {
+	FutureDate int `json:"future_date"`
+	RoundTotal int `json:"round_total"`
+	Velocity   int `json:"velocity"`
+	BonusRatio int `json:"bonus_ratio"`
+}
+
+// Config tunes the heuristics:
+//
+//   - future_date: the purchase is more than FutureTolerance after now.
+//   - round_total: the total is a round amount, which also hits the
+//     quarter-multiple bonus.
+//   - velocity: the member sent more than VelocityLimit receipts within
+//     Window.
+//   - bonus_ratio: at least BonusRatio of the member's receipts within
+//     Window earned the round-dollar or afternoon bonus, once there are
+//     BonusMinReceipts of them.
+//
+// Receipts scoring HoldScore or more have their points held; zero never
+// holds.
+type Config struct {
+	HoldScore        int
+	FutureTolerance  time.Duration
+	Window           time.Duration
+	VelocityLimit    int
+	BonusRatio       float64
+	BonusMinReceipts int
+	Weights          Weights
+}
+
+var DefaultConfig = Config{
+	FutureTolerance:  time.Hour,
+	Window:           time.Hour,
+	VelocityLimit:    20,
+	BonusRatio:       0.8,
+	BonusMinReceipts: 5,
+	Weights:          Weights{FutureDate: 80, RoundTotal: 10, Velocity: 40, BonusRatio: 50},
+}
+
+type observation struct {
+	at       time.Time
+	bonusHit bool
+}
+
+// Assessor scores receipts and remembers each member's submissions within
+// the configured window. It is safe for concurrent use.
+type Assessor struct {
+	config Config
+	now    func() time.Time
+
+	mu          sync.Mutex
+	history     map[string][]observation
+	assessments int
+}
+
+func NewAssessor(config Config) *Assessor {
+	return &Assessor{config: config, now: time.Now, history: make(map[string][]observation)}
+}
+
+// Assess scores a validated receipt given the points breakdown it earned,
+// and records it in the member's history.
+func (a *Assessor) Assess(tenantID, member string, receipt models.Receipt, breakdown []processor.RulePoints) models.Risk {
+	now := a.now()
+	weights := a.config.Weights
+	var risk models.Risk
+	flag := func(reason string, weight int) {
+		if weight > 0 {
+			risk.Score += weight
+			risk.Reasons = append(risk.Reasons, reason)
+		}
+	}
+
+	if instant, err := timezone.Instant(receipt.PurchaseDate, receipt.PurchaseTime, receipt.TimeZone); err == nil {
+		latest := now.Add(a.config.FutureTolerance)
+		if receipt.TimeZone == "" {
+			latest = latest.Add(unknownZoneSlack)
+		}
+		if instant.After(latest) {
+			flag(ReasonFutureDate, weights.FutureDate)
+		}
+	}
+
+	bonusHit := false
+	for _, awarded := range breakdown {
+		switch awarded.Rule {
+		case processor.RuleRoundDollar:
+			flag(ReasonRoundTotal, weights.RoundTotal)
+			bonusHit = true
+		case processor.RuleAfternoon:
+			bonusHit = true
+		}
+	}
+
+	recent := a.observe(tenantID+"\x00"+member, observation{at: now, bonusHit: bonusHit})
+	if a.config.VelocityLimit > 0 && len(recent) > a.config.VelocityLimit {
+		flag(ReasonVelocity, weights.Velocity)
+	}
+	if len(recent) >= a.config.BonusMinReceipts && a.config.BonusRatio > 0 {
+		hits := 0
+		for _, o := range recent {
+			if o.bonusHit {
+				hits++
+			}
+		}
+		if float64(hits) >= a.config.BonusRatio*float64(len(recent)) {
+			flag(ReasonBonusRatio, weights.BonusRatio)
+		}
+	}
+
+	risk.Held = a.config.HoldScore > 0 && risk.Score >= a.config.HoldScore
+	return risk
+}
+
+// observe adds an observation to a member's history and returns the
+// observations still within the window, including it.
+func (a *Assessor) observe(key string, o observation) []observation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cutoff := o.at.Add(-a.config.Window)
+	recent := append(prune(a.history[key], cutoff), o)
+	a.history[key] = recent
+
+	// Forget members who have gone quiet now and then, so the history
+	// stays bounded by the number of recently active members.
+	a.assessments++
+	if a.assessments%1000 == 0 {
+		for k, observations := range a.history {
+			if observations = prune(observations, cutoff); len(observations) == 0 {
+				delete(a.history, k)
+			} else {
+				a.history[k] = observations
+			}
+		}
+	}
+	return append([]observation(nil), recent...)
+}
+
+func prune(observations []observation, cutoff time.Time) []observation {
+	i := 0
+	for i < len(observations) && !observations[i].at.After(cutoff) {
+		i++
+	}
+	return observations[i:]
+}
+
+type contextKey struct{}
+
+func NewMemberContext(ctx context.Context, member string) context.Context {
+	return context.WithValue(ctx, contextKey{}, member)
+}
+
+// MemberFromContext returns the submitting member, or an empty string when
+// the request did not name one.
+func MemberFromContext(ctx context.Context) string {
+	member, _ := ctx.Value(contextKey{}).(string)
+	return member
+}
+
+// Middleware records the member named by MemberHeader in the request
+// context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if member := r.Header.Get(MemberHeader); member != "" {
+			r = r.WithContext(NewMemberContext(r.Context(), member))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,135 @@
+package fraud
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/processor"
+)
+
+func newTestAssessor(config Config, now time.Time) *Assessor {
+	a := NewAssessor(config)
+	a.now = func() time.Time { return now }
+	return a
+}
+
+func TestAssessFutureDate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := newTestAssessor(DefaultConfig, now)
+
+	testCases := []struct {
+		date, clock, zone string
+		flagged           bool
+	}{
+		{"2024-03-01", "12:30", "UTC", false},
+		{"2024-03-01", "13:30", "UTC", true},
+		{"2024-03-02", "01:30", "+14:00", false},
+		{"2024-03-02", "01:30", "", false},
+		{"2024-03-02", "03:30", "", true},
+	}
+	for _, tc := range testCases {
+		receipt := models.Receipt{PurchaseDate: tc.date, PurchaseTime: tc.clock, TimeZone: tc.zone}
+		risk := a.Assess("acme", tc.date+tc.clock+tc.zone, receipt, nil)
+		if flagged := reflect.DeepEqual(risk.Reasons, []string{ReasonFutureDate}); flagged != tc.flagged {
+			t.Errorf("%s %s %q: expected flagged %v, got reasons %v", tc.date, tc.clock, tc.zone, tc.flagged, risk.Reasons)
+		}
+	}
+}
+
+func TestAssessVelocity(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	config := DefaultConfig
+	config.VelocityLimit = 3
+	a := newTestAssessor(config, now)
+	receipt := models.Receipt{PurchaseDate: "2024-03-01", PurchaseTime: "09:00"}
+
+	for i := 0; i < 3; i++ {
+		if risk := a.Assess("acme", "alice", receipt, nil); risk.Score != 0 {
+			t.Fatalf("receipt %d: expected no risk, got %+v", i+1, risk)
+		}
+	}
+	if risk := a.Assess("acme", "alice", receipt, nil); !reflect.DeepEqual(risk.Reasons, []string{ReasonVelocity}) {
+		t.Errorf("expected velocity, got %v", risk.Reasons)
+	}
+	if risk := a.Assess("acme", "bob", receipt, nil); risk.Score != 0 {
+		t.Errorf("expected other members to be unaffected, got %+v", risk)
+	}
+	if risk := a.Assess("globex", "alice", receipt, nil); risk.Score != 0 {
+		t.Errorf("expected other tenants to be unaffected, got %+v", risk)
+	}
+
+	a.now = func() time.Time { return now.Add(config.Window) }
+	if risk := a.Assess("acme", "alice", receipt, nil); risk.Score != 0 {
+		t.Errorf("expected the window to have passed, got %+v", risk)
+	}
+}
+
+func TestAssessBonusRatio(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	a := newTestAssessor(DefaultConfig, now)
+	receipt := models.Receipt{PurchaseDate: "2024-03-01", PurchaseTime: "15:00"}
+	afternoon := []processor.RulePoints{{Rule: processor.RuleAfternoon, Points: 10}}
+
+	for i := 1; i < DefaultConfig.BonusMinReceipts; i++ {
+		if risk := a.Assess("acme", "alice", receipt, afternoon); risk.Score != 0 {
+			t.Fatalf("receipt %d: expected no risk below the minimum, got %+v", i, risk)
+		}
+	}
+	risk := a.Assess("acme", "alice", receipt, afternoon)
+	if !reflect.DeepEqual(risk.Reasons, []string{ReasonBonusRatio}) || risk.Score != DefaultConfig.Weights.BonusRatio {
+		t.Errorf("expected bonus ratio, got %+v", risk)
+	}
+
+	roundDollar := []processor.RulePoints{{Rule: processor.RuleRoundDollar, Points: 50}}
+	risk = newTestAssessor(DefaultConfig, now).Assess("acme", "bob", receipt, roundDollar)
+	if !reflect.DeepEqual(risk.Reasons, []string{ReasonRoundTotal}) {
+		t.Errorf("expected round total, got %v", risk.Reasons)
+	}
+}
+
+func TestAssessHold(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	future := models.Receipt{PurchaseDate: "2024-03-05", PurchaseTime: "09:00", TimeZone: "UTC"}
+
+	if risk := newTestAssessor(DefaultConfig, now).Assess("acme", "", future, nil); risk.Held {
+		t.Errorf("expected the default config never to hold, got %+v", risk)
+	}
+
+	config := DefaultConfig
+	config.HoldScore = DefaultConfig.Weights.FutureDate
+	if risk := newTestAssessor(config, now).Assess("acme", "", future, nil); !risk.Held {
+		t.Errorf("expected a hold at score %d, got %+v", config.HoldScore, risk)
+	}
+
+	config.Weights.FutureDate = 0
+	if risk := newTestAssessor(config, now).Assess("acme", "", future, nil); risk.Score != 0 || risk.Held {
+		t.Errorf("expected a zero weight to disable the heuristic, got %+v", risk)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var member string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		member = MemberFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", nil)
+	req.Header.Set(MemberHeader, "alice")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if member != "alice" {
+		t.Errorf("expected member alice, got %q", member)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/receipts/process", nil))
+	if member != "" {
+		t.Errorf("expected no member, got %q", member)
+	}
+	if MemberFromContext(context.Background()) != "" {
+		t.Error("expected no member in a bare context")
+	}
+}
@@ -0,0 +1,158 @@
+// Package graphqlapi serves receipts, their items and computed points over
+// GraphQL at /graphql. Mutations go through the same pipeline as the REST
+// API, and every query is checked against depth, complexity and mutation
+// limits before it runs.
+package graphqlapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+
+	"github.com/receipt-processor/handlers"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+const maxBodyBytes = 1 << 20
+
+type Handler struct {
+	schema graphql.Schema
+	Limits Limits
+}
+
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+func NewHandler(process *handlers.ProcessHandler, s *store.Store, tenants *tenant.Registry) (*Handler, error) {
+	schema, err := newSchema(resolver{process: process, store: s, tenants: tenants})
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{schema: schema, Limits: DefaultLimits}, nil
+}
+
+// ServeHTTP accepts queries as a JSON POST body or, for queries only, as GET
+// parameters. Requests that cannot be parsed, fail validation or exceed the
+// limits are answered with 400; anything that runs is answered with 200 and
+// any resolver errors in the errors list.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				respondWithErrors(w, http.StatusBadRequest, "invalid_variables", "Variables must be a JSON object.")
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+			respondWithErrors(w, http.StatusBadRequest, "invalid_json", "The request body must be a JSON object with a query.")
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		respondWithErrors(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		respondWithErrors(w, http.StatusBadRequest, "parse_error", err.Error())
+		return
+	}
+
+	validation := graphql.ValidateDocument(&h.schema, doc, nil)
+	if !validation.IsValid {
+		respond(w, http.StatusBadRequest, &graphql.Result{Errors: withCode(validation.Errors, "validation_error")})
+		return
+	}
+
+	op := operation(doc, req.OperationName)
+	if op == nil {
+		respondWithErrors(w, http.StatusBadRequest, "unknown_operation", "The requested operation was not found.")
+		return
+	}
+	if r.Method == http.MethodGet && op.Operation != ast.OperationTypeQuery {
+		w.Header().Set("Allow", "POST")
+		respondWithErrors(w, http.StatusMethodNotAllowed, "method_not_allowed", "Mutations must be sent with POST.")
+		return
+	}
+
+	if err := check(doc, op, req.Variables, h.Limits); err != nil {
+		code := "query_too_deep"
+		switch {
+		case errors.Is(err, ErrQueryTooComplex):
+			code = "query_too_complex"
+		case errors.Is(err, ErrTooManyMutations):
+			code = "too_many_mutations"
+		}
+		slog.InfoContext(r.Context(), "graphql query rejected", "tenant", tenant.FromContext(r.Context()), "code", code)
+		respondWithErrors(w, http.StatusBadRequest, code, err.Error())
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       r.Context(),
+	})
+	respond(w, http.StatusOK, result)
+}
+
+// operation picks the named operation, or the only one when no name is
+// given.
+func operation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op
+		}
+	}
+	return found
+}
+
+func withCode(errs []gqlerrors.FormattedError, code string) []gqlerrors.FormattedError {
+	for i := range errs {
+		if errs[i].Extensions == nil {
+			errs[i].Extensions = map[string]any{"code": code}
+		}
+	}
+	return errs
+}
+
+func respondWithErrors(w http.ResponseWriter, status int, code, message string) {
+	respond(w, status, &graphql.Result{Errors: []gqlerrors.FormattedError{{
+		Message:    message,
+		Extensions: map[string]any{"code": code},
+	}}})
+}
+
+func respond(w http.ResponseWriter, status int, result *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
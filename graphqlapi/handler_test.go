@@ -0,0 +1,603 @@
+package graphqlapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/handlers"
+	"github.com/receipt-processor/jobs"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/processor"
+	"github.com/receipt-processor/retailer"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newTestHandler(t *testing.T, s *store.Store) *Handler {
+	t.Helper()
+	process := handlers.NewProcessHandler(s)
+	h, err := NewHandler(process, s, tenant.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func post(t *testing.T, h http.Handler, query string, variables map[string]any) (int, response) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	var resp response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rr.Body.String(), err)
+	}
+	return rr.Code, resp
+}
+
+func targetReceipt() models.Receipt {
+	return models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []models.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}
+}
+
+func TestQueryReceipt(t *testing.T) {
+	s := store.NewStore()
+	id, _ := s.SaveReceipt(context.Background(), tenant.Default, targetReceipt())
+	h := newTestHandler(t, s)
+
+	status, resp := post(t, h, `query($id: ID!) {
+		receipt(id: $id) { id retailer items { shortDescription price } points breakdown { rule points } }
+	}`, map[string]any{"id": id})
+	if status != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("expected success, got %d %+v", status, resp.Errors)
+	}
+
+	var receipt struct {
+		ID        string
+		Retailer  string
+		Items     []models.Item
+		Points    int
+		Breakdown []struct {
+			Rule   string
+			Points int
+		}
+	}
+	if err := json.Unmarshal(resp.Data["receipt"], &receipt); err != nil {
+		t.Fatal(err)
+	}
+	if receipt.ID != id || receipt.Retailer != "Target" || len(receipt.Items) != 5 {
+		t.Errorf("unexpected receipt %+v", receipt)
+	}
+	if receipt.Points != 28 {
+		t.Errorf("expected 28 points, got %d", receipt.Points)
+	}
+	sum := 0
+	for _, rule := range receipt.Breakdown {
+		sum += rule.Points
+	}
+	if sum != receipt.Points {
+		t.Errorf("expected the breakdown to add up to %d, got %d", receipt.Points, sum)
+	}
+
+	_, resp = post(t, h, `{ receipt(id: "missing") { id } }`, nil)
+	if string(resp.Data["receipt"]) != "null" {
+		t.Errorf("expected null for an unknown receipt, got %s", resp.Data["receipt"])
+	}
+}
+
+func TestQueryReceipts(t *testing.T) {
+	s := store.NewStore()
+	ctx := context.Background()
+	for _, date := range []string{"2022-01-01", "2022-01-02", "2022-01-03"} {
+		receipt := targetReceipt()
+		receipt.PurchaseDate = date
+		s.SaveReceipt(ctx, tenant.Default, receipt)
+	}
+	other := targetReceipt()
+	other.Retailer = "Walgreens"
+	s.SaveReceipt(ctx, tenant.Default, other)
+	s.SaveReceipt(ctx, "acme", targetReceipt())
+	h := newTestHandler(t, s)
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"all", `{ receipts { id purchaseDate } }`, []string{"2022-01-01", "2022-01-01", "2022-01-02", "2022-01-03"}},
+		{"retailer", `{ receipts(retailer: "target") { id purchaseDate } }`, []string{"2022-01-01", "2022-01-02", "2022-01-03"}},
+		{"date range", `{ receipts(from: "2022-01-02", to: "2022-01-02") { id purchaseDate } }`, []string{"2022-01-02"}},
+		{"min points", `{ receipts(minPoints: 23) { id purchaseDate } }`, []string{"2022-01-01", "2022-01-01", "2022-01-03"}},
+	}
+
+	type listed struct{ ID, PurchaseDate string }
+	list := func(t *testing.T, query string) []listed {
+		t.Helper()
+		status, resp := post(t, h, query, nil)
+		if status != http.StatusOK || len(resp.Errors) > 0 {
+			t.Fatalf("expected success, got %d %+v", status, resp.Errors)
+		}
+		var receipts []listed
+		json.Unmarshal(resp.Data["receipts"], &receipts)
+		return receipts
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			receipts := list(t, tc.query)
+			var dates []string
+			for i, receipt := range receipts {
+				if i > 0 && receipt.ID <= receipts[i-1].ID {
+					t.Errorf("expected receipts in ID order, got %+v", receipts)
+				}
+				dates = append(dates, receipt.PurchaseDate)
+			}
+			sort.Strings(dates)
+			if !reflect.DeepEqual(dates, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, dates)
+			}
+		})
+	}
+
+	t.Run("page", func(t *testing.T) {
+		all := list(t, `{ receipts(retailer: "Target") { id purchaseDate } }`)
+		if page := list(t, `{ receipts(retailer: "Target", limit: 1, offset: 1) { id purchaseDate } }`); !reflect.DeepEqual(page, all[1:2]) {
+			t.Errorf("expected offset 1 to return %+v, got %+v", all[1:2], page)
+		}
+		query := fmt.Sprintf(`{ receipts(retailer: "Target", limit: 2, afterId: %q) { id purchaseDate } }`, all[0].ID)
+		if page := list(t, query); !reflect.DeepEqual(page, all[1:3]) {
+			t.Errorf("expected the cursor to return %+v, got %+v", all[1:3], page)
+		}
+	})
+
+	_, resp := post(t, h, `{ receipts(limit: 1000) { id } }`, nil)
+	if len(resp.Errors) == 0 || resp.Errors[0].Extensions["code"] != "invalid_limit" {
+		t.Errorf("expected invalid_limit, got %+v", resp.Errors)
+	}
+}
+
+func TestQueryReceiptsAcrossPages(t *testing.T) {
+	s := store.NewStore()
+	for range maxListLimit + 20 {
+		s.SaveReceipt(context.Background(), tenant.Default, targetReceipt())
+	}
+	h := newTestHandler(t, s)
+
+	_, resp := post(t, h, fmt.Sprintf(`{ receipts(limit: %d, offset: %d) { id } }`, maxListLimit, maxListLimit), nil)
+	var receipts []struct{ ID string }
+	json.Unmarshal(resp.Data["receipts"], &receipts)
+	if len(resp.Errors) > 0 || len(receipts) != 20 {
+		t.Errorf("expected the last 20 receipts from the second store page, got %d %+v", len(receipts), resp.Errors)
+	}
+}
+
+func TestQueryReceiptsAcrossTimeZones(t *testing.T) {
+	s := store.NewStore()
+	h := newTestHandler(t, s)
+
+	// Tokyo's receipt is dated a day later but was printed an hour earlier.
+	for _, receipt := range []struct{ retailer, date, clock, zone string }{
+		{"Lawson", "2022-01-02", "08:00", "Asia/Tokyo"},
+		{"Target", "2022-01-01", "18:00", "America/Chicago"},
+	} {
+		r := targetReceipt()
+		r.Retailer, r.PurchaseDate, r.PurchaseTime, r.TimeZone = receipt.retailer, receipt.date, receipt.clock, receipt.zone
+		status, resp := post(t, h, `mutation($r: ReceiptInput!) { processReceipt(receipt: $r) { id } }`,
+			map[string]any{"r": map[string]any{
+				"retailer": r.Retailer, "purchaseDate": r.PurchaseDate, "purchaseTime": r.PurchaseTime,
+				"timeZone": r.TimeZone, "items": r.Items, "total": r.Total,
+			}})
+		if status != http.StatusOK || len(resp.Errors) > 0 {
+			t.Fatalf("expected success, got %d %+v", status, resp.Errors)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"after", `{ receipts(after: "2022-01-01T23:30:00Z") { retailer purchasedAt } }`,
+			[]string{"Target 2022-01-02T00:00:00Z"}},
+		{"before", `{ receipts(before: "2022-01-02T00:00:00Z") { retailer purchasedAt } }`,
+			[]string{"Lawson 2022-01-01T23:00:00Z"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, resp := post(t, h, tc.query, nil)
+			if status != http.StatusOK || len(resp.Errors) > 0 {
+				t.Fatalf("expected success, got %d %+v", status, resp.Errors)
+			}
+			var receipts []struct{ Retailer, PurchasedAt string }
+			json.Unmarshal(resp.Data["receipts"], &receipts)
+			if len(receipts) != len(tc.expected) {
+				t.Fatalf("expected %v, got %+v", tc.expected, receipts)
+			}
+			for i, expected := range tc.expected {
+				if got := receipts[i].Retailer + " " + receipts[i].PurchasedAt; got != expected {
+					t.Errorf("expected %s at %d, got %s", expected, i, got)
+				}
+			}
+		})
+	}
+
+	_, resp := post(t, h, `{ receipts(after: "yesterday") { id } }`, nil)
+	if len(resp.Errors) == 0 || resp.Errors[0].Extensions["code"] != "invalid_instant" {
+		t.Errorf("expected invalid_instant, got %+v", resp.Errors)
+	}
+}
+
+func TestQueryReceiptsByCanonicalRetailer(t *testing.T) {
+	registry, err := retailer.NewRegistry([]retailer.Retailer{
+		{ID: "target", Name: "Target", Chain: "Target Corporation", Aliases: []string{"Target #*"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := retailer.Default
+	retailer.Default = registry
+	t.Cleanup(func() { retailer.Default = previous })
+
+	s := store.NewStore()
+	ctx := context.Background()
+	for _, name := range []string{"TARGET", "Target #1234", "Walgreens"} {
+		receipt := targetReceipt()
+		receipt.Retailer = name
+		s.SaveReceipt(ctx, tenant.Default, receipt)
+	}
+	h := newTestHandler(t, s)
+
+	status, resp := post(t, h, `{ receipts(retailerId: "target") { retailer canonicalRetailer { id name chain category } } }`, nil)
+	if status != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("expected success, got %d %+v", status, resp.Errors)
+	}
+	var receipts []struct {
+		Retailer          string
+		CanonicalRetailer struct {
+			ID, Name, Chain string
+			Category        *string
+		}
+	}
+	json.Unmarshal(resp.Data["receipts"], &receipts)
+	if len(receipts) != 2 {
+		t.Fatalf("expected both Target receipts, got %+v", receipts)
+	}
+	for _, r := range receipts {
+		c := r.CanonicalRetailer
+		if c.ID != "target" || c.Name != "Target" || c.Chain != "Target Corporation" || c.Category != nil {
+			t.Errorf("unexpected canonical retailer for %q: %+v", r.Retailer, c)
+		}
+	}
+
+	_, resp = post(t, h, `{ receipts(retailer: "Walgreens") { canonicalRetailer { id } } }`, nil)
+	if string(resp.Data["receipts"]) != `[{"canonicalRetailer":null}]` {
+		t.Errorf("expected no canonical retailer for Walgreens, got %s", resp.Data["receipts"])
+	}
+}
+
+func TestProcessReceiptMutation(t *testing.T) {
+	s := store.NewStore()
+	h := newTestHandler(t, s)
+
+	mutation := `mutation($receipt: ReceiptInput!) { processReceipt(receipt: $receipt) { id points } }`
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []map[string]any{{"shortDescription": "Pepsi 12PK", "price": "1.25"}},
+		"total":        "1.25",
+	}
+
+	status, resp := post(t, h, mutation, map[string]any{"receipt": receipt})
+	if status != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("expected success, got %d %+v", status, resp.Errors)
+	}
+	var processed struct {
+		ID     string
+		Points int
+	}
+	json.Unmarshal(resp.Data["processReceipt"], &processed)
+	if _, err := s.GetReceipt(context.Background(), tenant.Default, processed.ID); err != nil {
+		t.Errorf("expected the receipt to be stored: %v", err)
+	}
+
+	receipt["total"] = "1.2"
+	_, resp = post(t, h, mutation, map[string]any{"receipt": receipt})
+	if len(resp.Errors) == 0 || resp.Errors[0].Extensions["code"] != "invalid_total" {
+		t.Errorf("expected invalid_total, got %+v", resp.Errors)
+	}
+}
+
+func TestBreakdownMatchesRecordedPoints(t *testing.T) {
+	s := store.NewStore()
+	tenants := tenant.NewRegistry()
+	h, err := NewHandler(handlers.NewProcessHandler(s), s, tenants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt := targetReceipt()
+	_, resp := post(t, h, `mutation($r: ReceiptInput!) { processReceipt(receipt: $r) { id } }`,
+		map[string]any{"r": map[string]any{
+			"retailer": receipt.Retailer, "purchaseDate": receipt.PurchaseDate, "purchaseTime": receipt.PurchaseTime,
+			"items": receipt.Items, "total": receipt.Total,
+		}})
+	var processed struct{ ID string }
+	if err := json.Unmarshal(resp.Data["processReceipt"], &processed); err != nil || processed.ID == "" {
+		t.Fatalf("expected success, got %+v", resp.Errors)
+	}
+
+	// The rules change after the receipt was scored.
+	rules := processor.DefaultRules
+	rules.RetailerCharPoints = 3
+	tenants.SetDefaultRules(rules)
+
+	_, resp = post(t, h, `query($id: ID!) { receipt(id: $id) { points breakdown { rule points } } }`, map[string]any{"id": processed.ID})
+	var scored struct {
+		Points    int
+		Breakdown []processor.RulePoints
+	}
+	json.Unmarshal(resp.Data["receipt"], &scored)
+	sum := 0
+	for _, rule := range scored.Breakdown {
+		sum += rule.Points
+	}
+	if scored.Points != 28 || sum != scored.Points || scored.Breakdown[0] != (processor.RulePoints{Rule: processor.RuleRetailerName, Points: 6}) {
+		t.Errorf("expected the recorded breakdown of 28 points, got %+v", scored)
+	}
+}
+
+func TestProcessReceiptReconciliation(t *testing.T) {
+	h := newTestHandler(t, store.NewStore())
+
+	mutation := `mutation($receipt: ReceiptInput!) {
+		processReceipt(receipt: $receipt) { reconciliation { balanced expected difference outcome } }
+	}`
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []map[string]any{{"shortDescription": "Pepsi 12PK", "price": "1.25", "quantity": "1"}},
+		"tax":          "0.10",
+		"total":        "1.25",
+	}
+
+	_, resp := post(t, h, mutation, map[string]any{"receipt": receipt})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("expected success, got %+v", resp.Errors)
+	}
+	var processed struct {
+		Reconciliation models.Reconciliation
+	}
+	json.Unmarshal(resp.Data["processReceipt"], &processed)
+	expected := models.Reconciliation{Expected: "1.35", Difference: "-0.10", Outcome: handlers.OutcomeWarned}
+	if processed.Reconciliation != expected {
+		t.Errorf("expected %+v, got %+v", expected, processed.Reconciliation)
+	}
+}
+
+func TestProcessReceiptRisk(t *testing.T) {
+	h := newTestHandler(t, store.NewStore())
+
+	mutation := `mutation($receipt: ReceiptInput!) {
+		processReceipt(receipt: $receipt) { risk { score reasons held } }
+	}`
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []map[string]any{{"shortDescription": "Pepsi 12PK", "price": "3.00"}},
+		"total":        "3.00",
+	}
+
+	_, resp := post(t, h, mutation, map[string]any{"receipt": receipt})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("expected success, got %+v", resp.Errors)
+	}
+	expected := `{"risk":{"held":false,"reasons":["round_total"],"score":10}}`
+	if string(resp.Data["processReceipt"]) != expected {
+		t.Errorf("expected %s, got %s", expected, resp.Data["processReceipt"])
+	}
+}
+
+func TestReceiptLifecycle(t *testing.T) {
+	s := store.NewStore()
+	h := newTestHandler(t, s)
+
+	mutation := `mutation($receipt: ReceiptInput!) {
+		processReceipt(receipt: $receipt) { state history { state } }
+	}`
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []map[string]any{{"shortDescription": "Pepsi 12PK", "price": "1.25"}},
+		"total":        "1.25",
+	}
+
+	_, resp := post(t, h, mutation, map[string]any{"receipt": receipt})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("expected success, got %+v", resp.Errors)
+	}
+	expected := `{"history":[{"state":"received"},{"state":"validated"},{"state":"scored"},{"state":"credited"}],"state":"credited"}`
+	if string(resp.Data["processReceipt"]) != expected {
+		t.Errorf("expected %s, got %s", expected, resp.Data["processReceipt"])
+	}
+
+	id, _ := s.SaveReceipt(context.Background(), tenant.Default, models.Receipt{
+		Retailer: "Walgreens", PurchaseDate: "2022-01-02", PurchaseTime: "08:13", Total: "2.65",
+	})
+	_, resp = post(t, h, `query($id: ID!) { receipt(id: $id) { state history { state at } } }`, map[string]any{"id": id})
+	if string(resp.Data["receipt"]) != `{"history":[],"state":"credited"}` {
+		t.Errorf("expected a legacy receipt to be credited without history, got %s", resp.Data["receipt"])
+	}
+}
+
+func TestPointsByState(t *testing.T) {
+	s := store.NewStore()
+	h := newTestHandler(t, s)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	scored := models.NewLifecycle(now).To(models.StateValidated, now).To(models.StateScored, now)
+	score := &models.Score{Points: 28, Breakdown: []models.RulePoints{{Rule: processor.RuleRetailerName, Points: 28}}}
+
+	testCases := []struct {
+		name     string
+		metadata models.Metadata
+		code     string
+	}{
+		{"credited", models.Metadata{Lifecycle: scored.To(models.StateCredited, now), Score: score}, ""},
+		{"pending", models.Metadata{Lifecycle: models.NewLifecycle(now)}, "pending"},
+		{"rejected", models.Metadata{
+			Lifecycle: models.NewLifecycle(now).To(models.StateRejected, now),
+			Rejection: &models.Rejection{Code: "invalid_total"},
+		}, "invalid_total"},
+		{"held", models.Metadata{Lifecycle: scored.To(models.StateHeld, now), Score: score}, "points_held"},
+		{"voided", models.Metadata{Lifecycle: scored.To(models.StateHeld, now).To(models.StateVoided, now), Score: score}, "points_voided"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := s.SaveRecord(ctx, tenant.Default, targetReceipt(), tc.metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, resp := post(t, h, `query($id: ID!) { receipt(id: $id) { id points breakdown { points } } }`, map[string]any{"id": id})
+			var receipt struct {
+				ID        string
+				Points    *int
+				Breakdown []processor.RulePoints
+			}
+			if err := json.Unmarshal(resp.Data["receipt"], &receipt); err != nil || receipt.ID != id {
+				t.Fatalf("expected the receipt to resolve, got %s", resp.Data["receipt"])
+			}
+			if tc.code == "" {
+				if len(resp.Errors) > 0 || receipt.Points == nil || *receipt.Points != 28 || len(receipt.Breakdown) != 1 {
+					t.Errorf("expected 28 credited points, got %+v %+v", receipt, resp.Errors)
+				}
+				return
+			}
+			if receipt.Points != nil || receipt.Breakdown != nil {
+				t.Errorf("expected null points and breakdown, got %+v", receipt)
+			}
+			if len(resp.Errors) != 2 || resp.Errors[0].Extensions["code"] != tc.code || resp.Errors[1].Extensions["code"] != tc.code {
+				t.Errorf("expected %s errors, got %+v", tc.code, resp.Errors)
+			}
+		})
+	}
+
+	_, resp := post(t, h, `{ receipts(minPoints: 1) { id } }`, nil)
+	var matched []struct{ ID string }
+	json.Unmarshal(resp.Data["receipts"], &matched)
+	if len(matched) != 1 {
+		t.Errorf("expected minPoints to match only the credited receipt, got %s", resp.Data["receipts"])
+	}
+}
+
+func TestProcessReceiptAsync(t *testing.T) {
+	s := store.NewStore()
+	process := handlers.NewProcessHandler(s)
+	process.Queue = jobs.NewQueue(1)
+	h, err := NewHandler(process, s, tenant.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutation := `mutation($receipt: ReceiptInput!) { processReceipt(receipt: $receipt) { state } }`
+	receipt := map[string]any{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []map[string]any{{"shortDescription": "Pepsi 12PK", "price": "1.25"}},
+		"total":        "1.25",
+	}
+	_, resp := post(t, h, mutation, map[string]any{"receipt": receipt})
+	if len(resp.Errors) > 0 || string(resp.Data["processReceipt"]) != `{"state":"received"}` {
+		t.Errorf("expected the receipt to be queued, got %s %+v", resp.Data["processReceipt"], resp.Errors)
+	}
+	if process.Queue.Len() != 1 {
+		t.Errorf("expected one queued receipt, got %d", process.Queue.Len())
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	h := newTestHandler(t, store.NewStore())
+	h.Limits = Limits{MaxDepth: 3, MaxComplexity: 50, MaxMutations: 2}
+	submit := `processReceipt(receipt: {retailer: "A", purchaseDate: "2022-01-01", purchaseTime: "10:00", items: [], total: "1.00"}) { id }`
+
+	testCases := []struct {
+		name   string
+		query  string
+		status int
+		code   string
+	}{
+		{"within limits", `{ receipts(limit: 5) { id items { price } } }`, http.StatusOK, ""},
+		{"too deep", `{ __schema { types { fields { type { name } } } } }`, http.StatusBadRequest, "query_too_deep"},
+		{"too complex", `{ receipts(limit: 30) { id retailer } }`, http.StatusBadRequest, "query_too_complex"},
+		{"fragments count", `{ receipts(limit: 10) { ...r } } fragment r on Receipt { id retailer total points breakdown { rule } }`, http.StatusBadRequest, "query_too_complex"},
+		{"within mutation limit", `mutation { a: ` + submit + ` b: ` + submit + ` }`, http.StatusOK, ""},
+		{"aliased mutations", `mutation { a: ` + submit + ` b: ` + submit + ` c: ` + submit + ` }`, http.StatusBadRequest, "too_many_mutations"},
+		{"mutation fragments count", `mutation { a: ` + submit + ` ...m } fragment m on Mutation { b: ` + submit + ` c: ` + submit + ` }`, http.StatusBadRequest, "too_many_mutations"},
+		{"parse error", `{ receipts {`, http.StatusBadRequest, "parse_error"},
+		{"unknown field", `{ receipts { color } }`, http.StatusBadRequest, "validation_error"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, resp := post(t, h, tc.query, nil)
+			if status != tc.status {
+				t.Fatalf("expected status %d, got %d %+v", tc.status, status, resp.Errors)
+			}
+			if tc.code != "" && (len(resp.Errors) == 0 || resp.Errors[0].Extensions["code"] != tc.code) {
+				t.Errorf("expected code %s, got %+v", tc.code, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestGetRejectsMutations(t *testing.T) {
+	h := newTestHandler(t, store.NewStore())
+
+	query := url.Values{"query": {`{ receipts { id } }`}}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected GET queries to succeed, got %d", rr.Code)
+	}
+
+	mutation := url.Values{"query": {`mutation { processReceipt(receipt: {retailer: "A", purchaseDate: "2022-01-01", purchaseTime: "10:00", items: [], total: "1.00"}) { id } }`}}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/graphql?"+mutation.Encode(), nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET mutations to be rejected, got %d", rr.Code)
+	}
+}
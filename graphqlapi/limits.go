@@ -0,0 +1,161 @@
+package graphqlapi
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound what a single document may ask for. MaxMutations caps the
+// mutation fields, aliases included, in one operation, so a single request
+// cannot submit more receipts than the rate limiter allows.
+type Limits struct {
+	MaxDepth      int `json:"maxDepth"`
+	MaxComplexity int `json:"maxComplexity"`
+	MaxMutations  int `json:"maxMutations"`
+}
+
+// DefaultLimits leave room for the standard introspection query, which
+// nests type references about a dozen levels deep.
+var DefaultLimits = Limits{
+	MaxDepth:      12,
+	MaxComplexity: 1000,
+	MaxMutations:  1,
+}
+
+var (
+	ErrQueryTooDeep     = errors.New("query exceeds the maximum depth")
+	ErrQueryTooComplex  = errors.New("query exceeds the maximum complexity")
+	ErrTooManyMutations = errors.New("operation exceeds the maximum number of mutations")
+)
+
+// analysis walks one operation, expanding fragments, to measure how deeply
+// its fields nest and how many fields it may resolve. Every field costs one;
+// the fields under a list with a limit argument are counted once per
+// requested element.
+type analysis struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// check reports whether op stays within limits. The document must already
+// have passed validation, which rejects fragment cycles.
+func check(doc *ast.Document, op *ast.OperationDefinition, variables map[string]any, limits Limits) error {
+	a := analysis{fragments: make(map[string]*ast.FragmentDefinition), variables: make(map[string]any)}
+	for _, def := range op.VariableDefinitions {
+		if v, ok := def.DefaultValue.(*ast.IntValue); ok {
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				a.variables[def.Variable.Name.Value] = float64(n)
+			}
+		}
+	}
+	for name, value := range variables {
+		a.variables[name] = value
+	}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			a.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	if limits.MaxDepth > 0 && a.depth(op.SelectionSet) > limits.MaxDepth {
+		return ErrQueryTooDeep
+	}
+	if limits.MaxComplexity > 0 && a.complexity(op.SelectionSet) > limits.MaxComplexity {
+		return ErrQueryTooComplex
+	}
+	if op.Operation == ast.OperationTypeMutation && limits.MaxMutations > 0 && a.fields(op.SelectionSet) > limits.MaxMutations {
+		return ErrTooManyMutations
+	}
+	return nil
+}
+
+// fields counts the fields selected at the top of set, through fragments.
+func (a analysis) fields(set *ast.SelectionSet) int {
+	if set == nil {
+		return 0
+	}
+	total := 0
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			total++
+		case *ast.InlineFragment:
+			total += a.fields(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := a.fragments[s.Name.Value]; ok {
+				total += a.fields(fragment.SelectionSet)
+			}
+		}
+	}
+	return total
+}
+
+func (a analysis) depth(set *ast.SelectionSet) int {
+	if set == nil {
+		return 0
+	}
+	deepest := 0
+	for _, selection := range set.Selections {
+		d := 0
+		switch s := selection.(type) {
+		case *ast.Field:
+			d = 1 + a.depth(s.SelectionSet)
+		case *ast.InlineFragment:
+			d = a.depth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := a.fragments[s.Name.Value]; ok {
+				d = a.depth(fragment.SelectionSet)
+			}
+		}
+		deepest = max(deepest, d)
+	}
+	return deepest
+}
+
+func (a analysis) complexity(set *ast.SelectionSet) int {
+	if set == nil {
+		return 0
+	}
+	total := 0
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			total += 1 + a.multiplier(s)*a.complexity(s.SelectionSet)
+		case *ast.InlineFragment:
+			total += a.complexity(s.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := a.fragments[s.Name.Value]; ok {
+				total += a.complexity(fragment.SelectionSet)
+			}
+		}
+	}
+	return total
+}
+
+// multiplier is the number of elements a field's limit argument asks for,
+// or the schema default for the receipts list when none is given. Limits
+// above maxListLimit are rejected when the query runs, so they are capped
+// here rather than allowed to overflow.
+func (a analysis) multiplier(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil && n > 0 {
+				return min(n, maxListLimit)
+			}
+		case *ast.Variable:
+			if n, ok := a.variables[v.Name.Value].(float64); ok && n > 0 {
+				return int(min(n, maxListLimit))
+			}
+		}
+	}
+	if field.Name.Value == "receipts" {
+		return defaultListLimit
+	}
+	return 1
+}
@@ -0,0 +1,563 @@
+package graphqlapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+
+	"github.com/receipt-processor/currency"
+	"github.com/receipt-processor/handlers"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// codedError is a resolver error carrying the same machine-readable code
+// as the REST API, reported under the error's extensions.
+type codedError struct {
+	err  error
+	code string
+}
+
+func (e codedError) Error() string { return e.err.Error() }
+
+func (e codedError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// pointsError reports why a receipt's points cannot be read, with the code
+// GET /receipts/{id}/points answers with, or nil once they are credited.
+func pointsError(record store.Record) error {
+	switch record.State() {
+	case models.StateReceived, models.StateValidated, models.StateScored:
+		return codedError{errors.New("the receipt has not been scored yet"), handlers.StatusPending}
+	case models.StateRejected:
+		return codedError{errors.New("the receipt is invalid"), record.Metadata.Rejection.Code}
+	case models.StateHeld:
+		return codedError{handlers.ErrPointsHeld, handlers.ErrorCode(handlers.ErrPointsHeld)}
+	case models.StateVoided:
+		return codedError{handlers.ErrPointsVoided, handlers.ErrorCode(handlers.ErrPointsVoided)}
+	case models.StateRefunded:
+		return codedError{handlers.ErrPointsRefunded, handlers.ErrorCode(handlers.ErrPointsRefunded)}
+	}
+	return nil
+}
+
+// resolver holds the dependencies shared by the schema's resolve functions.
+type resolver struct {
+	process *handlers.ProcessHandler
+	store   *store.Store
+	tenants *tenant.Registry
+}
+
+func newSchema(r resolver) (graphql.Schema, error) {
+	itemType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: graphql.Fields{
+			"shortDescription": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.Item).ShortDescription, nil
+			}},
+			"price": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.Item).Price, nil
+			}},
+			"quantity": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(models.Item).Quantity), nil
+			}},
+			"unitPrice": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(models.Item).UnitPrice), nil
+			}},
+			"sku": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(models.Item).SKU), nil
+			}},
+			"upc": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(models.Item).UPC), nil
+			}},
+		},
+	})
+
+	discountType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Discount",
+		Fields: graphql.Fields{
+			"description": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.Discount).Description, nil
+			}},
+			"amount": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.Discount).Amount, nil
+			}},
+		},
+	})
+
+	rulePointsType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "RulePoints",
+		Description: "Points awarded by a single scoring rule.",
+		Fields: graphql.Fields{
+			"rule":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"points": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	reconciliationType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Reconciliation",
+		Description: "How the receipt's total compared with its items, discounts, tax and tip.",
+		Fields: graphql.Fields{
+			"balanced": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Reconciliation).Balanced, nil
+			}},
+			"expected": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Reconciliation).Expected, nil
+			}},
+			"difference": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Reconciliation).Difference, nil
+			}},
+			"outcome": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Reconciliation).Outcome, nil
+			}},
+		},
+	})
+
+	canonicalRetailerType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "CanonicalRetailer",
+		Description: "The registry entry a receipt's retailer name matched.",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.CanonicalRetailer).ID, nil
+			}},
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.CanonicalRetailer).Name, nil
+			}},
+			"category": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(*models.CanonicalRetailer).Category), nil
+			}},
+			"chain": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(*models.CanonicalRetailer).Chain), nil
+			}},
+		},
+	})
+
+	riskType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Risk",
+		Description: "The fraud assessment made when a receipt was submitted.",
+		Fields: graphql.Fields{
+			"score": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Risk).Score, nil
+			}},
+			"reasons": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), Resolve: func(p graphql.ResolveParams) (any, error) {
+				if reasons := p.Source.(*models.Risk).Reasons; reasons != nil {
+					return reasons, nil
+				}
+				return []string{}, nil
+			}},
+			"held": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(*models.Risk).Held, nil
+			}},
+		},
+	})
+
+	transitionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Transition",
+		Description: "A lifecycle state a receipt entered and when, as an RFC 3339 UTC instant.",
+		Fields: graphql.Fields{
+			"state": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.Transition).State, nil
+			}},
+			"at": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(models.Transition).At.Format(time.RFC3339Nano), nil
+			}},
+		},
+	})
+
+	receiptType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Receipt",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(store.Record).ID, nil
+			}},
+			"retailer": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(store.Record).Receipt.Retailer, nil
+			}},
+			"canonicalRetailer": &graphql.Field{
+				Type:        canonicalRetailerType,
+				Description: "Null when the retailer name matches no registered retailer.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if r := p.Source.(store.Record).CanonicalRetailer(); r != nil {
+						return r, nil
+					}
+					return nil, nil
+				},
+			},
+			"purchaseDate": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(store.Record).Receipt.PurchaseDate, nil
+			}},
+			"purchaseTime": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(store.Record).Receipt.PurchaseTime, nil
+			}},
+			"timeZone": &graphql.Field{
+				Type:        graphql.String,
+				Description: "IANA name or UTC offset of purchaseDate and purchaseTime; null means UTC.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return optional(p.Source.(store.Record).Receipt.TimeZone), nil
+				},
+			},
+			"purchasedAt": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "The purchase as an RFC 3339 UTC instant.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(store.Record).PurchasedAt().Format(time.RFC3339), nil
+				},
+			},
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(store.Record).Receipt.Total, nil
+			}},
+			"items": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(itemType))), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(store.Record).Receipt.Items, nil
+			}},
+			"subtotal": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(store.Record).Receipt.Subtotal), nil
+			}},
+			"discounts": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(discountType))), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(store.Record).Receipt.Discounts, nil
+			}},
+			"tax": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(store.Record).Receipt.Tax), nil
+			}},
+			"tip": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (any, error) {
+				return optional(p.Source.(store.Record).Receipt.Tip), nil
+			}},
+			"currency": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "ISO 4217 code of the receipt's amounts; USD for receipts submitted without one.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return currency.Code(p.Source.(store.Record).Receipt.Currency), nil
+				},
+			},
+			"reconciliation": &graphql.Field{
+				Type:        reconciliationType,
+				Description: "Null for receipts stored before reconciliation was recorded.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if r := p.Source.(store.Record).Metadata.Reconciliation; r != nil {
+						return r, nil
+					}
+					return nil, nil
+				},
+			},
+			"state": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "Lifecycle state: received, validated, scored, held, credited, voided or refunded.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(store.Record).State(), nil
+				},
+			},
+			"history": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(transitionType))),
+				Description: "Lifecycle transitions, oldest first; empty for receipts stored before they were recorded.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if history := p.Source.(store.Record).History(); history != nil {
+						return history, nil
+					}
+					return []models.Transition{}, nil
+				},
+			},
+			"risk": &graphql.Field{
+				Type:        riskType,
+				Description: "Null for receipts stored before fraud scoring was recorded.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if r := p.Source.(store.Record).Metadata.Risk; r != nil {
+						return r, nil
+					}
+					return nil, nil
+				},
+			},
+			"points": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Null with an error coded as GET /receipts/{id}/points would be, such as pending or points_held, while the receipt's points are not credited.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					record := p.Source.(store.Record)
+					if err := pointsError(record); err != nil {
+						return nil, err
+					}
+					return record.Points(r.tenants.Calculator(tenant.FromContext(p.Context))), nil
+				},
+			},
+			"breakdown": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(rulePointsType)),
+				Description: "Points each scoring rule awarded when points was recorded, so they add up to it; rules that awarded nothing are omitted. Receipts scored before breakdowns were recorded use the tenant's current rules. Null when points is.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					record := p.Source.(store.Record)
+					if err := pointsError(record); err != nil {
+						return nil, err
+					}
+					rules := r.tenants.Rules(tenant.FromContext(p.Context))
+					breakdown, err := record.Breakdown(rules)
+					if errors.Is(err, currency.ErrNoRate) {
+						return nil, codedError{err, "no_exchange_rate"}
+					}
+					if err != nil {
+						return nil, codedError{errors.New("unable to convert the receipt's amounts"), "internal"}
+					}
+					return breakdown, nil
+				},
+			},
+		},
+	})
+
+	itemInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "ItemInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"shortDescription": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"price":            &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"quantity":         &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"unitPrice":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"sku":              &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"upc":              &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+
+	discountInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "DiscountInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"description": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"amount":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	receiptInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "ReceiptInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"retailer":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"purchaseDate": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"purchaseTime": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"timeZone":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"items":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(itemInput)))},
+			"subtotal":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"discounts":    &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(discountInput))},
+			"tax":          &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"tip":          &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"currency":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"total":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"receipt": &graphql.Field{
+				Type:        receiptType,
+				Description: "A receipt by ID, or null when the tenant has no such receipt.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: r.receipt,
+			},
+			"receipts": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(receiptType))),
+				Description: "The tenant's receipts in ID order. Pass the last ID of a page as afterId to fetch the next.",
+				Args: graphql.FieldConfigArgument{
+					"retailer":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Only receipts from this retailer, ignoring case."},
+					"retailerId": &graphql.ArgumentConfig{Type: graphql.ID, Description: "Only receipts from this canonical retailer, whatever name they printed."},
+					"from":       &graphql.ArgumentConfig{Type: graphql.String, Description: "Earliest purchase date, YYYY-MM-DD."},
+					"to":         &graphql.ArgumentConfig{Type: graphql.String, Description: "Latest purchase date, YYYY-MM-DD."},
+					"after":      &graphql.ArgumentConfig{Type: graphql.String, Description: "Only purchases at or after this RFC 3339 instant."},
+					"before":     &graphql.ArgumentConfig{Type: graphql.String, Description: "Only purchases before this RFC 3339 instant."},
+					"minPoints":  &graphql.ArgumentConfig{Type: graphql.Int, Description: "Only credited receipts with at least this many points."},
+					"afterId":    &graphql.ArgumentConfig{Type: graphql.ID, Description: "Only receipts whose ID sorts after this one."},
+					"limit":      &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultListLimit},
+					"offset":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: r.receipts,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"processReceipt": &graphql.Field{
+				Type:        graphql.NewNonNull(receiptType),
+				Description: "Validates and stores a receipt, as POST /receipts/process does. In asynchronous mode it is returned in the received state and scored later.",
+				Args: graphql.FieldConfigArgument{
+					"receipt": &graphql.ArgumentConfig{Type: graphql.NewNonNull(receiptInput)},
+				},
+				Resolve: r.processReceipt,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func (r resolver) receipt(p graphql.ResolveParams) (any, error) {
+	id, _ := p.Args["id"].(string)
+	record, err := r.store.GetRecord(p.Context, tenant.FromContext(p.Context), id)
+	if errors.Is(err, store.ErrReceiptNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r resolver) receipts(p graphql.ResolveParams) (any, error) {
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	if limit < 0 || limit > maxListLimit {
+		return nil, codedError{fmt.Errorf("limit must be between 0 and %d", maxListLimit), "invalid_limit"}
+	}
+	if offset < 0 {
+		return nil, codedError{errors.New("offset must not be negative"), "invalid_offset"}
+	}
+
+	tenantID := tenant.FromContext(p.Context)
+	rules := r.tenants.Rules(tenantID)
+	retailer, _ := p.Args["retailer"].(string)
+	retailerID, _ := p.Args["retailerId"].(string)
+	from, _ := p.Args["from"].(string)
+	to, _ := p.Args["to"].(string)
+	minPoints, filterPoints := p.Args["minPoints"].(int)
+	after, err := instantArg(p.Args, "after")
+	if err != nil {
+		return nil, err
+	}
+	before, err := instantArg(p.Args, "before")
+	if err != nil {
+		return nil, err
+	}
+
+	matches := func(record store.Record) bool {
+		receipt := record.Receipt
+		if retailer != "" && !strings.EqualFold(receipt.Retailer, retailer) {
+			return false
+		}
+		if retailerID != "" {
+			if canonical := record.CanonicalRetailer(); canonical == nil || canonical.ID != retailerID {
+				return false
+			}
+		}
+		if from != "" && receipt.PurchaseDate < from {
+			return false
+		}
+		if to != "" && receipt.PurchaseDate > to {
+			return false
+		}
+		if !after.IsZero() || !before.IsZero() {
+			purchasedAt := record.PurchasedAt()
+			if !after.IsZero() && purchasedAt.Before(after) {
+				return false
+			}
+			if !before.IsZero() && !purchasedAt.Before(before) {
+				return false
+			}
+		}
+		return !filterPoints || pointsError(record) == nil && record.Points(rules) >= minPoints
+	}
+
+	// Read the store a page at a time, in ID order, and stop as soon as
+	// the requested receipts are found rather than sorting them all.
+	cursor, _ := p.Args["afterId"].(string)
+	matched := []store.Record{}
+	for len(matched) < limit {
+		page := r.store.Page(p.Context, tenantID, cursor, maxListLimit)
+		if len(page) == 0 {
+			break
+		}
+		for _, record := range page {
+			if !matches(record) {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+			if len(matched) == limit {
+				break
+			}
+			matched = append(matched, record)
+		}
+		cursor = page[len(page)-1].ID
+	}
+	return matched, nil
+}
+
+func (r resolver) processReceipt(p graphql.ResolveParams) (any, error) {
+	input, _ := p.Args["receipt"].(map[string]any)
+	receipt := models.Receipt{
+		Retailer:     stringField(input, "retailer"),
+		PurchaseDate: stringField(input, "purchaseDate"),
+		PurchaseTime: stringField(input, "purchaseTime"),
+		TimeZone:     stringField(input, "timeZone"),
+		Subtotal:     stringField(input, "subtotal"),
+		Tax:          stringField(input, "tax"),
+		Tip:          stringField(input, "tip"),
+		Currency:     stringField(input, "currency"),
+		Total:        stringField(input, "total"),
+	}
+	items, _ := input["items"].([]any)
+	for _, item := range items {
+		fields, _ := item.(map[string]any)
+		receipt.Items = append(receipt.Items, models.Item{
+			ShortDescription: stringField(fields, "shortDescription"),
+			Price:            stringField(fields, "price"),
+			Quantity:         stringField(fields, "quantity"),
+			UnitPrice:        stringField(fields, "unitPrice"),
+			SKU:              stringField(fields, "sku"),
+			UPC:              stringField(fields, "upc"),
+		})
+	}
+	discounts, _ := input["discounts"].([]any)
+	for _, discount := range discounts {
+		fields, _ := discount.(map[string]any)
+		receipt.Discounts = append(receipt.Discounts, models.Discount{
+			Description: stringField(fields, "description"),
+			Amount:      stringField(fields, "amount"),
+		})
+	}
+
+	record, err := r.process.Accept(p.Context, tenant.FromContext(p.Context), receipt)
+	switch {
+	case err == nil:
+		return record, nil
+	case errors.Is(err, store.ErrQuotaExceeded):
+		return nil, codedError{err, "quota_exceeded"}
+	case errors.Is(err, store.ErrDailyQuota):
+		return nil, codedError{err, "daily_quota_exceeded"}
+	case handlers.IsValidationError(err):
+		return nil, codedError{err, handlers.ErrorCode(err)}
+	default:
+		return nil, codedError{errors.New("unable to save receipt"), "internal"}
+	}
+}
+
+func stringField(fields map[string]any, name string) string {
+	s, _ := fields[name].(string)
+	return s
+}
+
+// instantArg parses an optional RFC 3339 argument; an absent one is the
+// zero time.
+func instantArg(args map[string]any, name string) (time.Time, error) {
+	s, _ := args[name].(string)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, codedError{fmt.Errorf("%s must be an RFC 3339 instant", name), "invalid_instant"}
+	}
+	return t, nil
+}
+
+// optional resolves an unset string field to null.
+func optional(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,145 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/receipt-processor/grpcapi/receiptspb"
+	"github.com/receipt-processor/logging"
+	"github.com/receipt-processor/metrics"
+	"github.com/receipt-processor/tenant"
+)
+
+// RequestIDMetadata carries the request ID, matching the REST header.
+const RequestIDMetadata = "x-request-id"
+
+var requestDuration = metrics.Default.NewHistogram("grpc_request_duration_seconds",
+	"Latency of gRPC calls by method and status code.", metrics.DefaultBuckets, "method", "code")
+
+// methodRoutes maps each method to the REST route whose rate limit it
+// shares.
+var methodRoutes = map[string]string{
+	receiptspb.ReceiptService_ProcessReceipt_FullMethodName: "/receipts/process",
+	receiptspb.ReceiptService_BatchProcess_FullMethodName:   "/receipts/process",
+	receiptspb.ReceiptService_GetPoints_FullMethodName:      "/receipts/{id}/points",
+}
+
+// unaryObserve assigns the call a request ID, propagating a well-formed
+// x-request-id from the caller, then records its latency and writes one
+// access log line, as the HTTP middleware does.
+func unaryObserve(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx = withRequestID(ctx)
+	resp, err := handler(ctx, req)
+	observe(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func streamObserve(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := withRequestID(ss.Context())
+	err := handler(srv, &tenantStream{ServerStream: ss, ctx: ctx})
+	observe(ctx, info.FullMethod, start, err)
+	return err
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := logging.NewRequestID(first(md, RequestIDMetadata))
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadata, id))
+	return logging.NewContext(ctx, id)
+}
+
+func observe(ctx context.Context, method string, start time.Time, err error) {
+	latency := time.Since(start)
+	code := status.Code(err).String()
+	requestDuration.Observe(latency.Seconds(), method, code)
+	slog.InfoContext(ctx, "grpc request",
+		slog.String("method", method),
+		slog.String("code", code),
+		slog.Duration("latency", latency),
+	)
+}
+
+// unaryRateLimit takes a token from the caller's bucket for the method's
+// route before the call runs.
+func (s *Server) unaryRateLimit(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.allow(ctx, info.FullMethod, 1); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamRateLimit(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &limitedStream{ServerStream: ss, server: s, method: info.FullMethod})
+}
+
+// limitedStream charges each received message against the rate limit. A
+// batch costs one token per receipt, so batching does not stretch a
+// client's budget.
+type limitedStream struct {
+	grpc.ServerStream
+	server *Server
+	method string
+}
+
+func (ls *limitedStream) RecvMsg(m any) error {
+	if err := ls.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	n := 1
+	if batch, ok := m.(*receiptspb.BatchProcessRequest); ok {
+		n = max(1, len(batch.GetReceipts()))
+	}
+	return ls.server.allow(ls.Context(), ls.method, n)
+}
+
+// allow takes n tokens from the caller's bucket. Rejections return
+// ResourceExhausted and a retry-after header in seconds.
+func (s *Server) allow(ctx context.Context, method string, n int) error {
+	if s.Limiters == nil {
+		return nil
+	}
+	limiter := s.Limiters.For(methodRoutes[method])
+	if limiter.Limit().Unlimited() {
+		return nil
+	}
+	allowed, _, retryAfter := limiter.AllowN(clientKey(ctx), n)
+	if allowed {
+		return nil
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))))
+	slog.InfoContext(ctx, "grpc call rate limited", "method", method, "tenant", tenant.FromContext(ctx))
+	return status.Error(codes.ResourceExhausted, "rate_limited: Rate limit exceeded.")
+}
+
+// clientKey identifies the caller as ratelimit.ClientKey does, so a client
+// draws on the same bucket over REST and gRPC.
+func clientKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if key := first(md, APIKeyMetadata); key != "" {
+		return "key:" + key
+	}
+	if id := tenant.FromContext(ctx); id != tenant.Default {
+		return "tenant:" + id
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "ip:"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
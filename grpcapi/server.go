@@ -0,0 +1,248 @@
+// Package grpcapi serves the receipt API over gRPC. It shares validation,
+// storage and scoring with the REST handlers so both transports accept and
+// score receipts identically.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/receipt-processor/fraud"
+	"github.com/receipt-processor/grpcapi/receiptspb"
+	"github.com/receipt-processor/handlers"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/ratelimit"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+// Metadata keys carrying tenant credentials and the submitting member,
+// matching the REST headers.
+const (
+	APIKeyMetadata = "x-api-key"
+	TenantMetadata = "x-tenant-id"
+	MemberMetadata = "x-member-id"
+)
+
+type Server struct {
+	receiptspb.UnimplementedReceiptServiceServer
+
+	process *handlers.ProcessHandler
+	store   *store.Store
+	tenants *tenant.Registry
+	// Limiters rate limits calls when set, sharing the REST buckets.
+	Limiters *ratelimit.Limiters
+}
+
+func NewServer(process *handlers.ProcessHandler, s *store.Store, tenants *tenant.Registry) *Server {
+	return &Server{process: process, store: s, tenants: tenants}
+}
+
+// NewGRPCServer returns a gRPC server with the receipt service registered.
+// Every call is logged and timed, resolved to a tenant and rate limited.
+func NewGRPCServer(srv *Server, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unaryObserve, srv.unaryTenant, srv.unaryRateLimit),
+		grpc.ChainStreamInterceptor(streamObserve, srv.streamTenant, srv.streamRateLimit),
+	)
+	g := grpc.NewServer(opts...)
+	receiptspb.RegisterReceiptServiceServer(g, srv)
+	return g
+}
+
+// Shutdown stops g gracefully, letting in-flight calls finish, and cancels
+// whatever remains when ctx expires.
+func Shutdown(ctx context.Context, g *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		g.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		g.Stop()
+	}
+}
+
+func (s *Server) ProcessReceipt(ctx context.Context, req *receiptspb.ProcessReceiptRequest) (*receiptspb.ProcessReceiptResponse, error) {
+	id, err := s.process.Process(ctx, tenant.FromContext(ctx), fromProto(req.GetReceipt()))
+	if err != nil {
+		return nil, processStatus(err)
+	}
+	return &receiptspb.ProcessReceiptResponse{Id: id}, nil
+}
+
+func (s *Server) GetPoints(ctx context.Context, req *receiptspb.GetPointsRequest) (*receiptspb.GetPointsResponse, error) {
+	tenantID := tenant.FromContext(ctx)
+	record, err := s.store.GetRecord(ctx, tenantID, req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "No receipt found for that ID.")
+	}
+	switch record.State() {
+	case models.StateReceived, models.StateValidated, models.StateScored:
+		return nil, status.Error(codes.Unavailable, "pending: The receipt has not been scored yet.")
+	case models.StateRejected:
+		return nil, status.Error(codes.FailedPrecondition, record.Metadata.Rejection.Code+": The receipt is invalid.")
+	case models.StateHeld:
+		return nil, status.Error(codes.FailedPrecondition, "points_held: The receipt's points are held pending review.")
+	case models.StateVoided:
+		return nil, status.Error(codes.FailedPrecondition, "points_voided: The receipt's points were voided on review.")
+	case models.StateRefunded:
+		return nil, status.Error(codes.FailedPrecondition, "points_refunded: The receipt's points were refunded.")
+	}
+	points := record.Points(s.tenants.Calculator(tenantID))
+	return &receiptspb.GetPointsResponse{Points: int64(points)}, nil
+}
+
+func (s *Server) BatchProcess(req *receiptspb.BatchProcessRequest, stream receiptspb.ReceiptService_BatchProcessServer) error {
+	ctx := stream.Context()
+	tenantID := tenant.FromContext(ctx)
+
+	for i, receipt := range req.GetReceipts() {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		result := &receiptspb.BatchProcessResult{Index: int32(i)}
+		id, err := s.process.Process(ctx, tenantID, fromProto(receipt))
+		if err != nil {
+			result.ErrorCode = errorCode(err)
+			result.Error = err.Error()
+		} else {
+			result.Id = id
+		}
+
+		if err := stream.Send(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processStatus maps pipeline errors to the gRPC equivalents of the REST
+// status codes. Validation failures carry the REST error code in their
+// message.
+func processStatus(err error) error {
+	switch {
+	case errors.Is(err, store.ErrQuotaExceeded), errors.Is(err, store.ErrDailyQuota):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case handlers.IsValidationError(err):
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("%s: %v", handlers.ErrorCode(err), err))
+	default:
+		return status.Error(codes.Internal, "Unable to save receipt.")
+	}
+}
+
+// errorCode reports the REST error code for a rejected batch entry, using
+// the quota names the REST API reports as messages.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, store.ErrQuotaExceeded):
+		return "quota_exceeded"
+	case errors.Is(err, store.ErrDailyQuota):
+		return "daily_quota_exceeded"
+	}
+	return handlers.ErrorCode(err)
+}
+
+func (s *Server) resolve(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id, err := s.tenants.ResolveCredentials(clientSubject(ctx), first(md, APIKeyMetadata), first(md, TenantMetadata))
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, "Unknown tenant or API key.")
+	}
+	ctx = tenant.NewContext(ctx, id)
+	if member := first(md, MemberMetadata); member != "" {
+		ctx = fraud.NewMemberContext(ctx, member)
+	}
+	return ctx, nil
+}
+
+func (s *Server) unaryTenant(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.resolve(ctx)
+	if err != nil {
+		slog.InfoContext(ctx, "grpc call rejected", "method", info.FullMethod, "error", err)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamTenant(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.resolve(ss.Context())
+	if err != nil {
+		slog.InfoContext(ctx, "grpc call rejected", "method", info.FullMethod, "error", err)
+		return err
+	}
+	return handler(srv, &tenantStream{ServerStream: ss, ctx: ctx})
+}
+
+// tenantStream overrides the stream context so handlers see the resolved
+// tenant.
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context { return s.ctx }
+
+// clientSubject returns the common name of a verified client certificate
+// presented on the connection, mirroring tenant.ClientSubject.
+func clientSubject(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func fromProto(r *receiptspb.Receipt) models.Receipt {
+	receipt := models.Receipt{
+		Retailer:     r.GetRetailer(),
+		PurchaseDate: r.GetPurchaseDate(),
+		PurchaseTime: r.GetPurchaseTime(),
+		TimeZone:     r.GetTimeZone(),
+		Currency:     r.GetCurrency(),
+		Subtotal:     r.GetSubtotal(),
+		Tax:          r.GetTax(),
+		Tip:          r.GetTip(),
+		Total:        r.GetTotal(),
+	}
+	for _, item := range r.GetItems() {
+		receipt.Items = append(receipt.Items, models.Item{
+			ShortDescription: item.GetShortDescription(),
+			Price:            item.GetPrice(),
+			Quantity:         item.GetQuantity(),
+			UnitPrice:        item.GetUnitPrice(),
+			SKU:              item.GetSku(),
+			UPC:              item.GetUpc(),
+		})
+	}
+	for _, discount := range r.GetDiscounts() {
+		receipt.Discounts = append(receipt.Discounts, models.Discount{
+			Description: discount.GetDescription(),
+			Amount:      discount.GetAmount(),
+		})
+	}
+	return receipt
+}
@@ -0,0 +1,428 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/receipt-processor/grpcapi/receiptspb"
+	"github.com/receipt-processor/handlers"
+	"github.com/receipt-processor/jobs"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/ratelimit"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+func newTestClient(t *testing.T, s *store.Store, tenants *tenant.Registry) receiptspb.ReceiptServiceClient {
+	t.Helper()
+
+	process := handlers.NewProcessHandler(s)
+	process.Tenants = tenants
+	return serve(t, NewServer(process, s, tenants))
+}
+
+// serve runs server over an in-memory listener and returns a client for it.
+func serve(t *testing.T, server *Server) receiptspb.ReceiptServiceClient {
+	t.Helper()
+	srv := NewGRPCServer(server)
+
+	listener := bufconn.Listen(1 << 20)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return receiptspb.NewReceiptServiceClient(conn)
+}
+
+func validReceipt() *receiptspb.Receipt {
+	return &receiptspb.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []*receiptspb.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}
+}
+
+func TestProcessAndGetPoints(t *testing.T) {
+	client := newTestClient(t, store.NewStore(), tenant.NewRegistry())
+	ctx := context.Background()
+
+	processed, err := client.ProcessReceipt(ctx, &receiptspb.ProcessReceiptRequest{Receipt: validReceipt()})
+	if err != nil {
+		t.Fatalf("ProcessReceipt: %v", err)
+	}
+	if processed.GetId() == "" {
+		t.Fatal("expected a receipt ID")
+	}
+
+	points, err := client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: processed.GetId()})
+	if err != nil {
+		t.Fatalf("GetPoints: %v", err)
+	}
+	if points.GetPoints() != 28 {
+		t.Errorf("expected 28 points, got %d", points.GetPoints())
+	}
+}
+
+func TestProcessReceiptInvalid(t *testing.T) {
+	client := newTestClient(t, store.NewStore(), tenant.NewRegistry())
+
+	receipt := validReceipt()
+	receipt.Retailer = "Bad!Retailer"
+	_, err := client.ProcessReceipt(context.Background(), &receiptspb.ProcessReceiptRequest{Receipt: receipt})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if !strings.HasPrefix(status.Convert(err).Message(), "invalid_retailer") {
+		t.Errorf("expected the error code in the message, got %q", status.Convert(err).Message())
+	}
+}
+
+func TestGetPointsNotFound(t *testing.T) {
+	client := newTestClient(t, store.NewStore(), tenant.NewRegistry())
+
+	_, err := client.GetPoints(context.Background(), &receiptspb.GetPointsRequest{Id: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
+
+func TestTenantMetadata(t *testing.T) {
+	tenants := tenant.NewRegistry()
+	tenants.Add(tenant.Tenant{ID: "acme", APIKeys: []string{"acme-key"}})
+	s := store.NewStore()
+	client := newTestClient(t, s, tenants)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), APIKeyMetadata, "acme-key")
+	processed, err := client.ProcessReceipt(ctx, &receiptspb.ProcessReceiptRequest{Receipt: validReceipt()})
+	if err != nil {
+		t.Fatalf("ProcessReceipt: %v", err)
+	}
+	if s.Count("acme") != 1 {
+		t.Errorf("expected the receipt to be stored for acme")
+	}
+
+	_, err = client.GetPoints(context.Background(), &receiptspb.GetPointsRequest{Id: processed.GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected other tenants not to see the receipt, got %v", err)
+	}
+
+	badCtx := metadata.AppendToOutgoingContext(context.Background(), APIKeyMetadata, "wrong")
+	_, err = client.ProcessReceipt(badCtx, &receiptspb.ProcessReceiptRequest{Receipt: validReceipt()})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+
+	headerCtx := metadata.AppendToOutgoingContext(context.Background(), TenantMetadata, "acme")
+	_, err = client.GetPoints(headerCtx, &receiptspb.GetPointsRequest{Id: processed.GetId()})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected the tenant ID alone not to select a tenant with keys, got %v", err)
+	}
+}
+
+func TestProcessReceiptQuota(t *testing.T) {
+	s := store.NewStore()
+	s.SetQuota(tenant.Default, 1)
+	client := newTestClient(t, s, tenant.NewRegistry())
+	ctx := context.Background()
+
+	if _, err := client.ProcessReceipt(ctx, &receiptspb.ProcessReceiptRequest{Receipt: validReceipt()}); err != nil {
+		t.Fatalf("ProcessReceipt: %v", err)
+	}
+	_, err := client.ProcessReceipt(ctx, &receiptspb.ProcessReceiptRequest{Receipt: validReceipt()})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+}
+
+func TestBatchProcess(t *testing.T) {
+	client := newTestClient(t, store.NewStore(), tenant.NewRegistry())
+
+	invalid := validReceipt()
+	invalid.Total = "35"
+	stream, err := client.BatchProcess(context.Background(), &receiptspb.BatchProcessRequest{
+		Receipts: []*receiptspb.Receipt{validReceipt(), invalid, validReceipt()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []*receiptspb.BatchProcessResult
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if int(result.GetIndex()) != i {
+			t.Errorf("result %d has index %d", i, result.GetIndex())
+		}
+	}
+	if results[0].GetId() == "" || results[2].GetId() == "" {
+		t.Error("expected valid receipts to be processed")
+	}
+	if results[1].GetId() != "" || results[1].GetErrorCode() != "invalid_total" {
+		t.Errorf("expected invalid_total for the second receipt, got %+v", results[1])
+	}
+}
+
+func TestProcessReceiptFields(t *testing.T) {
+	testCases := []struct {
+		name     string
+		modify   func(r *receiptspb.Receipt)
+		expected func(r *models.Receipt)
+	}{
+		{"time zone",
+			func(r *receiptspb.Receipt) { r.TimeZone = "America/New_York" },
+			func(r *models.Receipt) { r.TimeZone = "America/New_York" }},
+		{"currency",
+			func(r *receiptspb.Receipt) { r.Currency = "USD" },
+			func(r *models.Receipt) { r.Currency = "USD" }},
+		{"subtotal",
+			func(r *receiptspb.Receipt) { r.Subtotal = "35.35" },
+			func(r *models.Receipt) { r.Subtotal = "35.35" }},
+		{"discounts",
+			func(r *receiptspb.Receipt) {
+				r.Discounts = []*receiptspb.Discount{{Description: "Coupon", Amount: "1.00"}}
+				r.Total = "34.35"
+			},
+			func(r *models.Receipt) {
+				r.Discounts = []models.Discount{{Description: "Coupon", Amount: "1.00"}}
+				r.Total = "34.35"
+			}},
+		{"tax",
+			func(r *receiptspb.Receipt) { r.Tax, r.Total = "1.00", "36.35" },
+			func(r *models.Receipt) { r.Tax, r.Total = "1.00", "36.35" }},
+		{"tip",
+			func(r *receiptspb.Receipt) { r.Tip, r.Total = "2.00", "37.35" },
+			func(r *models.Receipt) { r.Tip, r.Total = "2.00", "37.35" }},
+		{"quantity and unit price",
+			func(r *receiptspb.Receipt) { r.Items[2].Quantity, r.Items[2].UnitPrice = "2", "0.63" },
+			func(r *models.Receipt) { r.Items[2].Quantity, r.Items[2].UnitPrice = "2", "0.63" }},
+		{"sku",
+			func(r *receiptspb.Receipt) { r.Items[0].Sku = "PEP-12" },
+			func(r *models.Receipt) { r.Items[0].SKU = "PEP-12" }},
+		{"upc",
+			func(r *receiptspb.Receipt) { r.Items[0].Upc = "012000001291" },
+			func(r *models.Receipt) { r.Items[0].UPC = "012000001291" }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := store.NewStore()
+			client := newTestClient(t, s, tenant.NewRegistry())
+
+			receipt := validReceipt()
+			tc.modify(receipt)
+			processed, err := client.ProcessReceipt(context.Background(), &receiptspb.ProcessReceiptRequest{Receipt: receipt})
+			if err != nil {
+				t.Fatalf("ProcessReceipt: %v", err)
+			}
+
+			expected := fromProto(validReceipt())
+			tc.expected(&expected)
+			stored, err := s.GetReceipt(context.Background(), tenant.Default, processed.GetId())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(stored, expected) {
+				t.Errorf("expected %+v, got %+v", expected, stored)
+			}
+		})
+	}
+}
+
+func TestProcessReceiptFieldsValidated(t *testing.T) {
+	client := newTestClient(t, store.NewStore(), tenant.NewRegistry())
+
+	testCases := map[string]func(r *receiptspb.Receipt){
+		"invalid_time_zone": func(r *receiptspb.Receipt) { r.TimeZone = "Mars/Olympus_Mons" },
+		"invalid_currency":  func(r *receiptspb.Receipt) { r.Currency = "usd" },
+		"invalid_upc":       func(r *receiptspb.Receipt) { r.Items[0].Upc = "12345" },
+		"invalid_tax":       func(r *receiptspb.Receipt) { r.Tax = "lots" },
+	}
+	for code, modify := range testCases {
+		receipt := validReceipt()
+		modify(receipt)
+		_, err := client.ProcessReceipt(context.Background(), &receiptspb.ProcessReceiptRequest{Receipt: receipt})
+		if status.Code(err) != codes.InvalidArgument || !strings.HasPrefix(status.Convert(err).Message(), code) {
+			t.Errorf("expected InvalidArgument %s, got %v", code, err)
+		}
+	}
+}
+
+func TestProcessAsync(t *testing.T) {
+	s := store.NewStore()
+	tenants := tenant.NewRegistry()
+	process := handlers.NewProcessHandler(s)
+	process.Tenants = tenants
+	process.Queue = jobs.NewQueue(10)
+	client := serve(t, NewServer(process, s, tenants))
+	ctx := context.Background()
+
+	processed, err := client.ProcessReceipt(ctx, &receiptspb.ProcessReceiptRequest{Receipt: validReceipt()})
+	if err != nil {
+		t.Fatalf("ProcessReceipt: %v", err)
+	}
+	_, err = client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: processed.GetId()})
+	if status.Code(err) != codes.Unavailable || !strings.HasPrefix(status.Convert(err).Message(), "pending") {
+		t.Errorf("expected points to be pending, got %v", err)
+	}
+
+	invalid := validReceipt()
+	invalid.Total = "35.3"
+	stream, err := client.BatchProcess(ctx, &receiptspb.BatchProcessRequest{Receipts: []*receiptspb.Receipt{validReceipt(), invalid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.GetId() == "" || result.GetErrorCode() != "" {
+			t.Errorf("expected receipt %d to be queued, got %+v", result.GetIndex(), result)
+		}
+		ids = append(ids, result.GetId())
+	}
+	if process.Queue.Len() != 3 || len(ids) != 2 {
+		t.Fatalf("expected three queued receipts, got %d", process.Queue.Len())
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go process.Queue.Run(runCtx, 1, func(ctx context.Context, job jobs.Job) { process.ProcessJob(ctx, job) })
+	for id, state := range map[string]string{processed.GetId(): models.StateCredited, ids[1]: models.StateRejected} {
+		deadline := time.Now().Add(time.Second)
+		for record, _ := s.GetRecord(ctx, tenant.Default, id); record.State() != state; record, _ = s.GetRecord(ctx, tenant.Default, id) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to reach %s, got %s", id, state, record.State())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if points, err := client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: processed.GetId()}); err != nil || points.GetPoints() != 28 {
+		t.Errorf("expected 28 points once processed, got %v %v", points, err)
+	}
+	_, err = client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: ids[1]})
+	if status.Code(err) != codes.FailedPrecondition || !strings.HasPrefix(status.Convert(err).Message(), "invalid_total") {
+		t.Errorf("expected the worker's rejection, got %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := store.NewStore()
+	tenants := tenant.NewRegistry()
+	process := handlers.NewProcessHandler(s)
+	process.Tenants = tenants
+	server := NewServer(process, s, tenants)
+	server.Limiters = ratelimit.NewLimiters(ratelimit.Config{
+		Routes: map[string]ratelimit.Limit{"/receipts/process": {Rate: 0.001, Burst: 3}},
+	})
+	client := serve(t, server)
+	ctx := context.Background()
+
+	processed, err := client.ProcessReceipt(ctx, &receiptspb.ProcessReceiptRequest{Receipt: validReceipt()})
+	if err != nil {
+		t.Fatalf("ProcessReceipt: %v", err)
+	}
+	batch := func(n int) error {
+		req := &receiptspb.BatchProcessRequest{}
+		for range n {
+			req.Receipts = append(req.Receipts, validReceipt())
+		}
+		stream, err := client.BatchProcess(ctx, req)
+		if err != nil {
+			return err
+		}
+		for {
+			if _, err := stream.Recv(); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	if err := batch(3); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected a batch above the remaining tokens to be rejected, got %v", err)
+	}
+	if err := batch(2); err != nil {
+		t.Errorf("expected a batch within the remaining tokens, got %v", err)
+	}
+
+	var header metadata.MD
+	_, err = client.ProcessReceipt(ctx, &receiptspb.ProcessReceiptRequest{Receipt: validReceipt()}, grpc.Header(&header))
+	if status.Code(err) != codes.ResourceExhausted || !strings.HasPrefix(status.Convert(err).Message(), "rate_limited") {
+		t.Errorf("expected ResourceExhausted rate_limited, got %v", err)
+	}
+	if first(header, "retry-after") == "" {
+		t.Errorf("expected a retry-after header, got %v", header)
+	}
+
+	// Other methods fall back to the default limit, unlimited here.
+	for range 5 {
+		if _, err := client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: processed.GetId()}); err != nil {
+			t.Fatalf("GetPoints: %v", err)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	client := newTestClient(t, store.NewStore(), tenant.NewRegistry())
+	method := receiptspb.ReceiptService_GetPoints_FullMethodName
+	before := requestDuration.Count(method, codes.NotFound.String())
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDMetadata, "req-123")
+	_, err := client.GetPoints(ctx, &receiptspb.GetPointsRequest{Id: "missing"}, grpc.Header(&header))
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	if id := first(header, RequestIDMetadata); id != "req-123" {
+		t.Errorf("expected the request ID to be echoed, got %q", id)
+	}
+	if after := requestDuration.Count(method, codes.NotFound.String()); after != before+1 {
+		t.Errorf("expected one observed call, got %d", after-before)
+	}
+}
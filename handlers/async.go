@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/receipt-processor/fraud"
+	"github.com/receipt-processor/jobs"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+// StatusPending is reported for receipts accepted for asynchronous
+// processing that have not been scored yet.
+const StatusPending = "pending"
+
+// Enqueue stores a normalized receipt in the received state and queues it
+// for a worker, which runs it through the same pipeline as Submit. When
+// the queue is full the receipt is processed before Enqueue returns, so a
+// backlog slows submitters down rather than failing them.
+func (h *ProcessHandler) Enqueue(ctx context.Context, tenantID string, receipt models.Receipt) (store.Record, error) {
+	receipt = Normalize(receipt)
+	member := fraud.MemberFromContext(ctx)
+	metadata := models.Metadata{Lifecycle: models.NewLifecycle(time.Now().UTC()), Member: member}
+	id, err := h.store.SaveRecord(ctx, tenantID, receipt, metadata)
+	if err != nil {
+		logSaveError(ctx, tenantID, err)
+		return store.Record{}, err
+	}
+
+	job := jobs.Job{Tenant: tenantID, ReceiptID: id, Member: member}
+	if !h.Queue.TryEnqueue(job) {
+		slog.WarnContext(ctx, "processing queue full, processing inline", "tenant", tenantID, "receipt_id", id)
+		return h.ProcessJob(ctx, job)
+	}
+	slog.DebugContext(ctx, "receipt queued", "tenant", tenantID, "receipt_id", id)
+	return store.Record{ID: id, Receipt: receipt, Metadata: metadata}, nil
+}
+
+// ProcessJob validates, scores and settles a queued receipt, moving its
+// stored lifecycle on from received. A receipt that fails validation is
+// moved to rejected with the error recorded. Receipts no longer in the
+// received state are left alone.
+func (h *ProcessHandler) ProcessJob(ctx context.Context, job jobs.Job) (store.Record, error) {
+	ctx = tenant.NewContext(ctx, job.Tenant)
+	if job.Member != "" {
+		ctx = fraud.NewMemberContext(ctx, job.Member)
+	}
+	record, err := h.store.GetRecord(ctx, job.Tenant, job.ReceiptID)
+	if err != nil || record.State() != models.StateReceived {
+		return record, err
+	}
+
+	metadata, points, err := h.evaluate(ctx, job.Tenant, record.Receipt, record.Metadata.Lifecycle)
+	if err != nil {
+		h.reject(ctx, job.Tenant, err)
+		rejection := &models.Rejection{Code: ErrorCode(err), Message: err.Error()}
+		if _, updateErr := h.store.UpdateMetadata(ctx, job.Tenant, job.ReceiptID, func(m *models.Metadata) error {
+			m.Rejection = rejection
+			m.Lifecycle = m.Lifecycle.To(models.StateRejected, time.Now().UTC())
+			return nil
+		}); updateErr != nil {
+			slog.ErrorContext(ctx, "recording rejection failed", "tenant", job.Tenant, "receipt_id", job.ReceiptID, "error", updateErr)
+		}
+		return store.Record{}, err
+	}
+
+	record, err = h.store.UpdateMetadata(ctx, job.Tenant, job.ReceiptID, func(m *models.Metadata) error {
+		*m = metadata
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "saving processed receipt failed", "tenant", job.Tenant, "receipt_id", job.ReceiptID, "error", err)
+		return store.Record{}, err
+	}
+	h.settle(ctx, job.Tenant, record, points)
+	return record, nil
+}
+
+// Resume queues every stored receipt still in the received state, such as
+// those accepted before a restart, for the member who submitted it,
+// waiting for room in the queue until ctx is cancelled.
+func (h *ProcessHandler) Resume(ctx context.Context) error {
+	resumed := 0
+	for _, tenantID := range h.store.Tenants() {
+		for _, record := range h.store.List(ctx, tenantID) {
+			if record.State() != models.StateReceived {
+				continue
+			}
+			if err := h.Queue.Enqueue(ctx, jobs.Job{Tenant: tenantID, ReceiptID: record.ID, Member: record.Metadata.Member}); err != nil {
+				return err
+			}
+			resumed++
+		}
+	}
+	if resumed > 0 {
+		slog.InfoContext(ctx, "pending receipts queued", "count", resumed)
+	}
+	return nil
+}
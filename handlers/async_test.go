@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/fraud"
+	"github.com/receipt-processor/jobs"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+func TestProcessHandlerAsync(t *testing.T) {
+	valid := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`
+	invalid := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.2"}`
+
+	s := store.NewStore()
+	handler := NewProcessHandler(s)
+	handler.Queue = jobs.NewQueue(1)
+	points := NewPointsHandler(s, nil)
+
+	submit := func(body string) (int, map[string]any) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(body)))
+		var response map[string]any
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+	getPoints := func(id string) (int, map[string]any) {
+		ctx := context.WithValue(context.Background(), "receipt_id", id)
+		rr := httptest.NewRecorder()
+		points.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		var response map[string]any
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+
+	status, queued := submit(valid)
+	if status != http.StatusAccepted || queued["status"] != StatusPending {
+		t.Fatalf("expected 202 pending, got %d %v", status, queued)
+	}
+	id := queued["id"].(string)
+	if status, response := getPoints(id); status != http.StatusAccepted || response["status"] != StatusPending {
+		t.Errorf("expected points to be pending, got %d %v", status, response)
+	}
+
+	// The queue holds one job, so the next receipt is processed inline.
+	status, inline := submit(valid)
+	if status != http.StatusOK || inline["status"] != nil {
+		t.Errorf("expected a full queue to process inline, got %d %v", status, inline)
+	}
+	if status, _ := getPoints(inline["id"].(string)); status != http.StatusOK {
+		t.Errorf("expected inline points, got %d", status)
+	}
+	if status, response := submit(invalid); status != http.StatusBadRequest || response["code"] != "invalid_total" {
+		t.Errorf("expected an inline rejection, got %d %v", status, response)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handler.Queue.Run(ctx, 2, func(ctx context.Context, job jobs.Job) { handler.ProcessJob(ctx, job) })
+
+	waitFor := func(id, state string) store.Record {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			record, _ := s.GetRecord(context.Background(), tenant.Default, id)
+			if record.State() == state {
+				return record
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to reach %s, got %s", id, state, record.State())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	record := waitFor(id, models.StateCredited)
+	var states []string
+	for _, transition := range record.History() {
+		states = append(states, transition.State)
+	}
+	if strings.Join(states, ",") != "received,validated,scored,credited" {
+		t.Errorf("unexpected lifecycle %v", states)
+	}
+	if status, response := getPoints(id); status != http.StatusOK || response["points"] == nil {
+		t.Errorf("expected points once scored, got %d %v", status, response)
+	}
+
+	_, queued = submit(invalid)
+	rejected := waitFor(queued["id"].(string), models.StateRejected)
+	if rejected.Metadata.Rejection == nil || rejected.Metadata.Rejection.Code != "invalid_total" {
+		t.Errorf("expected the rejection to be recorded, got %+v", rejected.Metadata.Rejection)
+	}
+	if status, response := getPoints(rejected.ID); status != http.StatusUnprocessableEntity || response["code"] != "invalid_total" {
+		t.Errorf("expected 422 invalid_total, got %d %v", status, response)
+	}
+}
+
+func TestProcessHandlerResume(t *testing.T) {
+	s := store.NewStore()
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.25"}},
+		Total:        "1.25",
+	}
+	pending, _ := s.SaveRecord(context.Background(), "acme", receipt, models.Metadata{Lifecycle: models.NewLifecycle(time.Now())})
+	s.SaveReceipt(context.Background(), "acme", receipt)
+
+	handler := NewProcessHandler(s)
+	handler.Queue = jobs.NewQueue(10)
+	if err := handler.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if handler.Queue.Len() != 1 {
+		t.Fatalf("expected only the received receipt to be queued, got %d", handler.Queue.Len())
+	}
+
+	record, err := handler.ProcessJob(context.Background(), jobs.Job{Tenant: "acme", ReceiptID: pending})
+	if err != nil || record.State() != models.StateCredited {
+		t.Errorf("expected the receipt to be credited, got %s %v", record.State(), err)
+	}
+	if again, _ := handler.ProcessJob(context.Background(), jobs.Job{Tenant: "acme", ReceiptID: pending}); len(again.History()) != len(record.History()) {
+		t.Errorf("expected a processed receipt to be left alone, got %+v", again.History())
+	}
+}
+
+func TestProcessHandlerResumeKeepsMember(t *testing.T) {
+	s := store.NewStore()
+	body := `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+		`"items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`
+	config := fraud.DefaultConfig
+	config.VelocityLimit = 1
+
+	// Accept two receipts from alice, then restart before they are processed.
+	accepting := NewProcessHandler(s)
+	accepting.Queue = jobs.NewQueue(10)
+	var ids []string
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(body))
+		req = req.WithContext(fraud.NewMemberContext(req.Context(), "alice"))
+		rr := httptest.NewRecorder()
+		accepting.ServeHTTP(rr, req)
+		var response map[string]any
+		json.NewDecoder(rr.Body).Decode(&response)
+		ids = append(ids, response["id"].(string))
+	}
+
+	handler := NewProcessHandler(s)
+	handler.Fraud = fraud.NewAssessor(config)
+	handler.Queue = jobs.NewQueue(10)
+	if err := handler.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var members []string
+	handler.Queue.Run(ctx, 1, func(ctx context.Context, job jobs.Job) {
+		members = append(members, job.Member)
+		handler.ProcessJob(ctx, job)
+		if handler.Queue.Len() == 0 {
+			cancel()
+		}
+	})
+
+	if len(members) != 2 || members[0] != "alice" || members[1] != "alice" {
+		t.Fatalf("expected both jobs to resume for alice, got %q", members)
+	}
+	records := make(map[string]store.Record)
+	for _, id := range ids {
+		records[id], _ = s.GetRecord(context.Background(), tenant.Default, id)
+	}
+	velocity := 0
+	for _, record := range records {
+		if record.Metadata.Member != "alice" || record.Metadata.Risk == nil {
+			t.Fatalf("expected a risk assessment for alice, got %+v", record.Metadata)
+		}
+		if slices.Contains(record.Metadata.Risk.Reasons, fraud.ReasonVelocity) {
+			velocity++
+		}
+	}
+	if velocity != 1 {
+		t.Errorf("expected the second resumed receipt to exceed alice's velocity limit, got %d flagged", velocity)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/receipt-processor/currency"
+	"github.com/receipt-processor/models"
+)
+
+var (
+	ErrInvalidQuantity   = errors.New("invalid item quantity")
+	ErrInvalidUnitPrice  = errors.New("invalid item unit price format")
+	ErrInvalidSKU        = errors.New("invalid item SKU")
+	ErrInvalidUPC        = errors.New("invalid item UPC")
+	ErrInvalidSubtotal   = errors.New("invalid subtotal amount format")
+	ErrInvalidDiscount   = errors.New("invalid discount")
+	ErrInvalidTax        = errors.New("invalid tax amount format")
+	ErrInvalidTip        = errors.New("invalid tip amount format")
+	ErrItemPriceMismatch = errors.New("item price does not equal quantity times unit price")
+	ErrSubtotalMismatch  = errors.New("subtotal does not equal the sum of item prices")
+)
+
+var (
+	quantityPattern = regexp.MustCompile(`^\d{1,6}(\.\d{1,3})?$`)
+	skuPattern      = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+	upcPattern      = regexp.MustCompile(`^(\d{8}|\d{12,14})$`)
+)
+
+// validateComponents checks the optional item and receipt components and
+// that the subtotal matches the items. Whether the total adds up is left to
+// reconciliation. A receipt without any components is left alone, so plain
+// {shortDescription, price} payloads validate as before. Amounts use the
+// receipt currency's minor units.
+func validateComponents(receipt models.Receipt, digits int) error {
+	var itemsMinor int64
+	for _, item := range receipt.Items {
+		if err := validateItemComponents(item, digits); err != nil {
+			return err
+		}
+		price, _ := currency.ParseSignedAmount(item.Price, digits)
+		itemsMinor += price
+	}
+
+	if receipt.Subtotal != "" {
+		subtotal, err := currency.ParseAmount(receipt.Subtotal, digits)
+		if err != nil {
+			return ErrInvalidSubtotal
+		}
+		if subtotal != itemsMinor {
+			return ErrSubtotalMismatch
+		}
+	}
+
+	for _, discount := range receipt.Discounts {
+		if _, err := currency.ParseAmount(discount.Amount, digits); err != nil || strings.TrimSpace(discount.Description) == "" {
+			return ErrInvalidDiscount
+		}
+	}
+	if receipt.Tax != "" {
+		if _, err := currency.ParseAmount(receipt.Tax, digits); err != nil {
+			return ErrInvalidTax
+		}
+	}
+	if receipt.Tip != "" {
+		if _, err := currency.ParseAmount(receipt.Tip, digits); err != nil {
+			return ErrInvalidTip
+		}
+	}
+	return nil
+}
+
+// expectedTotal adds up what a validated receipt's total should be: the
+// item prices less discounts plus tax and tip, in minor units.
+func expectedTotal(receipt models.Receipt, digits int) int64 {
+	var minor int64
+	for _, item := range receipt.Items {
+		price, _ := currency.ParseSignedAmount(item.Price, digits)
+		minor += price
+	}
+	for _, discount := range receipt.Discounts {
+		amount, _ := currency.ParseAmount(discount.Amount, digits)
+		minor -= amount
+	}
+	for _, amount := range []string{receipt.Tax, receipt.Tip} {
+		if amount != "" {
+			extra, _ := currency.ParseAmount(amount, digits)
+			minor += extra
+		}
+	}
+	return minor
+}
+
+// validateItemComponents checks an item's optional fields. A unit price
+// without a quantity is taken as a quantity of one.
+func validateItemComponents(item models.Item, digits int) error {
+	if item.SKU != "" && !skuPattern.MatchString(item.SKU) {
+		return ErrInvalidSKU
+	}
+	if item.UPC != "" && !upcPattern.MatchString(item.UPC) {
+		return ErrInvalidUPC
+	}
+
+	thousandths := int64(1000)
+	if item.Quantity != "" {
+		var err error
+		thousandths, err = parseQuantity(item.Quantity)
+		if err != nil {
+			return ErrInvalidQuantity
+		}
+	}
+	if item.UnitPrice == "" {
+		return nil
+	}
+
+	unitPrice, err := currency.ParseAmount(item.UnitPrice, digits)
+	if err != nil {
+		return ErrInvalidUnitPrice
+	}
+	price, _ := currency.ParseSignedAmount(item.Price, digits)
+	// Round half up to the minor unit, as registers do.
+	if (thousandths*unitPrice+500)/1000 != price {
+		return ErrItemPriceMismatch
+	}
+	return nil
+}
+
+// parseQuantity converts a positive decimal quantity to thousandths.
+func parseQuantity(quantity string) (int64, error) {
+	if !quantityPattern.MatchString(quantity) {
+		return 0, errors.New("invalid quantity")
+	}
+	whole, fraction, _ := strings.Cut(quantity, ".")
+	fraction += strings.Repeat("0", 3-len(fraction))
+	w, _ := strconv.ParseInt(whole, 10, 64)
+	f, _ := strconv.ParseInt(fraction, 10, 64)
+	if w*1000+f == 0 {
+		return 0, errors.New("quantity must be positive")
+	}
+	return w*1000 + f, nil
+}
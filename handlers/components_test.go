@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/receipt-processor/models"
+)
+
+func TestValidateComponents(t *testing.T) {
+	base := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []models.Item{
+			{ShortDescription: "Pepsi 12PK", Price: "5.97", Quantity: "3", UnitPrice: "1.99", SKU: "PEP-12", UPC: "012000001291"},
+			{ShortDescription: "Bananas", Price: "0.76", Quantity: "1.265", UnitPrice: "0.60"},
+		},
+		Subtotal:  "6.73",
+		Discounts: []models.Discount{{Description: "Coupon", Amount: "1.00"}},
+		Tax:       "0.46",
+		Tip:       "1.00",
+		Total:     "7.19",
+	}
+
+	testCases := []struct {
+		name     string
+		modify   func(r *models.Receipt)
+		expected error
+	}{
+		{"reconciled components", func(r *models.Receipt) {}, nil},
+		{"plain receipt", func(r *models.Receipt) {
+			*r = models.Receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+				Items: []models.Item{{ShortDescription: "Pepsi", Price: "1.25"}}, Total: "9.00"}
+		}, nil},
+		{"unit price without quantity", func(r *models.Receipt) {
+			r.Items[0].Quantity = ""
+		}, ErrItemPriceMismatch},
+		{"wrong line price", func(r *models.Receipt) { r.Items[0].Price = "5.98" }, ErrItemPriceMismatch},
+		{"zero quantity", func(r *models.Receipt) { r.Items[0].Quantity = "0" }, ErrInvalidQuantity},
+		{"negative quantity", func(r *models.Receipt) { r.Items[0].Quantity = "-3" }, ErrInvalidQuantity},
+		{"bad unit price", func(r *models.Receipt) { r.Items[0].UnitPrice = "1.9" }, ErrInvalidUnitPrice},
+		{"bad sku", func(r *models.Receipt) { r.Items[0].SKU = "PEP 12" }, ErrInvalidSKU},
+		{"bad upc", func(r *models.Receipt) { r.Items[0].UPC = "12345" }, ErrInvalidUPC},
+		{"subtotal mismatch", func(r *models.Receipt) { r.Subtotal = "6.74" }, ErrSubtotalMismatch},
+		{"bad subtotal", func(r *models.Receipt) { r.Subtotal = "6.7" }, ErrInvalidSubtotal},
+		{"negative tax", func(r *models.Receipt) { r.Tax = "-0.46" }, ErrInvalidTax},
+		{"bad tip", func(r *models.Receipt) { r.Tip = "1" }, ErrInvalidTip},
+		{"discount without description", func(r *models.Receipt) { r.Discounts[0].Description = " " }, ErrInvalidDiscount},
+		{"components without subtotal", func(r *models.Receipt) { r.Subtotal = "" }, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			receipt := base
+			receipt.Items = append([]models.Item(nil), base.Items...)
+			receipt.Discounts = append([]models.Discount(nil), base.Discounts...)
+			tc.modify(&receipt)
+
+			if err := validateReceipt(receipt, DefaultLimits); !errors.Is(err, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
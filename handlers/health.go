@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/receipt-processor/store"
+)
+
+// WithProbes serves /healthz and /readyz ahead of next, so probes skip
+// the tenant and rate-limit middleware next applies: a probe is never
+// refused for its headers and never spends a client's rate limit.
+func WithProbes(ready *ReadyHandler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			HealthHandler{}.ServeHTTP(w, r)
+		case "/readyz":
+			ready.ServeHTTP(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+type HealthHandler struct{}
+
+func (HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadyHandler reports ready once the store has recovered, and unready again
+// as soon as the server begins draining.
+type ReadyHandler struct {
+	Store    *store.Store
+	draining atomic.Bool
+}
+
+func NewReadyHandler(s *store.Store) *ReadyHandler {
+	return &ReadyHandler{Store: s}
+}
+
+func (h *ReadyHandler) Drain() {
+	h.draining.Store(true)
+}
+
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := "ready"
+	switch {
+	case h.draining.Load():
+		status = "draining"
+	case !h.Store.Ready():
+		status = "recovering"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
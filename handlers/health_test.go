@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/receipt-processor/ratelimit"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+func TestHealthHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	HealthHandler{}.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	s := store.Open(filepath.Join(t.TempDir(), "receipts.json"))
+	handler := NewReadyHandler(s)
+
+	check := func(expectedCode int, expectedStatus string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		if rr.Code != expectedCode {
+			t.Errorf("expected status %d, got %d", expectedCode, rr.Code)
+		}
+		var response map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response["status"] != expectedStatus {
+			t.Errorf("expected %q, got %q", expectedStatus, response["status"])
+		}
+	}
+
+	check(http.StatusServiceUnavailable, "recovering")
+
+	if err := s.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	check(http.StatusOK, "ready")
+
+	handler.Drain()
+	check(http.StatusServiceUnavailable, "draining")
+}
+
+func TestWithProbes(t *testing.T) {
+	limiters := ratelimit.NewLimiters(ratelimit.Config{Default: ratelimit.Limit{Rate: 0.001, Burst: 1}})
+	next := tenant.Middleware(tenant.NewRegistry(), ratelimit.Middleware(limiters, ratelimit.ClientKey,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })))
+	handler := WithProbes(NewReadyHandler(store.NewStore()), next)
+
+	serve := func(path, tenantID string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if tenantID != "" {
+			req.Header.Set(tenant.Header, tenantID)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve("/receipts/abc/points", "unknown"); code != http.StatusUnauthorized {
+		t.Errorf("expected an unknown tenant to be refused, got %d", code)
+	}
+	if code := serve("/receipts/abc/points", ""); code != http.StatusNoContent {
+		t.Errorf("expected the first request to be allowed, got %d", code)
+	}
+	if code := serve("/receipts/abc/points", ""); code != http.StatusTooManyRequests {
+		t.Errorf("expected the client to be rate limited, got %d", code)
+	}
+	for _, path := range []string{"/healthz", "/readyz"} {
+		for _, tenantID := range []string{"", "unknown"} {
+			if code := serve(path, tenantID); code != http.StatusOK {
+				t.Errorf("%s with tenant %q: expected status 200, got %d", path, tenantID, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"github.com/receipt-processor/models"
+)
+
+// Limits bound the size of a receipt and the characters its names may use.
+// Zero charsets fall back to the defaults.
+type Limits struct {
+	MaxBodyBytes         int64   `json:"maxBodyBytes"`
+	MaxItems             int     `json:"maxItems"`
+	MaxRetailerLength    int     `json:"maxRetailerLength"`
+	MaxDescriptionLength int     `json:"maxDescriptionLength"`
+	Strict               bool    `json:"strict"`
+	RetailerCharset      Charset `json:"retailerCharset"`
+	DescriptionCharset   Charset `json:"descriptionCharset"`
+}
+
+var DefaultLimits = Limits{
+	MaxBodyBytes:         1 << 20,
+	MaxItems:             500,
+	MaxRetailerLength:    100,
+	MaxDescriptionLength: 200,
+	RetailerCharset:      DefaultRetailerCharset,
+	DescriptionCharset:   DefaultDescriptionCharset,
+}
+
+var (
+	ErrInvalidJSON          = errors.New("malformed JSON")
+	ErrMalformedBody        = errors.New("malformed request body")
+	ErrUnsupportedMediaType = errors.New("unsupported content type")
+	ErrNotAcceptable        = errors.New("no acceptable content type")
+	ErrBodyTooLarge         = errors.New("request body too large")
+	ErrUnknownField         = errors.New("unknown field in request body")
+	ErrTrailingData         = errors.New("unexpected data after receipt")
+	ErrTooManyItems         = errors.New("too many items")
+	ErrRetailerTooLong      = errors.New("retailer name too long")
+	ErrDescriptionTooLong   = errors.New("item description too long")
+)
+
+// checkLimits enforces the size limits on a decoded receipt. A zero limit
+// disables the corresponding check.
+func checkLimits(receipt models.Receipt, limits Limits) error {
+	if limits.MaxItems > 0 && (len(receipt.Items) > limits.MaxItems || len(receipt.Discounts) > limits.MaxItems) {
+		return ErrTooManyItems
+	}
+
+	if limits.MaxRetailerLength > 0 && utf8.RuneCountInString(receipt.Retailer) > limits.MaxRetailerLength {
+		return ErrRetailerTooLong
+	}
+
+	if limits.MaxDescriptionLength > 0 {
+		for _, item := range receipt.Items {
+			if utf8.RuneCountInString(item.ShortDescription) > limits.MaxDescriptionLength {
+				return ErrDescriptionTooLong
+			}
+		}
+		for _, discount := range receipt.Discounts {
+			if utf8.RuneCountInString(discount.Description) > limits.MaxDescriptionLength {
+				return ErrDescriptionTooLong
+			}
+		}
+	}
+
+	return nil
+}
+
+var errorCodes = map[error]string{
+	ErrEmptyBody:              "empty_body",
+	ErrInvalidJSON:            "invalid_json",
+	ErrMalformedBody:          "malformed_body",
+	ErrUnsupportedMediaType:   "unsupported_media_type",
+	ErrNotAcceptable:          "not_acceptable",
+	ErrBodyTooLarge:           "body_too_large",
+	ErrUnknownField:           "unknown_field",
+	ErrTrailingData:           "trailing_data",
+	ErrTooManyItems:           "too_many_items",
+	ErrRetailerTooLong:        "retailer_too_long",
+	ErrDescriptionTooLong:     "description_too_long",
+	ErrMissingRequiredFields:  "missing_required_fields",
+	ErrInvalidRetailer:        "invalid_retailer",
+	ErrInvalidDate:            "invalid_date",
+	ErrInvalidTime:            "invalid_time",
+	ErrInvalidTotal:           "invalid_total",
+	ErrInvalidItemDescription: "invalid_item_description",
+	ErrInvalidItemPrice:       "invalid_item_price",
+	ErrInvalidCurrency:        "invalid_currency",
+	ErrNoExchangeRate:         "no_exchange_rate",
+	ErrInvalidTimeZone:        "invalid_time_zone",
+	ErrNonexistentTime:        "nonexistent_time",
+	ErrPointsHeld:             "points_held",
+	ErrPointsVoided:           "points_voided",
+	ErrPointsRefunded:         "points_refunded",
+	ErrNotPendingReview:       "not_pending_review",
+	ErrReviewClaimed:          "review_claimed",
+	ErrReviewNotClaimed:       "review_not_claimed",
+	ErrReviewerRequired:       "reviewer_required",
+	ErrReasonRequired:         "reason_required",
+	ErrNotCredited:            "not_credited",
+	ErrRescoreRunning:         "rescore_running",
+	ErrRescoreFinished:        "rescore_finished",
+	ErrInvalidQuantity:        "invalid_quantity",
+	ErrInvalidUnitPrice:       "invalid_unit_price",
+	ErrInvalidSKU:             "invalid_sku",
+	ErrInvalidUPC:             "invalid_upc",
+	ErrInvalidSubtotal:        "invalid_subtotal",
+	ErrInvalidDiscount:        "invalid_discount",
+	ErrInvalidTax:             "invalid_tax",
+	ErrInvalidTip:             "invalid_tip",
+	ErrItemPriceMismatch:      "item_price_mismatch",
+	ErrSubtotalMismatch:       "subtotal_mismatch",
+	ErrTotalMismatch:          "total_mismatch",
+	ErrInvalidRules:           "invalid_rules",
+}
+
+// ErrorCode maps a decoding or validation error to its machine-readable
+// code.
+func ErrorCode(err error) string {
+	for known, code := range errorCodes {
+		if errors.Is(err, known) {
+			return code
+		}
+	}
+	return "internal"
+}
+
+// IsValidationError reports whether err means the submitted receipt was
+// rejected, as opposed to a storage or quota failure.
+func IsValidationError(err error) bool {
+	for known := range errorCodes {
+		if errors.Is(err, known) {
+			return true
+		}
+	}
+	return false
+}
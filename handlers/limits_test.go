@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+)
+
+const limitsTestReceipt = `{"retailer":"Target","purchaseDate":"2022-01-01","purchaseTime":"13:01",` +
+	`"items":[{"shortDescription":"Item","price":"1.00"}],"total":"1.00"}`
+
+func TestProcessHandlerLimits(t *testing.T) {
+	testCases := []struct {
+		name         string
+		limits       Limits
+		body         string
+		expectedCode int
+		expectedErr  string
+	}{
+		{"within limits", DefaultLimits, limitsTestReceipt, http.StatusOK, ""},
+		{"body too large", Limits{MaxBodyBytes: 16}, limitsTestReceipt, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"trailing data", DefaultLimits, limitsTestReceipt + `{"extra":true}`, http.StatusBadRequest, "trailing_data"},
+		{"trailing garbage", DefaultLimits, limitsTestReceipt + `garbage`, http.StatusBadRequest, "trailing_data"},
+		{"trailing whitespace", DefaultLimits, limitsTestReceipt + "\n  ", http.StatusOK, ""},
+		{"unknown field lenient", DefaultLimits, strings.Replace(limitsTestReceipt, `{`, `{"store":1,`, 1), http.StatusOK, ""},
+		{"unknown field strict", Limits{Strict: true}, strings.Replace(limitsTestReceipt, `{`, `{"store":1,`, 1), http.StatusBadRequest, "unknown_field"},
+		{"too many items", Limits{MaxItems: 1}, strings.Replace(limitsTestReceipt, `"items":[`, `"items":[{"shortDescription":"A","price":"1.00"},`, 1), http.StatusBadRequest, "too_many_items"},
+		{"retailer too long", Limits{MaxRetailerLength: 3}, limitsTestReceipt, http.StatusBadRequest, "retailer_too_long"},
+		{"description too long", Limits{MaxDescriptionLength: 3}, limitsTestReceipt, http.StatusBadRequest, "description_too_long"},
+		{"validation failure", DefaultLimits, strings.Replace(limitsTestReceipt, "13:01", "1pm", 1), http.StatusBadRequest, "invalid_time"},
+		{"empty body", DefaultLimits, "", http.StatusBadRequest, "empty_body"},
+		{"malformed json", DefaultLimits, "{", http.StatusBadRequest, "invalid_json"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := NewProcessHandler(store.NewStore())
+			handler.Limits = tc.limits
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedCode {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedCode, rr.Code, rr.Body.String())
+			}
+
+			if tc.expectedErr == "" {
+				return
+			}
+
+			var response map[string]string
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response["code"] != tc.expectedErr {
+				t.Errorf("expected code %q, got %q", tc.expectedErr, response["code"])
+			}
+		})
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer: "Café",
+		Items:    []models.Item{{ShortDescription: "Crème", Price: "1.00"}},
+	}
+
+	if err := checkLimits(receipt, Limits{MaxRetailerLength: 4, MaxDescriptionLength: 5}); err != nil {
+		t.Errorf("expected lengths to be counted in characters, got %v", err)
+	}
+	if err := checkLimits(receipt, Limits{}); err != nil {
+		t.Errorf("expected zero limits to disable checks, got %v", err)
+	}
+}
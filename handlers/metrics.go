@@ -0,0 +1,23 @@
+package handlers
+
+import "github.com/receipt-processor/metrics"
+
+var (
+	RequestDuration = metrics.Default.NewHistogram("http_request_duration_seconds",
+		"Latency of HTTP requests by route.", metrics.DefaultBuckets, "route")
+
+	receiptsProcessed = metrics.Default.NewCounter("receipts_processed_total",
+		"Receipts accepted and stored.")
+	receiptsRejected = metrics.Default.NewCounter("receipts_rejected_total",
+		"Receipts rejected by validation, by error kind.", "reason")
+	receiptsUnbalanced = metrics.Default.NewCounter("receipts_unbalanced_total",
+		"Accepted receipts whose total did not match their components, by outcome.", "outcome")
+	receiptsHeld = metrics.Default.NewCounter("receipts_held_total",
+		"Accepted receipts whose points were held for manual review.")
+	receiptsReviewed = metrics.Default.NewCounter("receipts_reviewed_total",
+		"Held receipts decided by a reviewer, by decision.", "decision")
+	receiptsRefunded = metrics.Default.NewCounter("receipts_refunded_total",
+		"Credited receipts whose points were refunded.")
+	pointsAwarded = metrics.Default.NewHistogram("receipt_points_awarded",
+		"Points awarded to processed receipts.", []float64{10, 25, 50, 75, 100, 150, 200, 300, 500})
+)
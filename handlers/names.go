@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/receipt-processor/models"
+)
+
+// Charset is the characters a retailer name or item description may
+// contain: letters and digits from the listed Unicode scripts, or from any
+// script when Scripts is empty, combining marks following them, ASCII
+// digits, and the listed punctuation. Script names are those of the
+// unicode package, e.g. "Latin" or "Han".
+type Charset struct {
+	Scripts     []string `json:"scripts,omitempty"`
+	Punctuation string   `json:"punctuation"`
+}
+
+var (
+	DefaultRetailerCharset    = Charset{Punctuation: " -&'’.,#"}
+	DefaultDescriptionCharset = Charset{Punctuation: " -&'’.,/%#"}
+)
+
+// Valid reports an error for script names the unicode package does not
+// know.
+func (c Charset) Valid() error {
+	for _, name := range c.Scripts {
+		if _, ok := unicode.Scripts[name]; !ok {
+			return fmt.Errorf("unknown Unicode script %q", name)
+		}
+	}
+	return nil
+}
+
+func (c Charset) isZero() bool {
+	return len(c.Scripts) == 0 && c.Punctuation == ""
+}
+
+// allows reports whether every character of s is in the charset.
+func (c Charset) allows(s string) bool {
+	afterLetter := false
+	for _, r := range s {
+		switch {
+		case r <= unicode.MaxASCII && unicode.IsDigit(r):
+			afterLetter = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !c.inScripts(r) {
+				return false
+			}
+			afterLetter = true
+		case unicode.IsMark(r):
+			if !afterLetter {
+				return false
+			}
+		case strings.ContainsRune(c.Punctuation, r):
+			afterLetter = false
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (c Charset) inScripts(r rune) bool {
+	if len(c.Scripts) == 0 {
+		return true
+	}
+	for _, name := range c.Scripts {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return true
+		}
+	}
+	return false
+}
+
+// charsetOr returns c, or fallback when c is the zero Charset, so limits
+// built without charsets keep the defaults.
+func charsetOr(c, fallback Charset) Charset {
+	if c.isZero() {
+		return fallback
+	}
+	return c
+}
+
+// Normalize puts the receipt's names in Unicode NFC, so "Café" typed with
+// a combining accent and with a precomposed é validate, store and score
+// the same.
+func Normalize(receipt models.Receipt) models.Receipt {
+	receipt.Retailer = norm.NFC.String(receipt.Retailer)
+	if len(receipt.Items) > 0 {
+		items := make([]models.Item, len(receipt.Items))
+		for i, item := range receipt.Items {
+			item.ShortDescription = norm.NFC.String(item.ShortDescription)
+			items[i] = item
+		}
+		receipt.Items = items
+	}
+	if len(receipt.Discounts) > 0 {
+		discounts := make([]models.Discount, len(receipt.Discounts))
+		for i, discount := range receipt.Discounts {
+			discount.Description = norm.NFC.String(discount.Description)
+			discounts[i] = discount
+		}
+		receipt.Discounts = discounts
+	}
+	return receipt
+}
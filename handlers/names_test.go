@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/receipt-processor/models"
+)
+
+func TestCharsetAllows(t *testing.T) {
+	latin := Charset{Scripts: []string{"Latin"}, Punctuation: DefaultRetailerCharset.Punctuation}
+
+	testCases := []struct {
+		name    string
+		charset Charset
+		s       string
+		allowed bool
+	}{
+		{"ascii", DefaultRetailerCharset, "M&M Corner Market", true},
+		{"accented", DefaultRetailerCharset, "Café Nero", true},
+		{"combining accent", DefaultRetailerCharset, "Cafe\u0301 Nero", true},
+		{"apostrophe", DefaultRetailerCharset, "Trader Joe's", true},
+		{"typographic apostrophe", DefaultRetailerCharset, "Trader Joe’s", true},
+		{"dots", DefaultRetailerCharset, "H.E.B.", true},
+		{"han", DefaultRetailerCharset, "全家便利商店", true},
+		{"arabic digits", DefaultRetailerCharset, "متجر ٧", true},
+		{"mark without a letter", DefaultRetailerCharset, "\u0301Target", false},
+		{"mark after punctuation", DefaultRetailerCharset, "Target -\u0301", false},
+		{"symbol", DefaultRetailerCharset, "Target!", false},
+		{"emoji", DefaultRetailerCharset, "Target 🎯", false},
+		{"control character", DefaultRetailerCharset, "Target\t", false},
+		{"latin only accepts accents", latin, "Café Nero", true},
+		{"latin only accepts ascii digits", latin, "7-Eleven", true},
+		{"latin only rejects han", latin, "全家", false},
+		{"latin only rejects arabic digits", latin, "Store ٧", false},
+		{"description slash and percent", DefaultDescriptionCharset, "Milk 2% 1/2 gal #4", true},
+		{"retailer rejects percent", DefaultRetailerCharset, "Milk 2%", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.charset.allows(tc.s); got != tc.allowed {
+				t.Errorf("allows(%q) = %v, expected %v", tc.s, got, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestCharsetValid(t *testing.T) {
+	if err := (Charset{Scripts: []string{"Latin", "Cyrillic", "Han"}}).Valid(); err != nil {
+		t.Errorf("expected known scripts to be valid, got %v", err)
+	}
+	if err := (Charset{Scripts: []string{"Latin", "Elvish"}}).Valid(); err == nil {
+		t.Error("expected an unknown script to be invalid")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:  "Cafe\u0301 Nero",
+		Items:     []models.Item{{ShortDescription: "Cre\u0300me bru\u0302le\u0301e", Price: "4.50"}},
+		Discounts: []models.Discount{{Description: "Fide\u0301lite\u0301", Amount: "0.50"}},
+	}
+	original := receipt.Items[0].ShortDescription
+
+	normalized := Normalize(receipt)
+	if normalized.Retailer != "Café Nero" {
+		t.Errorf("expected a precomposed retailer, got %q", normalized.Retailer)
+	}
+	if normalized.Items[0].ShortDescription != "Crème brûlée" {
+		t.Errorf("expected a precomposed description, got %q", normalized.Items[0].ShortDescription)
+	}
+	if normalized.Discounts[0].Description != "Fidélité" {
+		t.Errorf("expected a precomposed discount, got %q", normalized.Discounts[0].Description)
+	}
+	if receipt.Items[0].ShortDescription != original {
+		t.Error("expected the submitted receipt to be left unchanged")
+	}
+}
+
+func TestValidateUnicodeNames(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "Café Nero",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Crème brûlée", Price: "4.50"}},
+		Total:        "4.50",
+	}
+	if err := Validate(receipt, DefaultLimits); err != nil {
+		t.Errorf("expected a Unicode receipt to validate, got %v", err)
+	}
+
+	limits := DefaultLimits
+	limits.RetailerCharset = Charset{Scripts: []string{"Han"}, Punctuation: " "}
+	if err := Validate(receipt, limits); !errors.Is(err, ErrInvalidRetailer) {
+		t.Errorf("expected %v with a Han-only retailer charset, got %v", ErrInvalidRetailer, err)
+	}
+
+	// Limits built without charsets keep the defaults.
+	receipt.Retailer = "Trader Joe's"
+	if err := Validate(receipt, Limits{}); err != nil {
+		t.Errorf("expected the default charsets for zero limits, got %v", err)
+	}
+}
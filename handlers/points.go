@@ -1,20 +1,29 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 
+	"github.com/receipt-processor/codec"
 	"github.com/receipt-processor/models"
-	"github.com/receipt-processor/processor"
 	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+var (
+	ErrPointsHeld     = errors.New("points held pending review")
+	ErrPointsVoided   = errors.New("points voided on review")
+	ErrPointsRefunded = errors.New("points refunded")
 )
 
 type PointsHandler struct {
-	Store *store.Store
+	Store   *store.Store
+	Tenants *tenant.Registry
 }
 
-func NewPointsHandler(s *store.Store) *PointsHandler {
-	return &PointsHandler{Store: s}
+func NewPointsHandler(s *store.Store, tenants *tenant.Registry) *PointsHandler {
+	return &PointsHandler{Store: s, Tenants: tenants}
 }
 
 func (h *PointsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -29,17 +38,45 @@ func (h *PointsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	receipt, err := h.Store.GetReceipt(id)
+	encoder, err := codec.ForAccept(r.Header.Get("Accept"))
+	if err != nil {
+		respondWithRecord(w, codec.JSON, http.StatusNotAcceptable,
+			errorRecord("None of the accepted content types can be produced.", ErrNotAcceptable))
+		return
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+	record, err := h.Store.GetRecord(r.Context(), tenantID, id)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "No receipt found for that ID.",
-		})
+		slog.InfoContext(r.Context(), "receipt not found", "tenant", tenantID, "receipt_id", id)
+		respondWithRecord(w, encoder, http.StatusNotFound, codec.Record{{Name: "error", Value: "No receipt found for that ID."}})
+		return
+	}
+	switch record.State() {
+	case models.StateReceived, models.StateValidated, models.StateScored:
+		respondWithRecord(w, encoder, http.StatusAccepted, codec.Record{{Name: "status", Value: StatusPending}})
+		return
+	case models.StateRejected:
+		rejection := record.Metadata.Rejection
+		respondWithRecord(w, encoder, http.StatusUnprocessableEntity,
+			codec.Record{{Name: "error", Value: "The receipt is invalid."}, {Name: "code", Value: rejection.Code}})
+		return
+	case models.StateHeld:
+		respondWithRecord(w, encoder, http.StatusConflict,
+			errorRecord("The receipt's points are held pending review.", ErrPointsHeld))
+		return
+	case models.StateVoided:
+		respondWithRecord(w, encoder, http.StatusConflict,
+			errorRecord("The receipt's points were voided on review.", ErrPointsVoided))
+		return
+	case models.StateRefunded:
+		respondWithRecord(w, encoder, http.StatusConflict,
+			errorRecord("The receipt's points were refunded.", ErrPointsRefunded))
 		return
 	}
 
-	points := processor.CalculatePoints(receipt)
+	points := record.Points(h.Tenants.Calculator(tenantID))
+	slog.DebugContext(r.Context(), "points calculated", "tenant", tenantID, "receipt_id", id, "points", points)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models.Points{Points: points})
+	respondWithRecord(w, encoder, http.StatusOK, codec.Record{{Name: "points", Value: points}})
 }
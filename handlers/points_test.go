@@ -3,13 +3,16 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/receipt-processor/models"
 	"github.com/receipt-processor/processor"
 	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
 )
 
 func TestPointsHandler(t *testing.T) {
@@ -25,7 +28,7 @@ func TestPointsHandler(t *testing.T) {
 
 	t.Run("invalid HTTP method", func(t *testing.T) {
 		store := store.NewStore()
-		handler := NewPointsHandler(store)
+		handler := NewPointsHandler(store, nil)
 		req := httptest.NewRequest(http.MethodPost, "/", nil)
 		rr := httptest.NewRecorder()
 
@@ -38,7 +41,7 @@ func TestPointsHandler(t *testing.T) {
 
 	t.Run("missing receipt ID", func(t *testing.T) {
 		store := store.NewStore()
-		handler := NewPointsHandler(store)
+		handler := NewPointsHandler(store, nil)
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
 		rr := httptest.NewRecorder()
 
@@ -51,7 +54,7 @@ func TestPointsHandler(t *testing.T) {
 
 	t.Run("invalid receipt ID type", func(t *testing.T) {
 		store := store.NewStore()
-		handler := NewPointsHandler(store)
+		handler := NewPointsHandler(store, nil)
 		ctx := context.WithValue(context.Background(), "receipt_id", 123)
 		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
 		rr := httptest.NewRecorder()
@@ -65,7 +68,7 @@ func TestPointsHandler(t *testing.T) {
 
 	t.Run("receipt not found", func(t *testing.T) {
 		store := store.NewStore()
-		handler := NewPointsHandler(store)
+		handler := NewPointsHandler(store, nil)
 		ctx := context.WithValue(context.Background(), "receipt_id", "nonexistent")
 		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
 		rr := httptest.NewRecorder()
@@ -88,10 +91,10 @@ func TestPointsHandler(t *testing.T) {
 
 	t.Run("successful points calculation", func(t *testing.T) {
 		store := store.NewStore()
-		id := store.SaveReceipt(validReceipt)
+		id, _ := store.SaveReceipt(context.Background(), tenant.Default, validReceipt)
 		expectedPoints := processor.CalculatePoints(validReceipt)
 
-		handler := NewPointsHandler(store)
+		handler := NewPointsHandler(store, nil)
 		ctx := context.WithValue(context.Background(), "receipt_id", id)
 		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
 		rr := httptest.NewRecorder()
@@ -111,4 +114,78 @@ func TestPointsHandler(t *testing.T) {
 			t.Errorf("expected points %d, got %d", expectedPoints, response.Points)
 		}
 	})
+
+	t.Run("negotiated response format", func(t *testing.T) {
+		store := store.NewStore()
+		id, _ := store.SaveReceipt(context.Background(), tenant.Default, validReceipt)
+		handler := NewPointsHandler(store, nil)
+
+		testCases := []struct {
+			accept   string
+			status   int
+			expected string
+		}{
+			{"text/csv", http.StatusOK, fmt.Sprintf("points\n%d\n", processor.CalculatePoints(validReceipt))},
+			{"application/xml", http.StatusOK, fmt.Sprintf("<points>%d</points>", processor.CalculatePoints(validReceipt))},
+			{"image/png", http.StatusNotAcceptable, `"code":"not_acceptable"`},
+		}
+
+		for _, tc := range testCases {
+			ctx := context.WithValue(context.Background(), "receipt_id", id)
+			req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			req.Header.Set("Accept", tc.accept)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Errorf("%s: expected status %d, got %d", tc.accept, tc.status, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tc.expected) {
+				t.Errorf("%s: expected body containing %q, got %q", tc.accept, tc.expected, rr.Body)
+			}
+		}
+	})
+
+	t.Run("receipt from another tenant", func(t *testing.T) {
+		store := store.NewStore()
+		id, _ := store.SaveReceipt(context.Background(), "tenant-a", validReceipt)
+
+		handler := NewPointsHandler(store, nil)
+		ctx := context.WithValue(tenant.NewContext(context.Background(), "tenant-b"), "receipt_id", id)
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("tenant rule set", func(t *testing.T) {
+		rules := processor.DefaultRules
+		rules.RetailerCharPoints = 10
+		tenants := tenant.NewRegistry()
+		tenants.Add(tenant.Tenant{ID: "tenant-a", Rules: &rules})
+
+		store := store.NewStore()
+		id, _ := store.SaveReceipt(context.Background(), "tenant-a", validReceipt)
+
+		handler := NewPointsHandler(store, tenants)
+		ctx := context.WithValue(tenant.NewContext(context.Background(), "tenant-a"), "receipt_id", id)
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		var response models.Points
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := rules.CalculatePoints(validReceipt); response.Points != expected {
+			t.Errorf("expected points %d, got %d", expected, response.Points)
+		}
+	})
 }
@@ -1,23 +1,44 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/receipt-processor/codec"
+	"github.com/receipt-processor/currency"
+	"github.com/receipt-processor/events"
+	"github.com/receipt-processor/fraud"
+	"github.com/receipt-processor/jobs"
 	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/retailer"
 	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+	"github.com/receipt-processor/timezone"
+	"github.com/receipt-processor/webhook"
 )
 
 type ProcessHandler struct {
-	store *store.Store
+	store     *store.Store
+	Limits    Limits
+	Reconcile ReconcilePolicy
+	Tenants   *tenant.Registry
+	Webhooks  *webhook.Dispatcher
+	Events    *events.Bus
+	Fraud     *fraud.Assessor
+	// Queue switches every transport to asynchronous processing when set.
+	// See Accept.
+	Queue *jobs.Queue
 }
 
 func NewProcessHandler(s *store.Store) *ProcessHandler {
-	return &ProcessHandler{store: s}
+	return &ProcessHandler{store: s, Limits: DefaultLimits, Reconcile: DefaultReconcilePolicy, Fraud: fraud.NewAssessor(fraud.DefaultConfig)}
 }
 
 func (h *ProcessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -26,34 +47,276 @@ func (h *ProcessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	receipt, err := decodeAndValidateReceipt(r)
+	tenantID := tenant.FromContext(r.Context())
+
+	encoder, err := codec.ForAccept(r.Header.Get("Accept"))
+	if err != nil {
+		h.reject(r.Context(), tenantID, ErrNotAcceptable)
+		respondWithProcessError(w, codec.JSON, ErrNotAcceptable)
+		return
+	}
+
+	receipt, err := decodeReceipt(w, r, h.Limits)
+	if err != nil {
+		h.reject(r.Context(), tenantID, err)
+		respondWithProcessError(w, encoder, err)
+		return
+	}
+
+	record, err := h.Accept(r.Context(), tenantID, receipt)
 	if err != nil {
-		respondWithError(w, "The receipt is invalid.", http.StatusBadRequest)
+		respondWithProcessError(w, encoder, err)
+		return
+	}
+	if record.State() == models.StateReceived {
+		respondWithRecord(w, encoder, http.StatusAccepted,
+			codec.Record{{Name: "id", Value: record.ID}, {Name: "status", Value: StatusPending}})
+		return
+	}
+	respondWithRecord(w, encoder, http.StatusOK, processedRecord(record))
+}
+
+// processedRecord is the response for a receipt that has been scored.
+func processedRecord(record store.Record) codec.Record {
+	response := codec.Record{{Name: "id", Value: record.ID}}
+	if outcome := record.Metadata.Reconciliation.Outcome; outcome != OutcomeAccepted {
+		response = append(response, codec.Field{Name: "reconciliation", Value: outcome})
+	}
+	if record.Held() {
+		response = append(response, codec.Field{Name: "held", Value: true})
+	}
+	return response
+}
+
+// Process accepts a decoded receipt and returns its ID. See Accept.
+func (h *ProcessHandler) Process(ctx context.Context, tenantID string, receipt models.Receipt) (string, error) {
+	record, err := h.Accept(ctx, tenantID, receipt)
+	return record.ID, err
+}
+
+// Accept hands a decoded receipt to Enqueue in asynchronous mode and to
+// Submit otherwise. Every transport funnels submissions through it; a
+// returned record still in the received state has been queued.
+func (h *ProcessHandler) Accept(ctx context.Context, tenantID string, receipt models.Receipt) (store.Record, error) {
+	if h.Queue != nil {
+		return h.Enqueue(ctx, tenantID, receipt)
+	}
+	return h.Submit(ctx, tenantID, receipt)
+}
+
+// Submit validates, reconciles, scores for fraud risk and stores a decoded
+// receipt, then credits its points. Receipts flagged by reconciliation or
+// held for fraud risk are instead queued for manual review and only
+// announced to webhooks, as receipt.held. The stored lifecycle records
+// when the receipt was received, validated and scored, and whether it was
+// then held or credited.
+func (h *ProcessHandler) Submit(ctx context.Context, tenantID string, receipt models.Receipt) (store.Record, error) {
+	lifecycle := models.NewLifecycle(time.Now().UTC())
+	receipt = Normalize(receipt)
+	metadata, points, err := h.evaluate(ctx, tenantID, receipt, lifecycle)
+	if err != nil {
+		h.reject(ctx, tenantID, err)
+		return store.Record{}, err
+	}
+
+	id, err := h.store.SaveRecord(ctx, tenantID, receipt, metadata)
+	if err != nil {
+		logSaveError(ctx, tenantID, err)
+		return store.Record{}, err
+	}
+
+	record := store.Record{ID: id, Receipt: receipt, Metadata: metadata}
+	h.settle(ctx, tenantID, record, points)
+	return record, nil
+}
+
+// evaluate validates, reconciles, scores and assesses a normalized
+// receipt. It returns the metadata to store with it, whose lifecycle
+// continues the given one through validated and scored to held or
+// credited, and the points the receipt earned.
+func (h *ProcessHandler) evaluate(ctx context.Context, tenantID string, receipt models.Receipt, lifecycle *models.Lifecycle) (models.Metadata, int, error) {
+	if err := Validate(receipt, h.Limits); err != nil {
+		return models.Metadata{}, 0, err
+	}
+
+	reconciliation, err := reconcile(receipt, h.Reconcile)
+	if err != nil {
+		return models.Metadata{}, 0, err
+	}
+	if !reconciliation.Balanced {
+		slog.InfoContext(ctx, "receipt total does not reconcile", "tenant", tenantID,
+			"total", receipt.Total, "expected", reconciliation.Expected, "outcome", reconciliation.Outcome)
+		receiptsUnbalanced.Inc(reconciliation.Outcome)
+	}
+	lifecycle = lifecycle.To(models.StateValidated, time.Now().UTC())
+	purchasedAt, _ := timezone.Instant(receipt.PurchaseDate, receipt.PurchaseTime, receipt.TimeZone)
+	metadata := models.Metadata{Member: fraud.MemberFromContext(ctx), Reconciliation: &reconciliation, PurchasedAt: &purchasedAt}
+	if r, ok := retailer.Default.Match(receipt.Retailer); ok {
+		metadata.Retailer = r.Canonical()
+	}
+
+	rules := h.Tenants.Rules(tenantID)
+	breakdown, err := rules.Breakdown(receipt)
+	if errors.Is(err, currency.ErrNoRate) {
+		return models.Metadata{}, 0, fmt.Errorf("%w: %v", ErrNoExchangeRate, err)
+	}
+	if err != nil {
+		return models.Metadata{}, 0, err
+	}
+	if !reconciliation.Scores() {
+		breakdown = []models.RulePoints{}
+	}
+	points := 0
+	for _, awarded := range breakdown {
+		points += awarded.Points
+	}
+	metadata.Score = &models.Score{Points: points, Breakdown: breakdown, Version: rules.Version, At: time.Now().UTC()}
+	if h.Fraud != nil {
+		risk := h.Fraud.Assess(tenantID, fraud.MemberFromContext(ctx), receipt, breakdown)
+		metadata.Risk = &risk
+	}
+	metadata.Review = holdForReview(metadata)
+	lifecycle = lifecycle.To(models.StateScored, time.Now().UTC())
+	if metadata.Review != nil {
+		metadata.Lifecycle = lifecycle.To(models.StateHeld, time.Now().UTC())
+	} else {
+		metadata.Lifecycle = lifecycle.To(models.StateCredited, time.Now().UTC())
+	}
+	return metadata, points, nil
+}
+
+// settle records a processed receipt and credits its points, or announces
+// that they are held for review.
+func (h *ProcessHandler) settle(ctx context.Context, tenantID string, record store.Record, points int) {
+	slog.InfoContext(ctx, "receipt processed", "tenant", tenantID, "receipt_id", record.ID)
+	receiptsProcessed.Inc()
+
+	if record.Held() {
+		slog.WarnContext(ctx, "receipt points held for review", "tenant", tenantID, "receipt_id", record.ID,
+			"reasons", record.Metadata.Review.Reasons)
+		receiptsHeld.Inc()
+		if h.Webhooks != nil {
+			h.Webhooks.Publish(webhook.Event{
+				Type:      webhook.EventReceiptHeld,
+				Tenant:    tenantID,
+				ReceiptID: record.ID,
+			})
+		}
 		return
 	}
+	h.credit(tenantID, record, points)
+}
+
+func logSaveError(ctx context.Context, tenantID string, err error) {
+	if !errors.Is(err, store.ErrQuotaExceeded) && !errors.Is(err, store.ErrDailyQuota) {
+		slog.ErrorContext(ctx, "saving receipt failed", "tenant", tenantID, "error", err)
+	}
+}
+
+// credit records the points a receipt earned and notifies stream and
+// webhook subscribers of them.
+func (h *ProcessHandler) credit(tenantID string, record store.Record, points int) {
+	pointsAwarded.Observe(float64(points))
+
+	if h.Events != nil {
+		h.Events.Publish(events.Event{
+			Tenant:    tenantID,
+			ReceiptID: record.ID,
+			Retailer:  record.Receipt.Retailer,
+			Points:    points,
+		})
+	}
+
+	if h.Webhooks != nil {
+		h.Webhooks.Publish(webhook.Event{
+			Type:      webhook.EventReceiptProcessed,
+			Tenant:    tenantID,
+			ReceiptID: record.ID,
+			Points:    points,
+		})
+	}
+}
+
+func (h *ProcessHandler) reject(ctx context.Context, tenantID string, err error) {
+	code := ErrorCode(err)
+	slog.InfoContext(ctx, "receipt rejected", "tenant", tenantID, "code", code, "reason", err.Error())
+	receiptsRejected.Inc(code)
+}
+
+func respondWithProcessError(w http.ResponseWriter, c codec.Codec, err error) {
+	switch {
+	case errors.Is(err, store.ErrQuotaExceeded):
+		respondWithRecord(w, c, http.StatusTooManyRequests, codec.Record{{Name: "error", Value: "Receipt quota exceeded."}})
+	case errors.Is(err, store.ErrDailyQuota):
+		respondWithRecord(w, c, http.StatusTooManyRequests, codec.Record{{Name: "error", Value: "Daily submission quota exceeded."}})
+	case errors.Is(err, ErrBodyTooLarge):
+		respondWithRecord(w, c, http.StatusRequestEntityTooLarge, errorRecord("The request body is too large.", err))
+	case errors.Is(err, ErrUnsupportedMediaType):
+		respondWithRecord(w, c, http.StatusUnsupportedMediaType, errorRecord("The request content type is not supported.", err))
+	case errors.Is(err, ErrNotAcceptable):
+		respondWithRecord(w, c, http.StatusNotAcceptable, errorRecord("None of the accepted content types can be produced.", err))
+	case IsValidationError(err):
+		respondWithRecord(w, c, http.StatusBadRequest, errorRecord("The receipt is invalid.", err))
+	default:
+		respondWithRecord(w, c, http.StatusInternalServerError, codec.Record{{Name: "error", Value: "Unable to save receipt."}})
+	}
+}
 
-	id := h.store.SaveReceipt(receipt)
-	respondWithID(w, id)
+func errorRecord(message string, err error) codec.Record {
+	return codec.Record{{Name: "error", Value: message}, {Name: "code", Value: ErrorCode(err)}}
 }
 
-func decodeAndValidateReceipt(r *http.Request) (models.Receipt, error) {
+// decodeReceipt decodes the body with the codec selected by its
+// Content-Type. Bodies without a Content-Type are decoded as JSON.
+func decodeReceipt(w http.ResponseWriter, r *http.Request, limits Limits) (models.Receipt, error) {
 	var receipt models.Receipt
+	decoder, err := codec.ForContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return receipt, ErrUnsupportedMediaType
+	}
 	if r.Body == nil {
 		return receipt, ErrEmptyBody
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&receipt); err != nil {
-		return receipt, err
+	body := r.Body
+	if limits.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, limits.MaxBodyBytes)
 	}
 
-	if err := validateReceipt(receipt); err != nil {
-		return receipt, err
+	receipt, err = decoder.DecodeReceipt(body, limits.Strict)
+	if err != nil {
+		return receipt, decodeError(err, decoder)
 	}
-
 	return receipt, nil
 }
 
-func validateReceipt(receipt models.Receipt) error {
+// Validate applies the size limits and the receipt format rules.
+func Validate(receipt models.Receipt, limits Limits) error {
+	if err := checkLimits(receipt, limits); err != nil {
+		return err
+	}
+	return validateReceipt(receipt, limits)
+}
+
+func decodeError(err error, decoder codec.Codec) error {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return ErrBodyTooLarge
+	case errors.Is(err, codec.ErrUnknownField):
+		return fmt.Errorf("%w: %v", ErrUnknownField, err)
+	case errors.Is(err, codec.ErrTrailingData):
+		return ErrTrailingData
+	case errors.Is(err, io.EOF):
+		return ErrEmptyBody
+	case decoder == codec.JSON:
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	default:
+		return fmt.Errorf("%w: %v", ErrMalformedBody, err)
+	}
+}
+
+func validateReceipt(receipt models.Receipt, limits Limits) error {
 
 	if receipt.Retailer == "" || receipt.PurchaseDate == "" ||
 		receipt.PurchaseTime == "" || len(receipt.Items) == 0 ||
@@ -61,63 +324,57 @@ func validateReceipt(receipt models.Receipt) error {
 		return ErrMissingRequiredFields
 	}
 
-	for _, r := range receipt.Retailer {
-		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') &&
-			!(r >= '0' && r <= '9') && r != ' ' && r != '-' && r != '&' {
-			return ErrInvalidRetailer
-		}
+	if !charsetOr(limits.RetailerCharset, DefaultRetailerCharset).allows(receipt.Retailer) {
+		return ErrInvalidRetailer
 	}
 
 	if _, err := time.Parse("2006-01-02", receipt.PurchaseDate); err != nil {
 		return ErrInvalidDate
 	}
 
+	code := currency.Code(receipt.Currency)
+	digits, err := currency.MinorUnits(code)
+	if err != nil {
+		return ErrInvalidCurrency
+	}
+	if err := currency.Default.CanConvert(code, receipt.PurchaseDate); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoExchangeRate, err)
+	}
+
 	if _, err := time.Parse("15:04", receipt.PurchaseTime); err != nil {
 		return ErrInvalidTime
 	}
 
-	if err := validateMoneyFormat(receipt.Total); err != nil {
+	if _, err := timezone.Instant(receipt.PurchaseDate, receipt.PurchaseTime, receipt.TimeZone); err != nil {
+		if errors.Is(err, timezone.ErrNonexistentTime) {
+			return ErrNonexistentTime
+		}
+		return ErrInvalidTimeZone
+	}
+
+	if err := validateMoneyFormat(receipt.Total, digits); err != nil {
 		return ErrInvalidTotal
 	}
 
+	descriptions := charsetOr(limits.DescriptionCharset, DefaultDescriptionCharset)
 	for _, item := range receipt.Items {
-		if strings.TrimSpace(item.ShortDescription) == "" {
+		if strings.TrimSpace(item.ShortDescription) == "" || !descriptions.allows(item.ShortDescription) {
 			return ErrInvalidItemDescription
 		}
 
-		for _, r := range item.ShortDescription {
-			if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') &&
-				!(r >= '0' && r <= '9') && r != ' ' && r != '-' {
-				return ErrInvalidItemDescription
-			}
-		}
-
-		if err := validateMoneyFormat(item.Price); err != nil {
+		if err := validateMoneyFormat(item.Price, digits); err != nil {
 			return ErrInvalidItemPrice
 		}
 	}
 
-	return nil
+	return validateComponents(receipt, digits)
 }
 
-func validateMoneyFormat(amount string) error {
-	parts := strings.Split(amount, ".")
-	if len(parts) != 2 {
-		return errors.New("invalid money format")
-	}
-
-	if _, err := strconv.Atoi(parts[0]); err != nil {
-		return errors.New("invalid dollars amount")
-	}
-
-	if len(parts[1]) != 2 {
-		return errors.New("cents must be 2 digits")
-	}
-	if _, err := strconv.Atoi(parts[1]); err != nil {
-		return errors.New("invalid cents amount")
-	}
-
-	return nil
+// validateMoneyFormat checks that an amount has exactly as many decimals as
+// its currency's minor unit: two for dollars, none for yen.
+func validateMoneyFormat(amount string, digits int) error {
+	_, err := currency.ParseSignedAmount(amount, digits)
+	return err
 }
 
 func respondWithError(w http.ResponseWriter, message string, statusCode int) {
@@ -126,9 +383,13 @@ func respondWithError(w http.ResponseWriter, message string, statusCode int) {
 	json.NewEncoder(w).Encode(map[string]string{"error": message})
 }
 
-func respondWithID(w http.ResponseWriter, id string) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models.ReceiptID{ID: id})
+// respondWithRecord writes a response in the format negotiated from the
+// request's Accept header.
+func respondWithRecord(w http.ResponseWriter, c codec.Codec, statusCode int, record codec.Record) {
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(statusCode)
+	c.EncodeRecord(w, record)
 }
 
 var (
@@ -140,4 +401,8 @@ var (
 	ErrInvalidTotal           = errors.New("invalid total amount format")
 	ErrInvalidItemDescription = errors.New("invalid item description format")
 	ErrInvalidItemPrice       = errors.New("invalid item price format")
+	ErrInvalidCurrency        = errors.New("unknown currency code")
+	ErrNoExchangeRate         = errors.New("no exchange rate for the purchase date")
+	ErrInvalidTimeZone        = errors.New("unknown time zone")
+	ErrNonexistentTime        = errors.New("purchase time does not exist in its time zone")
 )
@@ -2,14 +2,21 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/receipt-processor/currency"
+	"github.com/receipt-processor/fraud"
 	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/retailer"
 	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
 )
 
 func TestProcessHandler(t *testing.T) {
@@ -237,25 +244,125 @@ func TestProcessHandler(t *testing.T) {
 			t.Fatal(err)
 		}
 	})
+
+	t.Run("content negotiation", func(t *testing.T) {
+		csvBody := "retailer,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+			"Test Retailer,2023-10-01,15:00,10.00,Item 1,10.00\n"
+		xmlBody := "<receipt><retailer>Test Retailer</retailer><purchaseDate>2023-10-01</purchaseDate>" +
+			"<purchaseTime>15:00</purchaseTime><items><item><shortDescription>Item 1</shortDescription>" +
+			"<price>10.00</price></item></items><total>10.00</total></receipt>"
+
+		testCases := []struct {
+			name         string
+			contentType  string
+			accept       string
+			body         string
+			status       int
+			responseType string
+		}{
+			{"csv in, xml out", "text/csv", "application/xml", csvBody, http.StatusOK, "application/xml"},
+			{"xml in, csv out", "text/xml; charset=utf-8", "text/csv", xmlBody, http.StatusOK, "text/csv"},
+			{"unsupported content type", "application/yaml", "", "retailer: Test", http.StatusUnsupportedMediaType, "application/json"},
+			{"unacceptable response type", "text/csv", "text/html", csvBody, http.StatusNotAcceptable, "application/json"},
+			{"malformed csv", "text/csv", "", "retailer\n", http.StatusBadRequest, "application/json"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				handler := NewProcessHandler(store.NewStore())
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+				req.Header.Set("Content-Type", tc.contentType)
+				req.Header.Set("Accept", tc.accept)
+				rr := httptest.NewRecorder()
+
+				handler.ServeHTTP(rr, req)
+
+				if rr.Code != tc.status {
+					t.Errorf("expected status %d, got %d: %s", tc.status, rr.Code, rr.Body)
+				}
+				if got := rr.Header().Get("Content-Type"); got != tc.responseType {
+					t.Errorf("expected content type %q, got %q", tc.responseType, got)
+				}
+			})
+		}
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		store := store.NewStore()
+		handler := NewProcessHandler(store)
+		processedBefore := receiptsProcessed.Value()
+		rejectedBefore := receiptsRejected.Value("invalid_date")
+		pointsBefore := pointsAwarded.Count()
+
+		receipt := validReceipt
+		receipt.Items = []models.Item{{ShortDescription: "Item 1", Price: "10.00"}}
+		invalid := receipt
+		invalid.PurchaseDate = "yesterday"
+
+		for _, r := range []models.Receipt{receipt, invalid} {
+			body, _ := json.Marshal(r)
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		if got := receiptsProcessed.Value() - processedBefore; got != 1 {
+			t.Errorf("expected 1 processed receipt, got %v", got)
+		}
+		if got := receiptsRejected.Value("invalid_date") - rejectedBefore; got != 1 {
+			t.Errorf("expected 1 invalid_date rejection, got %v", got)
+		}
+		if got := pointsAwarded.Count() - pointsBefore; got != 1 {
+			t.Errorf("expected 1 points observation, got %d", got)
+		}
+	})
+
+	t.Run("tenant quota exceeded", func(t *testing.T) {
+		store := store.NewStore()
+		store.SetQuota("tenant-a", 1)
+		handler := NewProcessHandler(store)
+
+		receipt := validReceipt
+		receipt.Items = []models.Item{{ShortDescription: "Item 1", Price: "10.00"}}
+
+		codes := []int{http.StatusOK, http.StatusTooManyRequests}
+		for _, expected := range codes {
+			body, _ := json.Marshal(receipt)
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			req = req.WithContext(tenant.NewContext(req.Context(), "tenant-a"))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != expected {
+				t.Errorf("expected status %d, got %d", expected, rr.Code)
+			}
+		}
+	})
 }
 
 func TestValidateMoneyFormat(t *testing.T) {
 	testCases := []struct {
 		name    string
 		amount  string
+		digits  int
 		isValid bool
 	}{
-		{"valid amount", "10.00", true},
-		{"no decimal", "10", false},
-		{"too many decimals", "10.000", false},
-		{"non-numeric", "abc.def", false},
-		{"single decimal", "10.0", false},
-		{"empty string", "", false},
+		{"valid amount", "10.00", 2, true},
+		{"no decimal", "10", 2, false},
+		{"too many decimals", "10.000", 2, false},
+		{"non-numeric", "abc.def", 2, false},
+		{"single decimal", "10.0", 2, false},
+		{"empty string", "", 2, false},
+		{"negative amount", "-1.00", 2, true},
+		{"whole yen", "1200", 0, true},
+		{"yen with decimals", "1200.00", 0, false},
+		{"three decimals for dinar", "1.250", 3, true},
+		{"two decimals for dinar", "1.25", 3, false},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := validateMoneyFormat(tc.amount)
+			err := validateMoneyFormat(tc.amount, tc.digits)
 			if tc.isValid && err != nil {
 				t.Errorf("expected valid, got error: %v", err)
 			}
@@ -265,3 +372,215 @@ func TestValidateMoneyFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessHandlerCurrency(t *testing.T) {
+	table, err := currency.NewTable("USD", []currency.Rate{
+		{Currency: "JPY", Rate: "0.0075", Effective: "2022-01-01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := currency.Default
+	currency.Default = table
+	t.Cleanup(func() { currency.Default = previous })
+
+	receipt := models.Receipt{
+		Retailer:     "Lawson",
+		PurchaseDate: "2023-10-01",
+		PurchaseTime: "15:00",
+		Currency:     "JPY",
+		Items:        []models.Item{{ShortDescription: "Onigiri", Price: "1200"}},
+		Total:        "1200",
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(r *models.Receipt)
+		status int
+		code   string
+	}{
+		{"whole yen", func(r *models.Receipt) {}, http.StatusOK, ""},
+		{"yen with decimals", func(r *models.Receipt) {
+			r.Items[0].Price = "1200.00"
+			r.Total = "1200.00"
+		}, http.StatusBadRequest, "invalid_total"},
+		{"unknown currency", func(r *models.Receipt) { r.Currency = "XYZ" }, http.StatusBadRequest, "invalid_currency"},
+		{"lowercase currency", func(r *models.Receipt) { r.Currency = "jpy" }, http.StatusBadRequest, "invalid_currency"},
+		{"no rate", func(r *models.Receipt) {
+			r.Currency = "EUR"
+			r.Items[0].Price = "12.00"
+			r.Total = "12.00"
+		}, http.StatusBadRequest, "no_exchange_rate"},
+		{"before the first rate", func(r *models.Receipt) { r.PurchaseDate = "2021-12-31" }, http.StatusBadRequest, "no_exchange_rate"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := receipt
+			r.Items = append([]models.Item(nil), receipt.Items...)
+			tc.modify(&r)
+
+			handler := NewProcessHandler(store.NewStore())
+			body, _ := json.Marshal(r)
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			var response map[string]string
+			json.NewDecoder(rr.Body).Decode(&response)
+			if response["code"] != tc.code {
+				t.Errorf("expected code %q, got %q", tc.code, response["code"])
+			}
+		})
+	}
+}
+
+func TestProcessHandlerTimeZone(t *testing.T) {
+	testCases := []struct {
+		name        string
+		date, clock string
+		zone        string
+		status      int
+		code        string
+		purchasedAt string
+	}{
+		{"no zone is UTC", "2022-03-13", "02:30", "", http.StatusOK, "", "2022-03-13T02:30:00Z"},
+		{"IANA name", "2022-03-13", "14:30", "America/Chicago", http.StatusOK, "", "2022-03-13T19:30:00Z"},
+		{"UTC offset", "2022-03-13", "01:00", "+05:30", http.StatusOK, "", "2022-03-12T19:30:00Z"},
+		{"unknown zone", "2022-03-13", "14:30", "America/Springfield", http.StatusBadRequest, "invalid_time_zone", ""},
+		{"skipped by daylight saving", "2022-03-13", "02:30", "America/Chicago", http.StatusBadRequest, "nonexistent_time", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := store.NewStore()
+			handler := NewProcessHandler(s)
+			receipt := models.Receipt{
+				Retailer:     "Target",
+				PurchaseDate: tc.date,
+				PurchaseTime: tc.clock,
+				TimeZone:     tc.zone,
+				Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.00"}},
+				Total:        "1.00",
+			}
+			body, _ := json.Marshal(receipt)
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			var response map[string]string
+			json.NewDecoder(rr.Body).Decode(&response)
+			if response["code"] != tc.code {
+				t.Errorf("expected code %q, got %q", tc.code, response["code"])
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			record, err := s.GetRecord(req.Context(), tenant.Default, response["id"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if at := record.Metadata.PurchasedAt; at == nil || at.Format(time.RFC3339) != tc.purchasedAt {
+				t.Errorf("expected purchasedAt %s, got %v", tc.purchasedAt, at)
+			}
+		})
+	}
+}
+
+func TestProcessHandlerCanonicalRetailer(t *testing.T) {
+	registry, err := retailer.NewRegistry([]retailer.Retailer{
+		{ID: "target", Name: "Target", Category: "general", Aliases: []string{"Target #*"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := retailer.Default
+	retailer.Default = registry
+	t.Cleanup(func() { retailer.Default = previous })
+
+	s := store.NewStore()
+	handler := NewProcessHandler(s)
+	for name, expected := range map[string]*models.CanonicalRetailer{
+		"Target #1234": {ID: "target", Name: "Target", Category: "general"},
+		"Walgreens":    nil,
+	} {
+		receipt := models.Receipt{
+			Retailer:     name,
+			PurchaseDate: "2022-01-01",
+			PurchaseTime: "13:01",
+			Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.00"}},
+			Total:        "1.00",
+		}
+		record, err := handler.Submit(context.Background(), tenant.Default, receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, _ := s.GetRecord(context.Background(), tenant.Default, record.ID)
+		if stored.Receipt.Retailer != name {
+			t.Errorf("expected the submitted name %q to be kept, got %q", name, stored.Receipt.Retailer)
+		}
+		if !reflect.DeepEqual(stored.Metadata.Retailer, expected) {
+			t.Errorf("%q: expected canonical retailer %+v, got %+v", name, expected, stored.Metadata.Retailer)
+		}
+	}
+}
+
+func TestProcessHandlerFraudHold(t *testing.T) {
+	s := store.NewStore()
+	handler := NewProcessHandler(s)
+	config := fraud.DefaultConfig
+	config.HoldScore = config.Weights.FutureDate
+	handler.Fraud = fraud.NewAssessor(config)
+
+	submit := func(date string) map[string]any {
+		body := `{"retailer":"Target","purchaseDate":"` + date + `","purchaseTime":"13:01","timeZone":"UTC",` +
+			`"items":[{"shortDescription":"Pepsi","price":"1.25"}],"total":"1.25"}`
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", strings.NewReader(body))
+		req = req.WithContext(fraud.NewMemberContext(req.Context(), "alice"))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", date, rr.Code, rr.Body)
+		}
+		var response map[string]any
+		json.NewDecoder(rr.Body).Decode(&response)
+		return response
+	}
+
+	response := submit("2022-01-01")
+	if _, held := response["held"]; held {
+		t.Errorf("expected a past receipt not to be held, got %v", response)
+	}
+	record, _ := s.GetRecord(context.Background(), tenant.Default, response["id"].(string))
+	if record.Metadata.Risk == nil || record.Held() {
+		t.Errorf("expected an unheld risk assessment, got %+v", record.Metadata.Risk)
+	}
+
+	future := time.Now().UTC().AddDate(0, 0, 7).Format("2006-01-02")
+	response = submit(future)
+	if response["held"] != true {
+		t.Fatalf("expected a future receipt to be held, got %v", response)
+	}
+	record, _ = s.GetRecord(context.Background(), tenant.Default, response["id"].(string))
+	expected := &models.Risk{Score: config.HoldScore, Reasons: []string{fraud.ReasonFutureDate}, Held: true}
+	if !reflect.DeepEqual(record.Metadata.Risk, expected) {
+		t.Errorf("expected risk %+v, got %+v", expected, record.Metadata.Risk)
+	}
+
+	points := NewPointsHandler(s, nil)
+	ctx := context.WithValue(context.Background(), "receipt_id", record.ID)
+	rr := httptest.NewRecorder()
+	points.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), `"code":"points_held"`) {
+		t.Errorf("expected 409 points_held for held points, got %d: %s", rr.Code, rr.Body)
+	}
+}
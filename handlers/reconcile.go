@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/receipt-processor/currency"
+	"github.com/receipt-processor/models"
+)
+
+// ReconcilePolicy decides what happens to a receipt whose total does not
+// match its items, discounts, tax and tip.
+type ReconcilePolicy string
+
+const (
+	// ReconcileReject fails the submission with ErrTotalMismatch.
+	ReconcileReject ReconcilePolicy = "reject"
+	// ReconcileWarn stores the receipt without points and warns the
+	// submitter.
+	ReconcileWarn ReconcilePolicy = "warn"
+	// ReconcileReview stores the receipt flagged for manual review.
+	ReconcileReview ReconcilePolicy = "review"
+)
+
+// DefaultReconcilePolicy accepts mismatched receipts with a warning, so
+// submissions that were valid before reconciliation existed still are,
+// but they earn no points.
+const DefaultReconcilePolicy = ReconcileWarn
+
+// Reconciliation outcomes recorded in a receipt's metadata.
+const (
+	OutcomeAccepted = models.OutcomeAccepted
+	OutcomeWarned   = models.OutcomeWarned
+	OutcomeFlagged  = models.OutcomeFlagged
+)
+
+var ErrTotalMismatch = errors.New("total does not equal items less discounts plus tax and tip")
+
+func (p ReconcilePolicy) Valid() bool {
+	switch p {
+	case ReconcileReject, ReconcileWarn, ReconcileReview:
+		return true
+	}
+	return false
+}
+
+// reconcile compares a validated receipt's total with its components in
+// exact minor units of its currency and applies the policy. A balanced
+// receipt is always accepted.
+func reconcile(receipt models.Receipt, policy ReconcilePolicy) (models.Reconciliation, error) {
+	digits, _ := currency.MinorUnits(currency.Code(receipt.Currency))
+	expected := expectedTotal(receipt, digits)
+	total, _ := currency.ParseSignedAmount(receipt.Total, digits)
+	result := models.Reconciliation{
+		Balanced:   total == expected,
+		Expected:   currency.FormatAmount(expected, digits),
+		Difference: currency.FormatAmount(total-expected, digits),
+		Outcome:    OutcomeAccepted,
+	}
+	if result.Balanced {
+		return result, nil
+	}
+
+	switch policy {
+	case ReconcileReject:
+		return result, fmt.Errorf("%w: expected %s, got %s", ErrTotalMismatch, result.Expected, receipt.Total)
+	case ReconcileReview:
+		result.Outcome = OutcomeFlagged
+	default:
+		result.Outcome = OutcomeWarned
+	}
+	return result, nil
+}
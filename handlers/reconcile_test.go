@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+func TestReconcile(t *testing.T) {
+	receipt := models.Receipt{
+		Items:     []models.Item{{Price: "6.49"}, {Price: "1.25"}},
+		Discounts: []models.Discount{{Description: "Coupon", Amount: "0.50"}},
+		Tax:       "0.60",
+		Total:     "7.84",
+	}
+
+	testCases := []struct {
+		name     string
+		total    string
+		policy   ReconcilePolicy
+		expected models.Reconciliation
+		err      error
+	}{
+		{"balanced", "7.84", ReconcileReject,
+			models.Reconciliation{Balanced: true, Expected: "7.84", Difference: "0.00", Outcome: OutcomeAccepted}, nil},
+		{"over by a cent warns", "7.85", ReconcileWarn,
+			models.Reconciliation{Expected: "7.84", Difference: "0.01", Outcome: OutcomeWarned}, nil},
+		{"under flags for review", "1.00", ReconcileReview,
+			models.Reconciliation{Expected: "7.84", Difference: "-6.84", Outcome: OutcomeFlagged}, nil},
+		{"rejected", "1000.00", ReconcileReject,
+			models.Reconciliation{Expected: "7.84", Difference: "992.16", Outcome: OutcomeAccepted}, ErrTotalMismatch},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := receipt
+			r.Total = tc.total
+			result, err := reconcile(r, tc.policy)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if result != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestProcessHandlerReconciliation(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.00"}},
+		Total:        "1000.00",
+	}
+
+	testCases := []struct {
+		policy   ReconcilePolicy
+		status   int
+		response string
+		outcome  string
+		held     bool
+		points   int
+	}{
+		{ReconcileWarn, http.StatusOK, OutcomeWarned, OutcomeWarned, false, 0},
+		{ReconcileReview, http.StatusOK, OutcomeFlagged, OutcomeFlagged, true, 87},
+		{ReconcileReject, http.StatusBadRequest, "", "", false, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			s := store.NewStore()
+			handler := NewProcessHandler(s)
+			handler.Reconcile = tc.policy
+			body, _ := json.Marshal(receipt)
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, rr.Code)
+			}
+			var response map[string]any
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if tc.status != http.StatusOK {
+				if response["code"] != "total_mismatch" {
+					t.Errorf("expected code total_mismatch, got %q", response["code"])
+				}
+				return
+			}
+			if response["reconciliation"] != tc.response {
+				t.Errorf("expected reconciliation %q, got %q", tc.response, response["reconciliation"])
+			}
+
+			if held, _ := response["held"].(bool); held != tc.held {
+				t.Errorf("expected held %v, got %v", tc.held, response["held"])
+			}
+
+			record, err := s.GetRecord(context.Background(), tenant.Default, response["id"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.Held() != tc.held {
+				t.Errorf("expected stored receipt held %v, got review %+v", tc.held, record.Metadata.Review)
+			}
+			if r := record.Metadata.Reconciliation; r == nil || r.Outcome != tc.outcome || r.Difference != "999.00" {
+				t.Errorf("unexpected stored reconciliation %+v", r)
+			}
+			if score := record.Metadata.Score; score == nil || score.Points != tc.points {
+				t.Errorf("expected %d points, got score %+v", tc.points, score)
+			}
+		})
+	}
+}
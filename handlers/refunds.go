@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/receipt-processor/codec"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+	"github.com/receipt-processor/webhook"
+)
+
+var ErrNotCredited = errors.New("receipt points not credited")
+
+// Refund takes back a credited receipt's points on behalf of reviewer,
+// moving it to refunded, and announces receipt.refunded to webhooks.
+func (h *ProcessHandler) Refund(ctx context.Context, tenantID, id, reviewer, reason string) (store.Record, error) {
+	if reviewer == "" {
+		return store.Record{}, ErrReviewerRequired
+	}
+	if strings.TrimSpace(reason) == "" {
+		return store.Record{}, ErrReasonRequired
+	}
+
+	record, err := h.store.Refund(ctx, tenantID, id, models.Refund{Reviewer: reviewer, Reason: reason})
+	if errors.Is(err, store.ErrNotCredited) {
+		return store.Record{}, ErrNotCredited
+	}
+	if err != nil {
+		return store.Record{}, err
+	}
+
+	slog.InfoContext(ctx, "receipt refunded", "tenant", tenantID, "receipt_id", id, "reviewer", reviewer)
+	receiptsRefunded.Inc()
+	if h.Webhooks != nil {
+		h.Webhooks.Publish(webhook.Event{
+			Type:      webhook.EventReceiptRefunded,
+			Tenant:    tenantID,
+			ReceiptID: id,
+		})
+	}
+	return record, nil
+}
+
+// RefundsHandler serves the admin endpoint that refunds a credited
+// receipt's points. Like the review endpoints, every request must carry
+// the admin token as a bearer token and name the reviewer.
+type RefundsHandler struct {
+	Process *ProcessHandler
+	Token   string
+}
+
+func NewRefundsHandler(process *ProcessHandler, token string) *RefundsHandler {
+	return &RefundsHandler{Process: process, Token: token}
+}
+
+type refundResponse struct {
+	ID     string         `json:"id"`
+	State  string         `json:"state"`
+	Refund *models.Refund `json:"refund"`
+}
+
+func (h *RefundsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r, h.Token) {
+		return
+	}
+
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/admin/receipts/"), "/refund")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req decisionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		respondWithRecord(w, codec.JSON, http.StatusBadRequest, errorRecord("The refund is invalid.", ErrInvalidJSON))
+		return
+	}
+	record, err := h.Process.Refund(r.Context(), tenant.FromContext(r.Context()), id, r.Header.Get(ReviewerHeader), req.Reason)
+	switch {
+	case err == nil:
+		respondWithJSON(w, http.StatusOK, refundResponse{ID: record.ID, State: record.State(), Refund: record.Metadata.Refund})
+	case errors.Is(err, store.ErrReceiptNotFound):
+		respondWithError(w, "No receipt found for that ID.", http.StatusNotFound)
+	case errors.Is(err, ErrReviewerRequired):
+		respondWithRecord(w, codec.JSON, http.StatusBadRequest, errorRecord("Name the reviewer in the "+ReviewerHeader+" header.", err))
+	case errors.Is(err, ErrReasonRequired):
+		respondWithRecord(w, codec.JSON, http.StatusBadRequest, errorRecord("A reason is required.", err))
+	case errors.Is(err, ErrNotCredited):
+		respondWithRecord(w, codec.JSON, http.StatusConflict, errorRecord("Only credited points can be refunded.", err))
+	default:
+		respondWithError(w, "Unable to refund the receipt.", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+	"github.com/receipt-processor/webhook"
+)
+
+func TestRefundsHandler(t *testing.T) {
+	s := store.NewStore()
+	process := NewProcessHandler(s)
+	handler := NewRefundsHandler(process, "secret")
+
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.25"}},
+		Total:        "1.25",
+	}
+	record, err := process.Submit(tenant.NewContext(context.Background(), "acme"), "acme", receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan webhook.Event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event webhook.Event
+		json.Unmarshal(body, &event)
+		received <- event
+	}))
+	defer receiver.Close()
+	dispatcher := webhook.NewDispatcher(http.DefaultClient, 8)
+	dispatcher.Subscribe("acme", receiver.URL, "secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx, 1)
+	process.Webhooks = dispatcher
+
+	serve := func(method, path, reviewer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(tenant.NewContext(req.Context(), "acme"))
+		req.Header.Set("Authorization", "Bearer secret")
+		if reviewer != "" {
+			req.Header.Set(ReviewerHeader, reviewer)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	path := "/admin/receipts/" + record.ID + "/refund"
+	reason := `{"reason": "Items returned"}`
+
+	testCases := []struct {
+		name, method, path, reviewer, body string
+		status                             int
+		code                               string
+	}{
+		{"no reviewer", http.MethodPost, path, "", reason, http.StatusBadRequest, "reviewer_required"},
+		{"no reason", http.MethodPost, path, "alice", `{}`, http.StatusBadRequest, "reason_required"},
+		{"malformed", http.MethodPost, path, "alice", `{`, http.StatusBadRequest, "invalid_json"},
+		{"unknown receipt", http.MethodPost, "/admin/receipts/unknown/refund", "alice", reason, http.StatusNotFound, ""},
+		{"wrong method", http.MethodGet, path, "alice", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tc := range testCases {
+		rr := serve(tc.method, tc.path, tc.reviewer, tc.body)
+		if rr.Code != tc.status || !strings.Contains(rr.Body.String(), tc.code) {
+			t.Errorf("%s: expected %d %s, got %d: %s", tc.name, tc.status, tc.code, rr.Code, rr.Body)
+		}
+	}
+
+	rr := serve(http.MethodPost, path, "alice", reason)
+	var response refundResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if rr.Code != http.StatusOK || response.State != models.StateRefunded || response.Refund == nil ||
+		response.Refund.Reviewer != "alice" || response.Refund.Reason != "Items returned" {
+		t.Fatalf("expected the receipt to be refunded, got %d %+v", rr.Code, response)
+	}
+
+	select {
+	case event := <-received:
+		if event.Type != webhook.EventReceiptRefunded || event.ReceiptID != record.ID {
+			t.Errorf("unexpected event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the refund webhook to be delivered")
+	}
+
+	pointsCtx := context.WithValue(tenant.NewContext(context.Background(), "acme"), "receipt_id", record.ID)
+	points := httptest.NewRecorder()
+	NewPointsHandler(s, nil).ServeHTTP(points, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(pointsCtx))
+	if points.Code != http.StatusConflict || !strings.Contains(points.Body.String(), "points_refunded") {
+		t.Errorf("expected refunded points to answer 409 points_refunded, got %d: %s", points.Code, points.Body)
+	}
+
+	if rr := serve(http.MethodPost, path, "alice", reason); rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "not_credited") {
+		t.Errorf("expected a second refund to fail with not_credited, got %d: %s", rr.Code, rr.Body)
+	}
+}
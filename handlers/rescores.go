@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/receipt-processor/codec"
+	"github.com/receipt-processor/processor"
+	"github.com/receipt-processor/rescore"
+	"github.com/receipt-processor/tenant"
+)
+
+// Errors reported by the rescore endpoints. ErrInvalidRules rejects rules
+// that processor.LoadRules would refuse to load.
+var (
+	ErrInvalidRules    = errors.New("invalid scoring rules")
+	ErrRescoreRunning  = errors.New("rescore job already running")
+	ErrRescoreFinished = errors.New("rescore job already finished")
+)
+
+// RescoresHandler serves the admin endpoints that start re-scoring jobs
+// and follow or steer them. Like the review endpoints, every request must
+// carry the admin token as a bearer token.
+type RescoresHandler struct {
+	Jobs  *rescore.Manager
+	Token string
+}
+
+func NewRescoresHandler(jobs *rescore.Manager, token string) *RescoresHandler {
+	return &RescoresHandler{Jobs: jobs, Token: token}
+}
+
+// rescoreRequest starts a job. There is no registry of rule versions to
+// choose from: InlineRules is the complete rule set to score with, and its
+// version only labels the scores it records. Without it the tenant's
+// current rules are used.
+type rescoreRequest struct {
+	InlineRules *processor.Rules `json:"inlineRules"`
+	DryRun      bool             `json:"dryRun"`
+}
+
+func (h *RescoresHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r, h.Token) {
+		return
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	id, action, _ := strings.Cut(strings.TrimPrefix(path, "/admin/rescores/"), "/")
+
+	switch {
+	case path == "/admin/rescores" && r.Method == http.MethodGet:
+		respondWithJSON(w, http.StatusOK, h.Jobs.Jobs(tenantID))
+	case path == "/admin/rescores" && r.Method == http.MethodPost:
+		// Unknown fields are refused, so a request naming a version rather
+		// than inline rules does not re-score with the current ones.
+		var req rescoreRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			code := ErrInvalidJSON
+			if strings.HasPrefix(err.Error(), "json: unknown field") {
+				code = ErrUnknownField
+			}
+			respondWithRecord(w, codec.JSON, http.StatusBadRequest, errorRecord("The rescore request is invalid.", code))
+			return
+		}
+		if req.InlineRules != nil {
+			if err := req.InlineRules.Validate(); err != nil {
+				respondWithRecord(w, codec.JSON, http.StatusBadRequest, errorRecord("The rescore rules are invalid: "+err.Error(), ErrInvalidRules))
+				return
+			}
+		}
+		job, err := h.Jobs.Start(r.Context(), tenantID, req.InlineRules, req.DryRun)
+		if err != nil {
+			h.respondError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusAccepted, job.Progress())
+	case path == "/admin/rescores":
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case (action == "" || action == "changes") && r.Method == http.MethodGet:
+		job, err := h.Jobs.Job(tenantID, id)
+		if err != nil {
+			h.respondError(w, err)
+			return
+		}
+		if action == "changes" {
+			respondWithJSON(w, http.StatusOK, job.Changes())
+			return
+		}
+		respondWithJSON(w, http.StatusOK, job.Progress())
+	case (action == "pause" || action == "resume" || action == "cancel") && r.Method == http.MethodPost:
+		job, err := h.Jobs.Job(tenantID, id)
+		if err != nil {
+			h.respondError(w, err)
+			return
+		}
+		var progress rescore.Progress
+		switch action {
+		case "pause":
+			progress, err = job.Pause()
+		case "resume":
+			progress, err = job.Resume()
+		case "cancel":
+			progress, err = job.Cancel()
+		}
+		if err != nil {
+			h.respondError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, progress)
+	case action == "" || action == "changes" || action == "pause" || action == "resume" || action == "cancel":
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *RescoresHandler) respondError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rescore.ErrJobNotFound):
+		respondWithError(w, "No rescore job found for that ID.", http.StatusNotFound)
+	case errors.Is(err, rescore.ErrJobRunning):
+		respondWithRecord(w, codec.JSON, http.StatusConflict, errorRecord("A rescore job is already running.", ErrRescoreRunning))
+	case errors.Is(err, rescore.ErrJobFinished):
+		respondWithRecord(w, codec.JSON, http.StatusConflict, errorRecord("The rescore job has finished.", ErrRescoreFinished))
+	default:
+		respondWithError(w, "Unable to update rescore job.", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/rescore"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+func TestRescoresHandler(t *testing.T) {
+	s := store.NewStore()
+	process := NewProcessHandler(s)
+	handler := NewRescoresHandler(rescore.NewManager(s, nil), "secret")
+
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.25"}},
+		Total:        "1.25",
+	}
+	record, err := process.Submit(tenant.NewContext(context.Background(), "acme"), "acme", receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(tenant.NewContext(req.Context(), "acme"))
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	start := func(body string) rescore.Progress {
+		t.Helper()
+		rr := serve(http.MethodPost, "/admin/rescores", body)
+		var progress rescore.Progress
+		json.NewDecoder(rr.Body).Decode(&progress)
+		if rr.Code != http.StatusAccepted || progress.Status != rescore.StatusRunning {
+			t.Fatalf("expected the job to start, got %d %+v", rr.Code, progress)
+		}
+		deadline := time.Now().Add(time.Second)
+		for progress.Status == rescore.StatusRunning && time.Now().Before(deadline) {
+			json.NewDecoder(serve(http.MethodGet, "/admin/rescores/"+progress.ID, "").Body).Decode(&progress)
+		}
+		if progress.Status != rescore.StatusCompleted {
+			t.Fatalf("expected the job to complete, got %+v", progress)
+		}
+		return progress
+	}
+	points := func() int {
+		ctx := context.WithValue(tenant.NewContext(context.Background(), "acme"), "receipt_id", record.ID)
+		rr := httptest.NewRecorder()
+		NewPointsHandler(s, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		var response models.Points
+		json.NewDecoder(rr.Body).Decode(&response)
+		return response.Points
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/rescores", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without a token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rules := `{"inlineRules": {"version": "v2", "retailerCharPoints": 2}`
+	dryRun := start(rules + `, "dryRun": true}`)
+	if dryRun.Changed != 1 || dryRun.PointsBefore != 37 || dryRun.PointsAfter != 43 {
+		t.Errorf("unexpected dry run %+v", dryRun)
+	}
+	var changes []rescore.Change
+	json.NewDecoder(serve(http.MethodGet, "/admin/rescores/"+dryRun.ID+"/changes", "").Body).Decode(&changes)
+	if len(changes) != 1 || changes[0].ID != record.ID || changes[0].NewPoints != 43 {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+	if got := points(); got != 37 {
+		t.Errorf("expected a dry run to leave points at 37, got %d", got)
+	}
+
+	start(rules + `}`)
+	if got := points(); got != 43 {
+		t.Errorf("expected re-scored points of 43, got %d", got)
+	}
+
+	var jobs []rescore.Progress
+	json.NewDecoder(serve(http.MethodGet, "/admin/rescores", "").Body).Decode(&jobs)
+	if len(jobs) != 2 || jobs[0].ID != dryRun.ID {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+
+	testCases := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{http.MethodPost, "/admin/rescores/" + dryRun.ID + "/pause", "", http.StatusConflict, "rescore_finished"},
+		{http.MethodPost, "/admin/rescores/" + dryRun.ID + "/cancel", "", http.StatusConflict, "rescore_finished"},
+		{http.MethodPost, "/admin/rescores/unknown/resume", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/admin/rescores/" + dryRun.ID + "/pause", "", http.StatusMethodNotAllowed, ""},
+		{http.MethodPost, "/admin/rescores", "{", http.StatusBadRequest, "invalid_json"},
+		{http.MethodPost, "/admin/rescores", `{"inlineRules": {"afternoonStart": "16:00", "afternoonEnd": "14:00"}}`, http.StatusBadRequest, "invalid_rules"},
+		{http.MethodPost, "/admin/rescores", `{"inlineRules": {"afternoonStart": "2pm"}}`, http.StatusBadRequest, "invalid_rules"},
+		{http.MethodPost, "/admin/rescores", `{"version": "v2"}`, http.StatusBadRequest, "unknown_field"},
+	}
+	for _, tc := range testCases {
+		rr := serve(tc.method, tc.path, tc.body)
+		if rr.Code != tc.status || !strings.Contains(rr.Body.String(), tc.code) {
+			t.Errorf("%s %s: expected %d %s, got %d: %s", tc.method, tc.path, tc.status, tc.code, rr.Code, rr.Body)
+		}
+	}
+}
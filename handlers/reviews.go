@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/receipt-processor/codec"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+	"github.com/receipt-processor/webhook"
+)
+
+// ReviewerHeader names the reviewer making an admin review request.
+const ReviewerHeader = "X-Reviewer-ID"
+
+// Reasons a receipt is held for review.
+const (
+	ReviewReasonFraudRisk     = "fraud_risk"
+	ReviewReasonTotalMismatch = "total_mismatch"
+)
+
+var (
+	ErrNotPendingReview = errors.New("receipt is not pending review")
+	ErrReviewClaimed    = errors.New("review claimed by another reviewer")
+	ErrReviewNotClaimed = errors.New("review not claimed by this reviewer")
+	ErrReviewerRequired = errors.New("reviewer not named")
+	ErrReasonRequired   = errors.New("decision reason required")
+)
+
+// holdForReview opens a review for a receipt that reconciliation flagged
+// or whose fraud risk calls for a hold. It returns nil for receipts that
+// can be credited straight away.
+func holdForReview(metadata models.Metadata) *models.Review {
+	var reasons []string
+	if r := metadata.Reconciliation; r != nil && r.Outcome == OutcomeFlagged {
+		reasons = append(reasons, ReviewReasonTotalMismatch)
+	}
+	if r := metadata.Risk; r != nil && r.Held {
+		reasons = append(reasons, ReviewReasonFraudRisk)
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return &models.Review{
+		Status:  models.ReviewPending,
+		Reasons: reasons,
+		Audit:   []models.ReviewEntry{{Action: models.ReviewActionHeld, At: time.Now().UTC()}},
+	}
+}
+
+// Claim assigns a pending review to reviewer, so no one else decides it.
+// Claiming a review the reviewer already holds changes nothing.
+func (h *ProcessHandler) Claim(ctx context.Context, tenantID, id, reviewer string) (store.Record, error) {
+	if reviewer == "" {
+		return store.Record{}, ErrReviewerRequired
+	}
+	record, err := h.store.UpdateMetadata(ctx, tenantID, id, func(m *models.Metadata) error {
+		if m.Review == nil || m.Review.Status != models.ReviewPending {
+			return ErrNotPendingReview
+		}
+		switch m.Review.Reviewer {
+		case reviewer:
+			return nil
+		case "":
+		default:
+			return ErrReviewClaimed
+		}
+		m.Review = m.Review.With(models.ReviewEntry{Action: models.ReviewActionClaimed, Reviewer: reviewer, At: time.Now().UTC()})
+		m.Review.Reviewer = reviewer
+		return nil
+	})
+	if err != nil {
+		return store.Record{}, err
+	}
+	slog.InfoContext(ctx, "review claimed", "tenant", tenantID, "receipt_id", id, "reviewer", reviewer)
+	return record, nil
+}
+
+// Decide approves or rejects a pending review claimed by reviewer.
+// Approval credits the receipt's points as if it had never been held;
+// rejection voids them and announces receipt.voided to webhooks.
+func (h *ProcessHandler) Decide(ctx context.Context, tenantID, id, reviewer string, approve bool, reason string) (store.Record, error) {
+	if reviewer == "" {
+		return store.Record{}, ErrReviewerRequired
+	}
+	if strings.TrimSpace(reason) == "" {
+		return store.Record{}, ErrReasonRequired
+	}
+
+	status, action, state := models.ReviewRejected, models.ReviewActionRejected, models.StateVoided
+	if approve {
+		status, action, state = models.ReviewApproved, models.ReviewActionApproved, models.StateCredited
+	}
+	record, err := h.store.UpdateMetadata(ctx, tenantID, id, func(m *models.Metadata) error {
+		if m.Review == nil || m.Review.Status != models.ReviewPending {
+			return ErrNotPendingReview
+		}
+		if m.Review.Reviewer != reviewer {
+			return ErrReviewNotClaimed
+		}
+		now := time.Now().UTC()
+		m.Review = m.Review.With(models.ReviewEntry{Action: action, Reviewer: reviewer, Reason: reason, At: now})
+		m.Review.Status = status
+		if m.Lifecycle != nil {
+			m.Lifecycle = m.Lifecycle.To(state, now)
+		}
+		return nil
+	})
+	if err != nil {
+		return store.Record{}, err
+	}
+
+	slog.InfoContext(ctx, "review decided", "tenant", tenantID, "receipt_id", id, "reviewer", reviewer, "decision", status)
+	receiptsReviewed.Inc(status)
+	if approve {
+		h.credit(tenantID, record, record.Points(h.Tenants.Calculator(tenantID)))
+	} else if h.Webhooks != nil {
+		h.Webhooks.Publish(webhook.Event{
+			Type:      webhook.EventReceiptVoided,
+			Tenant:    tenantID,
+			ReceiptID: id,
+		})
+	}
+	return record, nil
+}
+
+// ReviewsHandler serves the admin endpoints reviewers use to work through
+// held receipts. Every request must carry the admin token as a bearer
+// token; without a token configured the endpoints do not exist.
+type ReviewsHandler struct {
+	Process *ProcessHandler
+	Token   string
+}
+
+func NewReviewsHandler(process *ProcessHandler, token string) *ReviewsHandler {
+	return &ReviewsHandler{Process: process, Token: token}
+}
+
+type reviewItem struct {
+	ID             string                 `json:"id"`
+	Receipt        models.Receipt         `json:"receipt"`
+	State          string                 `json:"state"`
+	Review         *models.Review         `json:"review"`
+	Risk           *models.Risk           `json:"risk,omitempty"`
+	Reconciliation *models.Reconciliation `json:"reconciliation,omitempty"`
+}
+
+type decisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// authorizeAdmin checks that r carries token as a bearer token, answering
+// it otherwise: 404 when no token is configured, 401 when it is missing or
+// wrong.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		respondWithError(w, "A valid admin token is required.", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (h *ReviewsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r, h.Token) {
+		return
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+	reviewer := r.Header.Get(ReviewerHeader)
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	id, action, _ := strings.Cut(strings.TrimPrefix(path, "/admin/reviews/"), "/")
+
+	switch {
+	case path == "/admin/reviews" && r.Method == http.MethodGet:
+		h.list(w, r, tenantID)
+	case path == "/admin/reviews":
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case action == "" && r.Method == http.MethodGet:
+		record, err := h.Process.store.GetRecord(r.Context(), tenantID, id)
+		if err != nil || record.Metadata.Review == nil {
+			respondWithError(w, "No review found for that ID.", http.StatusNotFound)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, newReviewItem(record))
+	case action == "claim" && r.Method == http.MethodPost:
+		record, err := h.Process.Claim(r.Context(), tenantID, id, reviewer)
+		h.respond(w, record, err)
+	case (action == "approve" || action == "reject") && r.Method == http.MethodPost:
+		var req decisionRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			respondWithRecord(w, codec.JSON, http.StatusBadRequest, errorRecord("The decision is invalid.", ErrInvalidJSON))
+			return
+		}
+		record, err := h.Process.Decide(r.Context(), tenantID, id, reviewer, action == "approve", req.Reason)
+		h.respond(w, record, err)
+	case action == "" || action == "claim" || action == "approve" || action == "reject":
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// list returns the reviews with the requested status, pending by default,
+// longest-waiting first.
+func (h *ReviewsHandler) list(w http.ResponseWriter, r *http.Request, tenantID string) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.ReviewPending
+	case models.ReviewPending, models.ReviewApproved, models.ReviewRejected:
+	default:
+		respondWithError(w, "Unknown review status.", http.StatusBadRequest)
+		return
+	}
+
+	items := []reviewItem{}
+	for _, record := range h.Process.store.List(r.Context(), tenantID) {
+		if review := record.Metadata.Review; review != nil && review.Status == status {
+			items = append(items, newReviewItem(record))
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Review.Audit[0].At.Before(items[j].Review.Audit[0].At)
+	})
+	respondWithJSON(w, http.StatusOK, items)
+}
+
+func (h *ReviewsHandler) respond(w http.ResponseWriter, record store.Record, err error) {
+	switch {
+	case err == nil:
+		respondWithJSON(w, http.StatusOK, newReviewItem(record))
+	case errors.Is(err, store.ErrReceiptNotFound):
+		respondWithError(w, "No review found for that ID.", http.StatusNotFound)
+	case errors.Is(err, ErrReviewerRequired):
+		respondWithRecord(w, codec.JSON, http.StatusBadRequest, errorRecord("Name the reviewer in the "+ReviewerHeader+" header.", err))
+	case errors.Is(err, ErrReasonRequired):
+		respondWithRecord(w, codec.JSON, http.StatusBadRequest, errorRecord("A reason is required.", err))
+	case errors.Is(err, ErrNotPendingReview):
+		respondWithRecord(w, codec.JSON, http.StatusConflict, errorRecord("The receipt is not pending review.", err))
+	case errors.Is(err, ErrReviewClaimed):
+		respondWithRecord(w, codec.JSON, http.StatusConflict, errorRecord("Another reviewer has claimed the receipt.", err))
+	case errors.Is(err, ErrReviewNotClaimed):
+		respondWithRecord(w, codec.JSON, http.StatusConflict, errorRecord("Claim the receipt before deciding it.", err))
+	default:
+		respondWithError(w, "Unable to update review.", http.StatusInternalServerError)
+	}
+}
+
+func newReviewItem(record store.Record) reviewItem {
+	return reviewItem{
+		ID:             record.ID,
+		Receipt:        record.Receipt,
+		State:          record.State(),
+		Review:         record.Metadata.Review,
+		Risk:           record.Metadata.Risk,
+		Reconciliation: record.Metadata.Reconciliation,
+	}
+}
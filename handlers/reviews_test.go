@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+func TestReviewsHandler(t *testing.T) {
+	s := store.NewStore()
+	process := NewProcessHandler(s)
+	process.Reconcile = ReconcileReview
+	handler := NewReviewsHandler(process, "secret")
+
+	submit := func() string {
+		receipt := models.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: "2022-01-01",
+			PurchaseTime: "13:01",
+			Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.00"}},
+			Total:        "1000.00",
+		}
+		record, err := process.Submit(tenant.NewContext(context.Background(), "acme"), "acme", receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !record.Held() {
+			t.Fatalf("expected a flagged receipt to be held, got %+v", record.Metadata.Review)
+		}
+		return record.ID
+	}
+
+	serve := func(method, path, reviewer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(tenant.NewContext(req.Context(), "acme"))
+		req.Header.Set("Authorization", "Bearer secret")
+		if reviewer != "" {
+			req.Header.Set(ReviewerHeader, reviewer)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	expectCode := func(rr *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+		if rr.Code != status || !strings.Contains(rr.Body.String(), `"code":"`+code+`"`) {
+			t.Errorf("expected %d %s, got %d: %s", status, code, rr.Code, rr.Body)
+		}
+	}
+	points := func(id string) *httptest.ResponseRecorder {
+		ctx := context.WithValue(tenant.NewContext(context.Background(), "acme"), "receipt_id", id)
+		rr := httptest.NewRecorder()
+		NewPointsHandler(s, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		return rr
+	}
+	list := func(status string) []reviewItem {
+		var items []reviewItem
+		json.NewDecoder(serve(http.MethodGet, "/admin/reviews?status="+status, "", "").Body).Decode(&items)
+		return items
+	}
+
+	approved, rejected := submit(), submit()
+
+	t.Run("admin token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/reviews", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d without a token, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		rr = httptest.NewRecorder()
+		NewReviewsHandler(process, "").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/reviews", nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status %d with reviews disabled, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("list pending", func(t *testing.T) {
+		items := list("")
+		if len(items) != 2 || items[0].ID != approved || items[1].ID != rejected {
+			t.Fatalf("expected both receipts oldest first, got %+v", items)
+		}
+		if !reflect.DeepEqual(items[0].Review.Reasons, []string{ReviewReasonTotalMismatch}) || items[0].Reconciliation == nil {
+			t.Errorf("expected the hold reason and reconciliation, got %+v", items[0])
+		}
+		expectCode(points(approved), http.StatusConflict, "points_held")
+	})
+
+	t.Run("claim", func(t *testing.T) {
+		expectCode(serve(http.MethodPost, "/admin/reviews/"+approved+"/claim", "", ""), http.StatusBadRequest, "reviewer_required")
+		expectCode(serve(http.MethodPost, "/admin/reviews/"+approved+"/approve", "alice", `{"reason":"ok"}`), http.StatusConflict, "review_not_claimed")
+
+		if rr := serve(http.MethodPost, "/admin/reviews/"+approved+"/claim", "alice", ""); rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body)
+		}
+		if rr := serve(http.MethodPost, "/admin/reviews/"+approved+"/claim", "alice", ""); rr.Code != http.StatusOK {
+			t.Errorf("expected claiming again to succeed, got %d: %s", rr.Code, rr.Body)
+		}
+		expectCode(serve(http.MethodPost, "/admin/reviews/"+approved+"/claim", "bob", ""), http.StatusConflict, "review_claimed")
+		expectCode(serve(http.MethodPost, "/admin/reviews/"+approved+"/approve", "bob", `{"reason":"ok"}`), http.StatusConflict, "review_not_claimed")
+	})
+
+	t.Run("approve", func(t *testing.T) {
+		expectCode(serve(http.MethodPost, "/admin/reviews/"+approved+"/approve", "alice", `{"reason":" "}`), http.StatusBadRequest, "reason_required")
+
+		rr := serve(http.MethodPost, "/admin/reviews/"+approved+"/approve", "alice", `{"reason":"Register receipt checked"}`)
+		var item reviewItem
+		json.NewDecoder(rr.Body).Decode(&item)
+		if rr.Code != http.StatusOK || item.Review.Status != models.ReviewApproved {
+			t.Fatalf("expected the review to be approved, got %d: %+v", rr.Code, item.Review)
+		}
+		var actions []string
+		for _, entry := range item.Review.Audit {
+			actions = append(actions, entry.Action+":"+entry.Reviewer+":"+entry.Reason)
+		}
+		expected := []string{"held::", "claimed:alice:", "approved:alice:Register receipt checked"}
+		if !reflect.DeepEqual(actions, expected) {
+			t.Errorf("expected audit trail %v, got %v", expected, actions)
+		}
+
+		record, _ := s.GetRecord(context.Background(), "acme", approved)
+		var states []string
+		for _, transition := range record.History() {
+			states = append(states, transition.State)
+		}
+		if expected := []string{"received", "validated", "scored", "held", "credited"}; item.State != models.StateCredited || !reflect.DeepEqual(states, expected) {
+			t.Errorf("expected lifecycle %v ending credited, got %s %v", expected, item.State, states)
+		}
+
+		if rr := points(approved); rr.Code != http.StatusOK {
+			t.Errorf("expected approved points to be credited, got %d: %s", rr.Code, rr.Body)
+		}
+		expectCode(serve(http.MethodPost, "/admin/reviews/"+approved+"/reject", "alice", `{"reason":"changed my mind"}`), http.StatusConflict, "not_pending_review")
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		serve(http.MethodPost, "/admin/reviews/"+rejected+"/claim", "bob", "")
+		if rr := serve(http.MethodPost, "/admin/reviews/"+rejected+"/reject", "bob", `{"reason":"Total does not match"}`); rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body)
+		}
+		expectCode(points(rejected), http.StatusConflict, "points_voided")
+	})
+
+	t.Run("list decided", func(t *testing.T) {
+		if items := list(models.ReviewPending); len(items) != 0 {
+			t.Errorf("expected no pending reviews, got %+v", items)
+		}
+		if items := list(models.ReviewApproved); len(items) != 1 || items[0].ID != approved {
+			t.Errorf("expected the approved review, got %+v", items)
+		}
+		if items := list(models.ReviewRejected); len(items) != 1 || items[0].Review.Reviewer != "bob" {
+			t.Errorf("expected the rejected review, got %+v", items)
+		}
+		if rr := serve(http.MethodGet, "/admin/reviews?status=lost", "", ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for an unknown status, got %d", rr.Code)
+		}
+		if rr := serve(http.MethodGet, "/admin/reviews/"+rejected, "", ""); rr.Code != http.StatusOK {
+			t.Errorf("expected status 200 for a single review, got %d", rr.Code)
+		}
+		if rr := serve(http.MethodGet, "/admin/reviews/nonexistent", "", ""); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404 for an unknown receipt, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import "strings"
+
+// Route maps a request path to the route it is served by, collapsing
+// receipt IDs so logs and metrics are grouped per endpoint.
+func Route(path string) string {
+	switch {
+	case path == "/receipts/process", path == "/receipts/process/text", path == "/receipts/stream", path == "/metrics", path == "/healthz", path == "/readyz",
+		path == "/graphql":
+		return path
+	case strings.HasPrefix(path, "/receipts/") && strings.HasSuffix(path, "/points"):
+		return "/receipts/{id}/points"
+	case path == "/webhooks", strings.HasPrefix(path, "/webhooks/"):
+		return "/webhooks"
+	case path == "/admin/reviews", strings.HasPrefix(path, "/admin/reviews/"):
+		return "/admin/reviews"
+	case path == "/admin/rescores", strings.HasPrefix(path, "/admin/rescores/"):
+		return "/admin/rescores"
+	case strings.HasPrefix(path, "/admin/receipts/") && strings.HasSuffix(path, "/refund"):
+		return "/admin/receipts/{id}/refund"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import "testing"
+
+func TestRoute(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/receipts/process", "/receipts/process"},
+		{"/receipts/process/text", "/receipts/process/text"},
+		{"/receipts/abc-123/points", "/receipts/{id}/points"},
+		{"/receipts/stream", "/receipts/stream"},
+		{"/graphql", "/graphql"},
+		{"/metrics", "/metrics"},
+		{"/healthz", "/healthz"},
+		{"/webhooks/dead-letters/abc/redeliver", "/webhooks"},
+		{"/admin/reviews", "/admin/reviews"},
+		{"/admin/reviews/abc-123/approve", "/admin/reviews"},
+		{"/admin/rescores/abc-123/pause", "/admin/rescores"},
+		{"/admin/receipts/abc-123/refund", "/admin/receipts/{id}/refund"},
+		{"/receipts/abc-123", "other"},
+		{"/", "other"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if got := Route(tc.path); got != tc.expected {
+				t.Errorf("expected route %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/receipt-processor/events"
+	"github.com/receipt-processor/tenant"
+)
+
+type StreamHandler struct {
+	Bus       *events.Bus
+	Heartbeat time.Duration
+}
+
+func NewStreamHandler(bus *events.Bus) *StreamHandler {
+	return &StreamHandler{Bus: bus, Heartbeat: 15 * time.Second}
+}
+
+// ServeHTTP streams the caller's processed receipts as Server-Sent Events.
+// Clients resume with Last-Event-ID; a "gap" event tells them the replay
+// buffer no longer covers everything they missed.
+func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			respondWithError(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = parsed
+	}
+
+	filter := events.Filter{
+		Tenant:   tenant.FromContext(r.Context()),
+		Retailer: r.URL.Query().Get("retailer"),
+	}
+	sub, replay, complete := h.Bus.Subscribe(filter, lastID)
+	defer sub.Close()
+
+	// Streams outlive the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprint(w, "event: gap\ndata: {}\n\n")
+	}
+	for _, e := range replay {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case e, ok := <-sub.C:
+			if !ok && h.Bus.Closed() {
+				return
+			}
+			if !ok {
+				slog.WarnContext(r.Context(), "slow stream subscriber dropped", "tenant", filter.Tenant)
+				fmt.Fprint(w, "event: dropped\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			writeEvent(w, e)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %d\nevent: receipt\ndata: %s\n\n", e.ID, data)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/events"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+type sseMessage struct {
+	id    string
+	event string
+	data  string
+}
+
+func readMessage(t *testing.T, reader *bufio.Reader) sseMessage {
+	t.Helper()
+	var msg sseMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && (msg.event != "" || msg.data != ""):
+			return msg
+		case strings.HasPrefix(line, "id: "):
+			msg.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func newStreamServer(t *testing.T, bus *events.Bus, tenantID string) *httptest.Server {
+	handler := NewStreamHandler(bus)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), tenantID)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func openStream(t *testing.T, url string, header http.Header) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func waitForSubscribers(t *testing.T, bus *events.Bus, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for bus.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, bus.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	t.Run("streams processed receipts for the tenant", func(t *testing.T) {
+		bus := events.NewBus(10, 10)
+		server := newStreamServer(t, bus, "acme")
+		stream := openStream(t, server.URL+"?retailer=target", nil)
+		waitForSubscribers(t, bus, 1)
+
+		processHandler := NewProcessHandler(store.NewStore())
+		processHandler.Events = bus
+		for _, submission := range []struct{ tenant, retailer string }{
+			{"globex", "Target"},
+			{"acme", "Walmart"},
+			{"acme", "Target"},
+		} {
+			receipt := models.Receipt{
+				Retailer:     submission.retailer,
+				PurchaseDate: "2022-01-01",
+				PurchaseTime: "13:01",
+				Items:        []models.Item{{ShortDescription: "Item", Price: "1.00"}},
+				Total:        "1.00",
+			}
+			body, _ := json.Marshal(receipt)
+			req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewReader(body))
+			req = req.WithContext(tenant.NewContext(req.Context(), submission.tenant))
+			processHandler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		msg := readMessage(t, stream)
+		var event events.Event
+		if err := json.Unmarshal([]byte(msg.data), &event); err != nil {
+			t.Fatal(err)
+		}
+		if msg.event != "receipt" || msg.id != "3" {
+			t.Errorf("expected receipt event 3, got %+v", msg)
+		}
+		if event.Tenant != "acme" || event.Retailer != "Target" || event.Points == 0 {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	})
+
+	t.Run("resumes from Last-Event-ID", func(t *testing.T) {
+		bus := events.NewBus(10, 10)
+		for i := 0; i < 3; i++ {
+			bus.Publish(events.Event{Tenant: "acme", ReceiptID: "r"})
+		}
+		server := newStreamServer(t, bus, "acme")
+		stream := openStream(t, server.URL, http.Header{"Last-Event-Id": {"1"}})
+
+		for _, expected := range []string{"2", "3"} {
+			if msg := readMessage(t, stream); msg.id != expected {
+				t.Errorf("expected replayed event %s, got %+v", expected, msg)
+			}
+		}
+	})
+
+	t.Run("reports gaps beyond the replay buffer", func(t *testing.T) {
+		bus := events.NewBus(1, 10)
+		for i := 0; i < 3; i++ {
+			bus.Publish(events.Event{Tenant: "acme"})
+		}
+		server := newStreamServer(t, bus, "acme")
+		stream := openStream(t, server.URL+"?lastEventId=1", nil)
+
+		if msg := readMessage(t, stream); msg.event != "gap" {
+			t.Errorf("expected gap event, got %+v", msg)
+		}
+		if msg := readMessage(t, stream); msg.id != "3" {
+			t.Errorf("expected event 3, got %+v", msg)
+		}
+	})
+
+	t.Run("drops slow subscribers", func(t *testing.T) {
+		bus := events.NewBus(0, 1)
+		server := newStreamServer(t, bus, "acme")
+		stream := openStream(t, server.URL, nil)
+		waitForSubscribers(t, bus, 1)
+
+		for i := 0; i < 100 && bus.Subscribers() > 0; i++ {
+			bus.Publish(events.Event{Tenant: "acme", Retailer: strings.Repeat("x", 1<<16)})
+		}
+		if bus.Subscribers() != 0 {
+			t.Fatal("expected the subscriber to be dropped")
+		}
+
+		for {
+			if msg := readMessage(t, stream); msg.event == "dropped" {
+				break
+			}
+		}
+	})
+
+	t.Run("invalid Last-Event-ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/receipts/stream", nil)
+		req.Header.Set("Last-Event-ID", "abc")
+		rr := httptest.NewRecorder()
+		NewStreamHandler(events.NewBus(1, 1)).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/receipt-processor/codec"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/parser"
+	"github.com/receipt-processor/tenant"
+)
+
+// TextHandler accepts receipts as plain-text POS printouts, parses them and
+// submits the result through the process handler.
+type TextHandler struct {
+	Process *ProcessHandler
+}
+
+func NewTextHandler(process *ProcessHandler) *TextHandler {
+	return &TextHandler{Process: process}
+}
+
+// textResponse reports the printout lines the parser skipped alongside the
+// outcome, so a rejected receipt can be traced to what was dropped.
+type textResponse struct {
+	ID       string        `json:"id,omitempty"`
+	Status   string        `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Code     string        `json:"code,omitempty"`
+	Unparsed []parser.Line `json:"unparsedLines"`
+}
+
+func (h *TextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+
+	result, err := h.parse(w, r)
+	if err != nil {
+		h.Process.reject(r.Context(), tenantID, err)
+		respondWithProcessError(w, codec.JSON, err)
+		return
+	}
+
+	unparsed := result.Unparsed
+	if unparsed == nil {
+		unparsed = []parser.Line{}
+	}
+
+	record, err := h.Process.Accept(r.Context(), tenantID, result.Receipt)
+	if err != nil {
+		if IsValidationError(err) {
+			respondWithJSON(w, http.StatusBadRequest, textResponse{
+				Error:    "The receipt is invalid.",
+				Code:     ErrorCode(err),
+				Unparsed: unparsed,
+			})
+			return
+		}
+		respondWithProcessError(w, codec.JSON, err)
+		return
+	}
+
+	if record.State() == models.StateReceived {
+		respondWithJSON(w, http.StatusAccepted, textResponse{ID: record.ID, Status: StatusPending, Unparsed: unparsed})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, textResponse{ID: record.ID, Unparsed: unparsed})
+}
+
+// parse reads a text/plain body, or one without a Content-Type, under the
+// same size limit as other submissions.
+func (h *TextHandler) parse(w http.ResponseWriter, r *http.Request) (parser.Result, error) {
+	if contentType := r.Header.Get("Content-Type"); strings.TrimSpace(contentType) != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "text/plain" {
+			return parser.Result{}, ErrUnsupportedMediaType
+		}
+	}
+	if r.Body == nil {
+		return parser.Result{}, ErrEmptyBody
+	}
+
+	var body io.Reader = r.Body
+	if h.Process.Limits.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.Process.Limits.MaxBodyBytes)
+	}
+
+	result, err := parser.Parse(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return result, ErrBodyTooLarge
+		}
+		return result, fmt.Errorf("%w: %v", ErrMalformedBody, err)
+	}
+	if result.Receipt.Retailer == "" && len(result.Unparsed) == 0 && len(result.Receipt.Items) == 0 &&
+		result.Receipt.Total == "" && result.Receipt.PurchaseDate == "" && result.Receipt.PurchaseTime == "" {
+		return result, ErrEmptyBody
+	}
+	return result, nil
+}
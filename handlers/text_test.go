@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/receipt-processor/jobs"
+	"github.com/receipt-processor/parser"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+const printout = `
+        TARGET
+   1234 Main Street
+01/01/2022        1:01 PM
+Pepsi 12PK            $1.25
+Dasani                 6.49
+TOTAL                  7.74
+`
+
+func TestTextHandler(t *testing.T) {
+	t.Run("invalid HTTP method", func(t *testing.T) {
+		handler := NewTextHandler(NewProcessHandler(store.NewStore()))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+		}
+	})
+
+	t.Run("successful printout", func(t *testing.T) {
+		s := store.NewStore()
+		handler := NewTextHandler(NewProcessHandler(s))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(printout))
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		var response textResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		expected := []parser.Line{{Number: 3, Text: "1234 Main Street"}}
+		if !reflect.DeepEqual(response.Unparsed, expected) {
+			t.Errorf("expected unparsed lines %+v, got %+v", expected, response.Unparsed)
+		}
+
+		receipt, err := s.GetReceipt(context.Background(), tenant.Default, response.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Retailer != "TARGET" || receipt.Total != "7.74" || len(receipt.Items) != 2 {
+			t.Errorf("unexpected receipt %+v", receipt)
+		}
+	})
+
+	t.Run("taxed printout reconciles and scores", func(t *testing.T) {
+		s := store.NewStore()
+		handler := NewTextHandler(NewProcessHandler(s))
+		body := strings.Replace(printout, "TOTAL                  7.74\n",
+			"SUBTOTAL               7.74\nTAX                    0.62\nTOTAL                  8.36\n", 1)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+		var response textResponse
+		json.NewDecoder(rr.Body).Decode(&response)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %+v", http.StatusOK, rr.Code, response)
+		}
+		record, err := s.GetRecord(context.Background(), tenant.Default, response.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := record.Metadata.Reconciliation; r == nil || !r.Balanced || r.Outcome != OutcomeAccepted {
+			t.Errorf("expected the printout to reconcile, got %+v", r)
+		}
+		if record.Receipt.Tax != "0.62" || record.Receipt.Subtotal != "7.74" {
+			t.Errorf("expected the subtotal and tax to be recorded, got %+v", record.Receipt)
+		}
+		if score := record.Metadata.Score; score == nil || score.Points != 19 {
+			t.Errorf("expected 19 points, got score %+v", score)
+		}
+	})
+
+	t.Run("asynchronous mode", func(t *testing.T) {
+		process := NewProcessHandler(store.NewStore())
+		process.Queue = jobs.NewQueue(1)
+		handler := NewTextHandler(process)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(printout)))
+
+		var response textResponse
+		json.NewDecoder(rr.Body).Decode(&response)
+		if rr.Code != http.StatusAccepted || response.Status != StatusPending || response.ID == "" || process.Queue.Len() != 1 {
+			t.Errorf("expected the receipt to be queued, got %d %+v", rr.Code, response)
+		}
+	})
+
+	t.Run("invalid receipt reports unparsed lines", func(t *testing.T) {
+		handler := NewTextHandler(NewProcessHandler(store.NewStore()))
+		body := "TARGET\nsometime yesterday\nPepsi 12PK 1.25\nTOTAL 1.25\n"
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		var response textResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Code != "missing_required_fields" {
+			t.Errorf("expected code missing_required_fields, got %q", response.Code)
+		}
+		if len(response.Unparsed) != 1 || response.Unparsed[0].Text != "sometime yesterday" {
+			t.Errorf("unexpected unparsed lines %+v", response.Unparsed)
+		}
+	})
+
+	t.Run("rejected bodies", func(t *testing.T) {
+		testCases := []struct {
+			name        string
+			contentType string
+			body        string
+			status      int
+		}{
+			{"json content type", "application/json", printout, http.StatusUnsupportedMediaType},
+			{"blank body", "text/plain", "\n  \n---\n", http.StatusBadRequest},
+			{"oversized body", "text/plain", strings.Repeat("Item 1.00\n", int(DefaultLimits.MaxBodyBytes)/10+1), http.StatusRequestEntityTooLarge},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				handler := NewTextHandler(NewProcessHandler(store.NewStore()))
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+				req.Header.Set("Content-Type", tc.contentType)
+				rr := httptest.NewRecorder()
+
+				handler.ServeHTTP(rr, req)
+
+				if rr.Code != tc.status {
+					t.Errorf("expected status %d, got %d", tc.status, rr.Code)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/receipt-processor/tenant"
+	"github.com/receipt-processor/webhook"
+)
+
+type WebhooksHandler struct {
+	Dispatcher *webhook.Dispatcher
+}
+
+func NewWebhooksHandler(d *webhook.Dispatcher) *WebhooksHandler {
+	return &WebhooksHandler{Dispatcher: d}
+}
+
+type subscriptionRequest struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+func (h *WebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID := tenant.FromContext(r.Context())
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch {
+	case path == "/webhooks" && r.Method == http.MethodGet:
+		respondWithJSON(w, http.StatusOK, h.Dispatcher.Subscriptions(tenantID))
+	case path == "/webhooks" && r.Method == http.MethodPost:
+		h.subscribe(w, r, tenantID)
+	case path == "/webhooks/dead-letters" && r.Method == http.MethodGet:
+		respondWithJSON(w, http.StatusOK, h.Dispatcher.DeadLetters(tenantID))
+	case strings.HasPrefix(path, "/webhooks/dead-letters/") && strings.HasSuffix(path, "/redeliver") &&
+		r.Method == http.MethodPost:
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/webhooks/dead-letters/"), "/redeliver")
+		if err := h.Dispatcher.Redeliver(tenantID, id); err != nil {
+			respondWithError(w, "No dead-lettered delivery found for that ID.", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "/webhooks/") && r.Method == http.MethodDelete:
+		id := strings.TrimPrefix(path, "/webhooks/")
+		if err := h.Dispatcher.Unsubscribe(tenantID, id); errors.Is(err, webhook.ErrSubscriptionNotFound) {
+			respondWithError(w, "No subscription found for that ID.", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/webhooks" || strings.HasPrefix(path, "/webhooks/"):
+		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *WebhooksHandler) subscribe(w http.ResponseWriter, r *http.Request, tenantID string) {
+	var req subscriptionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		respondWithError(w, "The subscription is invalid.", http.StatusBadRequest)
+		return
+	}
+
+	switch err := webhook.CheckURL(req.URL); {
+	case errors.Is(err, webhook.ErrInvalidURL):
+		respondWithError(w, "The subscription URL must be an absolute http or https URL.", http.StatusBadRequest)
+		return
+	case errors.Is(err, webhook.ErrForbiddenDestination):
+		respondWithError(w, "The subscription URL must point to a public address.", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.Dispatcher.Subscribe(tenantID, req.URL, req.Secret)
+	if errors.Is(err, webhook.ErrTooManySubscriptions) {
+		respondWithError(w, "The tenant has too many webhook subscriptions.", http.StatusConflict)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, sub)
+}
+
+func respondWithJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
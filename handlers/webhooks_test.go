@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+	"github.com/receipt-processor/webhook"
+)
+
+func TestWebhooksHandler(t *testing.T) {
+	dispatcher := webhook.NewDispatcher(http.DefaultClient, 8)
+	handler := NewWebhooksHandler(dispatcher)
+
+	serve := func(method, path, body, tenantID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(tenant.NewContext(req.Context(), tenantID))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var created webhook.Subscription
+	t.Run("create subscription", func(t *testing.T) {
+		rr := serve(http.MethodPost, "/webhooks", `{"url":"https://crm.example.com/hook"}`, "acme")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		if created.ID == "" || created.Secret == "" {
+			t.Errorf("expected ID and generated secret, got %+v", created)
+		}
+	})
+
+	t.Run("invalid subscription URL", func(t *testing.T) {
+		for _, body := range []string{
+			`{"url":"not a url"}`, `{"url":"ftp://example.com"}`, `{`,
+			`{"url":"http://localhost:8080/hook"}`, `{"url":"http://169.254.169.254/latest/meta-data"}`, `{"url":"https://10.0.0.5/hook"}`,
+		} {
+			if rr := serve(http.MethodPost, "/webhooks", body, "acme"); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status %d, got %d", body, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	t.Run("list is scoped to tenant", func(t *testing.T) {
+		var subs []webhook.Subscription
+		json.NewDecoder(serve(http.MethodGet, "/webhooks", "", "acme").Body).Decode(&subs)
+		if len(subs) != 1 || subs[0].Secret != "" {
+			t.Errorf("expected one subscription without secret, got %+v", subs)
+		}
+
+		json.NewDecoder(serve(http.MethodGet, "/webhooks", "", "globex").Body).Decode(&subs)
+		if len(subs) != 0 {
+			t.Errorf("expected no subscriptions for another tenant, got %+v", subs)
+		}
+	})
+
+	t.Run("dead letters and redelivery", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/webhooks/dead-letters", "", "acme")
+		if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+			t.Errorf("expected empty dead-letter list, got %d %s", rr.Code, rr.Body.String())
+		}
+
+		if rr := serve(http.MethodPost, "/webhooks/dead-letters/missing/redeliver", "", "acme"); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("delete subscription", func(t *testing.T) {
+		if rr := serve(http.MethodDelete, "/webhooks/"+created.ID, "", "globex"); rr.Code != http.StatusNotFound {
+			t.Errorf("expected another tenant's delete to return %d, got %d", http.StatusNotFound, rr.Code)
+		}
+		if rr := serve(http.MethodDelete, "/webhooks/"+created.ID, "", "acme"); rr.Code != http.StatusNoContent {
+			t.Errorf("expected status %d, got %d", http.StatusNoContent, rr.Code)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		if rr := serve(http.MethodPut, "/webhooks", "", "acme"); rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+		}
+	})
+}
+
+func TestProcessHandlerPublishesWebhook(t *testing.T) {
+	received := make(chan webhook.Event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event webhook.Event
+		json.Unmarshal(body, &event)
+		received <- event
+	}))
+	defer receiver.Close()
+
+	dispatcher := webhook.NewDispatcher(http.DefaultClient, 8)
+	dispatcher.Subscribe("acme", receiver.URL, "secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx, 1)
+
+	handler := NewProcessHandler(store.NewStore())
+	handler.Webhooks = dispatcher
+
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Item", Price: "1.00"}},
+		Total:        "1.00",
+	}
+	body, _ := json.Marshal(receipt)
+	req := httptest.NewRequest(http.MethodPost, "/receipts/process", bytes.NewReader(body))
+	req = req.WithContext(tenant.NewContext(req.Context(), "acme"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var response models.ReceiptID
+	json.NewDecoder(rr.Body).Decode(&response)
+
+	select {
+	case event := <-received:
+		if event.ReceiptID != response.ID || event.Tenant != "acme" || event.Points == 0 {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected webhook to be delivered")
+	}
+}
@@ -0,0 +1,73 @@
+// Package jobs queues stored receipts for processing by a bounded pool of
+// workers, so submissions can be acknowledged before they are scored.
+package jobs
+
+import (
+	"context"
+	"sync"
+)
+
+// Job names a stored receipt waiting to be processed, and the member who
+// submitted it.
+type Job struct {
+	Tenant    string
+	ReceiptID string
+	Member    string
+}
+
+// Queue is a bounded FIFO of jobs. It is safe for concurrent use.
+type Queue struct {
+	jobs chan Job
+}
+
+func NewQueue(size int) *Queue {
+	return &Queue{jobs: make(chan Job, size)}
+}
+
+// TryEnqueue adds a job unless the queue is full, and reports whether it
+// did.
+func (q *Queue) TryEnqueue(job Job) bool {
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Enqueue adds a job, waiting for room until ctx is cancelled.
+func (q *Queue) Enqueue(ctx context.Context, job Job) error {
+	select {
+	case q.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Len returns the number of jobs waiting for a worker.
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+// Run hands queued jobs to process with the given number of workers until
+// ctx is cancelled. Jobs still queued then are left for the caller to
+// recover.
+func (q *Queue) Run(ctx context.Context, workers int, process func(context.Context, Job)) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.jobs:
+					process(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueBounded(t *testing.T) {
+	q := NewQueue(2)
+	if !q.TryEnqueue(Job{ReceiptID: "a"}) || !q.TryEnqueue(Job{ReceiptID: "b"}) {
+		t.Fatal("expected room for two jobs")
+	}
+	if q.TryEnqueue(Job{ReceiptID: "c"}) {
+		t.Error("expected a full queue to refuse a job")
+	}
+	if q.Len() != 2 {
+		t.Errorf("expected 2 queued jobs, got %d", q.Len())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Enqueue(ctx, Job{ReceiptID: "c"}); err != context.DeadlineExceeded {
+		t.Errorf("expected Enqueue to wait until the deadline, got %v", err)
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	q := NewQueue(10)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var mu sync.Mutex
+	var active, maxActive int
+	var done sync.WaitGroup
+	done.Add(6)
+	process := func(ctx context.Context, job Job) {
+		defer done.Done()
+		mu.Lock()
+		active++
+		maxActive = max(maxActive, active)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}
+
+	for i := 0; i < 6; i++ {
+		q.Enqueue(ctx, Job{Tenant: "acme"})
+	}
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx, 2, process)
+		close(stopped)
+	}()
+
+	done.Wait()
+	if maxActive > 2 {
+		t.Errorf("expected at most 2 concurrent jobs, got %d", maxActive)
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return once cancelled")
+	}
+}
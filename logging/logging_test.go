@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid JSON log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestLoggerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	logger.InfoContext(NewContext(context.Background(), "req-1"), "hello")
+	logger.InfoContext(context.Background(), "no id")
+
+	lines := decodeLines(t, &buf)
+	if lines[0]["request_id"] != "req-1" {
+		t.Errorf("expected request_id req-1, got %v", lines[0]["request_id"])
+	}
+	if _, ok := lines[1]["request_id"]; ok {
+		t.Errorf("expected no request_id without one in context, got %v", lines[1]["request_id"])
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	route := func(path string) string { return "/route" }
+
+	t.Run("generates request ID and logs access", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := New(&buf, slog.LevelInfo)
+		var seen string
+		handler := Middleware(logger, route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = RequestID(r.Context())
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("short"))
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if seen == "" || rr.Header().Get(RequestIDHeader) != seen {
+			t.Fatalf("expected generated request ID %q to be echoed, got %q", seen, rr.Header().Get(RequestIDHeader))
+		}
+
+		entry := decodeLines(t, &buf)[0]
+		expected := map[string]any{
+			"msg":        "request",
+			"method":     "POST",
+			"route":      "/route",
+			"status":     float64(http.StatusTeapot),
+			"bytes":      float64(5),
+			"request_id": seen,
+		}
+		for key, value := range expected {
+			if entry[key] != value {
+				t.Errorf("expected %s=%v, got %v", key, value, entry[key])
+			}
+		}
+		if _, ok := entry["latency"]; !ok {
+			t.Error("expected latency in access log")
+		}
+	})
+
+	t.Run("propagates incoming request ID", func(t *testing.T) {
+		var buf bytes.Buffer
+		handler := Middleware(New(&buf, slog.LevelInfo), route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "caller-id-42")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get(RequestIDHeader); got != "caller-id-42" {
+			t.Errorf("expected propagated request ID, got %q", got)
+		}
+	})
+
+	t.Run("replaces malformed request ID", func(t *testing.T) {
+		var buf bytes.Buffer
+		handler := Middleware(New(&buf, slog.LevelInfo), route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "bad id\twith spaces")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get(RequestIDHeader); got == "" || got == "bad id\twith spaces" {
+			t.Errorf("expected malformed request ID to be replaced, got %q", got)
+		}
+	})
+}
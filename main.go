@@ -2,27 +2,200 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/receipt-processor/config"
+	"github.com/receipt-processor/currency"
+	"github.com/receipt-processor/events"
+	"github.com/receipt-processor/fraud"
+	"github.com/receipt-processor/graphqlapi"
+	"github.com/receipt-processor/grpcapi"
 	"github.com/receipt-processor/handlers"
+	"github.com/receipt-processor/jobs"
+	"github.com/receipt-processor/logging"
+	"github.com/receipt-processor/metrics"
+	"github.com/receipt-processor/processor"
+	"github.com/receipt-processor/ratelimit"
+	"github.com/receipt-processor/rescore"
+	"github.com/receipt-processor/retailer"
+	"github.com/receipt-processor/server"
 	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+	"github.com/receipt-processor/webhook"
 )
 
 func main() {
+	cfg, printConfig, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+
+	if printConfig {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(cfg.Redacted())
+		return
+	}
+
+	level, _ := cfg.Log.SlogLevel()
+	logger := logging.New(os.Stdout, level)
+	if cfg.Log.Format == "text" {
+		logger = logging.NewText(os.Stdout, level)
+	}
+	slog.SetDefault(logger)
+
 	receiptStore := store.NewStore()
+	recovered := make(chan struct{})
+	if cfg.Store.Backend == "file" {
+		receiptStore = store.Open(cfg.Store.Path)
+		go func() {
+			if err := receiptStore.Recover(); err != nil {
+				logger.Error("recovering store failed", "path", cfg.Store.Path, "error", err)
+				os.Exit(1)
+			}
+			logger.Info("store recovered", "path", cfg.Store.Path, "receipts", receiptStore.Stats().Receipts)
+			close(recovered)
+		}()
+	} else {
+		close(recovered)
+	}
+
+	tenants := tenant.NewRegistry()
+	if cfg.TenantsFile != "" {
+		loaded, err := tenant.LoadFile(cfg.TenantsFile)
+		if err != nil {
+			logger.Error("loading tenants failed", "path", cfg.TenantsFile, "error", err)
+			os.Exit(1)
+		}
+		tenants = loaded
+	}
+	if cfg.RulesFile != "" {
+		rules, err := processor.LoadRules(cfg.RulesFile)
+		if err != nil {
+			logger.Error("loading rules failed", "path", cfg.RulesFile, "error", err)
+			os.Exit(1)
+		}
+		tenants.SetDefaultRules(rules)
+	}
+	rates, err := currency.NewTable(cfg.Currency.Base, nil)
+	if cfg.Currency.RatesFile != "" {
+		rates, err = currency.LoadTable(cfg.Currency.Base, cfg.Currency.RatesFile)
+	}
+	if err != nil {
+		logger.Error("loading exchange rates failed", "path", cfg.Currency.RatesFile, "error", err)
+		os.Exit(1)
+	}
+	currency.Default = rates
+	if cfg.RetailersFile != "" {
+		retailers, err := retailer.LoadFile(cfg.RetailersFile)
+		if err != nil {
+			logger.Error("loading retailers failed", "path", cfg.RetailersFile, "error", err)
+			os.Exit(1)
+		}
+		retailer.Default = retailers
+	}
+	for _, t := range tenants.All() {
+		receiptStore.SetQuota(t.ID, t.MaxReceipts)
+		receiptStore.SetDailyQuota(t.ID, t.DailyQuota)
+	}
+
+	metrics.Default.NewGaugeFunc("receipts_stored", "Receipts currently held in the store.", func() float64 {
+		return float64(receiptStore.Stats().Receipts)
+	})
+	metrics.Default.NewGaugeFunc("store_memory_bytes", "Estimated memory used by stored receipts.", func() float64 {
+		return float64(receiptStore.Stats().Bytes)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dispatcher := webhook.NewDispatcher(webhook.NewClient(cfg.Webhooks.Timeout.Duration), cfg.Webhooks.QueueSize)
+	dispatcher.MaxAttempts = cfg.Webhooks.MaxAttempts
+	dispatcher.MaxSubscriptions = cfg.Webhooks.MaxSubscriptions
+	dispatcher.MaxDeadLetters = cfg.Webhooks.MaxDeadLetters
+	go dispatcher.Run(ctx, cfg.Webhooks.Workers)
+
+	bus := events.NewBus(cfg.Stream.ReplaySize, cfg.Stream.BufferSize)
 
 	processHandler := handlers.NewProcessHandler(receiptStore)
-	pointsHandler := handlers.NewPointsHandler(receiptStore)
+	processHandler.Limits = cfg.Limits
+	processHandler.Reconcile = cfg.Reconcile
+	processHandler.Tenants = tenants
+	processHandler.Webhooks = dispatcher
+	processHandler.Events = bus
+	processHandler.Fraud = fraud.NewAssessor(cfg.Fraud.Assessor())
+	if cfg.Processing.Mode == "async" {
+		queue := jobs.NewQueue(cfg.Processing.QueueSize)
+		processHandler.Queue = queue
+		go queue.Run(ctx, cfg.Processing.Workers, func(ctx context.Context, job jobs.Job) {
+			processHandler.ProcessJob(ctx, job)
+		})
+		go func() {
+			<-recovered
+			processHandler.Resume(ctx)
+		}()
+		metrics.Default.NewGaugeFunc("processing_queue_depth", "Receipts waiting for a processing worker.", func() float64 {
+			return float64(queue.Len())
+		})
+	}
+	textHandler := handlers.NewTextHandler(processHandler)
+	pointsHandler := handlers.NewPointsHandler(receiptStore, tenants)
+	readyHandler := handlers.NewReadyHandler(receiptStore)
+	webhooksHandler := handlers.NewWebhooksHandler(dispatcher)
+	reviewsHandler := handlers.NewReviewsHandler(processHandler, cfg.AdminToken)
+	refundsHandler := handlers.NewRefundsHandler(processHandler, cfg.AdminToken)
+	rescores := rescore.NewManager(receiptStore, tenants)
+	rescores.PageSize = cfg.RescorePageSize
+	rescores.MaxJobs = cfg.RescoreMaxJobs
+	rescoresHandler := handlers.NewRescoresHandler(rescores, cfg.AdminToken)
+	streamHandler := handlers.NewStreamHandler(bus)
+	graphqlHandler, err := graphqlapi.NewHandler(processHandler, receiptStore, tenants)
+	if err != nil {
+		logger.Error("building GraphQL schema failed", "error", err)
+		os.Exit(1)
+	}
+	graphqlHandler.Limits = cfg.GraphQL
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
 		switch {
 		case path == "/receipts/process":
 			processHandler.ServeHTTP(w, r)
+		case path == "/receipts/process/text":
+			textHandler.ServeHTTP(w, r)
+		case path == "/receipts/stream":
+			streamHandler.ServeHTTP(w, r)
+		case path == "/graphql":
+			graphqlHandler.ServeHTTP(w, r)
+		case path == "/metrics":
+			metrics.Default.Handler().ServeHTTP(w, r)
+		case path == "/webhooks" || strings.HasPrefix(path, "/webhooks/"):
+			webhooksHandler.ServeHTTP(w, r)
+		case path == "/admin/reviews" || strings.HasPrefix(path, "/admin/reviews/"):
+			reviewsHandler.ServeHTTP(w, r)
+		case path == "/admin/rescores" || strings.HasPrefix(path, "/admin/rescores/"):
+			rescoresHandler.ServeHTTP(w, r)
+		case strings.HasPrefix(path, "/admin/receipts/") && strings.HasSuffix(path, "/refund"):
+			refundsHandler.ServeHTTP(w, r)
 		case strings.HasPrefix(path, "/receipts/") && strings.HasSuffix(path, "/points"):
 
 			idPart := strings.TrimPrefix(path, "/receipts/")
@@ -35,7 +208,56 @@ func main() {
 		}
 	})
 
-	port := 8080
-	fmt.Printf("Server starting on port %d...\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	limiters := ratelimit.NewLimiters(cfg.RateLimits)
+	limited := ratelimit.Middleware(limiters, ratelimit.ClientKey,
+		metrics.Middleware(handlers.RequestDuration, handlers.Route, router))
+	handler := logging.Middleware(logger, handlers.Route,
+		handlers.WithProbes(readyHandler, tenant.Middleware(tenants, fraud.Middleware(limited))))
+
+	srv := server.New(cfg.Addr, handler, receiptStore, cfg.Timeouts.ServerTimeouts())
+	var tlsConfig *tls.Config
+	if cfg.TLS.CertFile != "" {
+		reloader, err := server.NewCertReloader(cfg.TLS.Options())
+		if err != nil {
+			logger.Error("loading TLS certificates failed", "error", err)
+			os.Exit(1)
+		}
+		tlsConfig, err = reloader.TLSConfig()
+		if err != nil {
+			logger.Error("configuring TLS failed", "error", err)
+			os.Exit(1)
+		}
+		go reloader.Watch(ctx, cfg.TLS.ReloadInterval.Duration)
+		srv.UseTLS(tlsConfig)
+	}
+	srv.OnShutdown(readyHandler.Drain)
+	srv.OnShutdown(bus.Close)
+
+	if cfg.GRPCAddr != "" {
+		var opts []grpc.ServerOption
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcService := grpcapi.NewServer(processHandler, receiptStore, tenants)
+		grpcService.Limiters = limiters
+		grpcServer := grpcapi.NewGRPCServer(grpcService, opts...)
+		listener, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			logger.Error("starting gRPC listener failed", "addr", cfg.GRPCAddr, "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			logger.Info("grpc server listening", "addr", listener.Addr().String(), "tls", tlsConfig != nil)
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Error("grpc server stopped", "error", err)
+			}
+		}()
+		srv.OnDrain(func(ctx context.Context) { grpcapi.Shutdown(ctx, grpcServer) })
+	}
+
+	if err := srv.Run(ctx); err != nil {
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("server stopped")
 }
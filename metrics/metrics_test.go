@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	reg := NewRegistry()
+	processed := reg.NewCounter("receipts_processed_total", "Receipts processed.")
+	rejected := reg.NewCounter("receipts_rejected_total", "Receipts rejected.", "reason")
+	latency := reg.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	reg.NewGaugeFunc("receipts_stored", "Receipts stored.", func() float64 { return 7 })
+
+	processed.Inc()
+	processed.Add(2)
+	rejected.Inc("invalid_date")
+	rejected.Inc(`quote"d`)
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+
+	var out strings.Builder
+	if _, err := reg.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"# HELP receipts_processed_total Receipts processed.",
+		"# TYPE receipts_processed_total counter",
+		"receipts_processed_total 3",
+		`receipts_rejected_total{reason="invalid_date"} 1`,
+		`receipts_rejected_total{reason="quote\"d"} 1`,
+		"# TYPE latency_seconds histogram",
+		`latency_seconds_bucket{route="/a",le="0.1"} 1`,
+		`latency_seconds_bucket{route="/a",le="1"} 2`,
+		`latency_seconds_bucket{route="/a",le="+Inf"} 3`,
+		`latency_seconds_sum{route="/a"} 3.55`,
+		`latency_seconds_count{route="/a"} 3`,
+		"# TYPE receipts_stored gauge",
+		"receipts_stored 7",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected output to contain %q, got:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestCounterValue(t *testing.T) {
+	c := NewRegistry().NewCounter("c", "help", "kind")
+	c.Inc("a")
+	c.Inc("a")
+
+	if got := c.Value("a"); got != 2 {
+		t.Errorf("expected 2, got %v", got)
+	}
+	if got := c.Value("b"); got != 0 {
+		t.Errorf("expected 0 for unseen labels, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("hits_total", "Hits.").Inc()
+
+	rr := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if !strings.Contains(rr.Body.String(), "hits_total 1\n") {
+		t.Errorf("unexpected body:\n%s", rr.Body.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	latency := NewRegistry().NewHistogram("latency_seconds", "Latency.", DefaultBuckets, "route")
+	route := func(path string) string { return "/fixed" }
+	handler := Middleware(latency, route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/anything", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/else", nil))
+
+	if got := latency.Count("/fixed"); got != 2 {
+		t.Errorf("expected 2 observations, got %d", got)
+	}
+}
@@ -1,16 +1,212 @@
 package models
 
+import "time"
+
+// Receipt is a submitted receipt. PurchaseDate and PurchaseTime are the
+// local wall-clock time in TimeZone, an IANA name or UTC offset; receipts
+// without one are in UTC. Currency is an ISO 4217 code and every amount is
+// written with that currency's minor units; receipts without one are in US
+// dollars. Subtotal, Discounts, Tax and Tip are optional.
 type Receipt struct {
-	Retailer     string `json:"retailer"`
-	PurchaseDate string `json:"purchaseDate"`
-	PurchaseTime string `json:"purchaseTime"`
-	Items        []Item `json:"items"`
-	Total        string `json:"total"`
+	Retailer     string     `json:"retailer"`
+	PurchaseDate string     `json:"purchaseDate"`
+	PurchaseTime string     `json:"purchaseTime"`
+	TimeZone     string     `json:"timeZone,omitempty"`
+	Currency     string     `json:"currency,omitempty"`
+	Items        []Item     `json:"items"`
+	Subtotal     string     `json:"subtotal,omitempty"`
+	Discounts    []Discount `json:"discounts,omitempty"`
+	Tax          string     `json:"tax,omitempty"`
+	Tip          string     `json:"tip,omitempty"`
+	Total        string     `json:"total"`
 }
 
+// Item is one line of a receipt. Price is the line total; when Quantity
+// and UnitPrice are given it must equal their product rounded to the cent.
+// Quantity is a decimal so weighed goods can be represented.
 type Item struct {
 	ShortDescription string `json:"shortDescription"`
 	Price            string `json:"price"`
+	Quantity         string `json:"quantity,omitempty"`
+	UnitPrice        string `json:"unitPrice,omitempty"`
+	SKU              string `json:"sku,omitempty"`
+	UPC              string `json:"upc,omitempty"`
+}
+
+// Discount is a coupon or markdown taken off the subtotal. Amount is
+// positive.
+type Discount struct {
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+}
+
+// Metadata is what the service records about a stored receipt beyond the
+// submitted fields. PurchasedAt is the purchase as a UTC instant,
+// Retailer the canonical retailer the submitted name matched, if any, and
+// Member the member who submitted it, so queued receipts are assessed for
+// them even after a restart.
+type Metadata struct {
+	Member         string             `json:"member,omitempty"`
+	Reconciliation *Reconciliation    `json:"reconciliation,omitempty"`
+	PurchasedAt    *time.Time         `json:"purchasedAt,omitempty"`
+	Retailer       *CanonicalRetailer `json:"retailer,omitempty"`
+	Risk           *Risk              `json:"risk,omitempty"`
+	Review         *Review            `json:"review,omitempty"`
+	Lifecycle      *Lifecycle         `json:"lifecycle,omitempty"`
+	Rejection      *Rejection         `json:"rejection,omitempty"`
+	Score          *Score             `json:"score,omitempty"`
+	Refund         *Refund            `json:"refund,omitempty"`
+}
+
+// Refund records who took a credited receipt's points back, why and when.
+type Refund struct {
+	Reviewer string    `json:"reviewer"`
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+}
+
+// Score records the points a receipt was scored with, how each rule
+// contributed, the version of the rules that scored it and when, so later
+// rule changes leave it alone until the receipt is re-scored. Breakdown is
+// nil for scores recorded before breakdowns were.
+type Score struct {
+	Points    int          `json:"points"`
+	Breakdown []RulePoints `json:"breakdown"`
+	Version   string       `json:"version,omitempty"`
+	At        time.Time    `json:"at"`
+}
+
+// RulePoints is the number of points a single scoring rule awarded.
+type RulePoints struct {
+	Rule   string `json:"rule"`
+	Points int    `json:"points"`
+}
+
+// Rejection records why a receipt accepted for asynchronous processing
+// failed validation: the error code and message a synchronous submission
+// would have been rejected with.
+type Rejection struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Lifecycle states of a stored receipt.
+const (
+	StateReceived  = "received"
+	StateValidated = "validated"
+	StateScored    = "scored"
+	StateHeld      = "held"
+	StateCredited  = "credited"
+	StateVoided    = "voided"
+	StateRefunded  = "refunded"
+	StateRejected  = "rejected"
+)
+
+// Lifecycle is the state a receipt is in and every state it has been in,
+// oldest first. The store decides which moves between states are allowed.
+type Lifecycle struct {
+	State   string       `json:"state"`
+	History []Transition `json:"history"`
+}
+
+type Transition struct {
+	State string    `json:"state"`
+	At    time.Time `json:"at"`
+}
+
+// NewLifecycle starts a lifecycle in the received state.
+func NewLifecycle(at time.Time) *Lifecycle {
+	return &Lifecycle{State: StateReceived, History: []Transition{{State: StateReceived, At: at}}}
+}
+
+// To returns a copy of the lifecycle moved to state at the given time,
+// leaving the lifecycle itself untouched.
+func (l *Lifecycle) To(state string, at time.Time) *Lifecycle {
+	history := append(make([]Transition, 0, len(l.History)+1), l.History...)
+	return &Lifecycle{State: state, History: append(history, Transition{State: state, At: at})}
+}
+
+// Review statuses.
+const (
+	ReviewPending  = "pending_review"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// Review actions recorded in the audit trail.
+const (
+	ReviewActionHeld     = "held"
+	ReviewActionClaimed  = "claimed"
+	ReviewActionApproved = "approved"
+	ReviewActionRejected = "rejected"
+)
+
+// Review is the manual review of a receipt whose points were held: why it
+// was held, who has claimed it, where it stands, and every action taken on
+// it, oldest first.
+type Review struct {
+	Status   string        `json:"status"`
+	Reasons  []string      `json:"reasons"`
+	Reviewer string        `json:"reviewer,omitempty"`
+	Audit    []ReviewEntry `json:"audit"`
+}
+
+type ReviewEntry struct {
+	Action   string    `json:"action"`
+	Reviewer string    `json:"reviewer,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// With returns a copy of the review with entry added to its audit trail,
+// leaving the review itself untouched.
+func (r *Review) With(entry ReviewEntry) *Review {
+	next := *r
+	next.Audit = append(append(make([]ReviewEntry, 0, len(r.Audit)+1), r.Audit...), entry)
+	return &next
+}
+
+// Risk is the fraud assessment of a receipt: its score, the heuristics
+// that contributed to it, and whether its points are held for review.
+type Risk struct {
+	Score   int      `json:"score"`
+	Reasons []string `json:"reasons,omitempty"`
+	Held    bool     `json:"held"`
+}
+
+// CanonicalRetailer is the registry entry a receipt's retailer name matched
+// when it was submitted.
+type CanonicalRetailer struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+	Chain    string `json:"chain,omitempty"`
+}
+
+// Reconciliation records how a receipt's total compared with its items,
+// discounts, tax and tip. Expected is the total those components add up
+// to; Difference is Total minus Expected. Outcome is what the
+// reconciliation policy did with the receipt: accepted, warned or flagged.
+type Reconciliation struct {
+	Balanced   bool   `json:"balanced"`
+	Expected   string `json:"expected"`
+	Difference string `json:"difference"`
+	Outcome    string `json:"outcome"`
+}
+
+// Reconciliation outcomes.
+const (
+	OutcomeAccepted = "accepted"
+	OutcomeWarned   = "warned"
+	OutcomeFlagged  = "flagged"
+)
+
+// Scores reports whether a receipt reconciled this way earns points. A
+// warned mismatch is stored but scores nothing, so an inflated total
+// cannot buy points under the warn policy. A nil reconciliation, from
+// receipts stored before reconciliation existed, scores.
+func (r *Reconciliation) Scores() bool {
+	return r == nil || r.Outcome != OutcomeWarned
 }
 
 type ReceiptID struct {
@@ -0,0 +1,251 @@
+// Package parser turns plain-text POS printouts into receipts.
+//
+// A printout is expected to open with the store name, followed somewhere by
+// the purchase date and time, one line per item ending in its price, and a
+// TOTAL line:
+//
+//	      TARGET
+//	  1234 Main Street
+//	01/01/2022   1:01 PM
+//	Pepsi 12PK            $1.25
+//	Dasani                 6.49 T
+//	SUBTOTAL               7.74
+//	TAX                    0.62
+//	TOTAL                  8.36
+//
+// Subtotal, tax, tip and coupon lines before the total fill in the
+// receipt's components, so taxed printouts reconcile. Lines the parser
+// cannot place are returned rather than failing the parse, so callers can
+// show what was dropped.
+package parser
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/receipt-processor/currency"
+	"github.com/receipt-processor/models"
+)
+
+// Line is a printout line the parser could not interpret. Number counts
+// from one.
+type Line struct {
+	Number int    `json:"line"`
+	Text   string `json:"text"`
+}
+
+// Result is a parsed printout. The receipt may be incomplete; validating it
+// is left to the caller.
+type Result struct {
+	Receipt  models.Receipt
+	Unparsed []Line
+}
+
+var (
+	// amountRe matches a trailing amount with an optional currency sign,
+	// a minus sign before or after it, and the tax flag letters many
+	// printers add after the price.
+	amountRe = regexp.MustCompile(`^(.*?)[\s.]*(-)?\$?(\d{1,7}\.\d{2})(-)?(?:\s+[A-Z]{1,2})?$`)
+	totalRe  = regexp.MustCompile(`(?i)^(?:grand\s+)?total(?:\s+due)?\b[\s:]*`)
+
+	// The components a total is made of besides its items. Tax lines may
+	// name the tax and its rate; coupon lines usually name the product.
+	subtotalRe = regexp.MustCompile(`(?i)^sub\s*-?\s*total[\s:]*$`)
+	taxRe      = regexp.MustCompile(`(?i)^(?:(?:sales|state|local|city|county)\s+)*(?:tax|vat)(?:\s+\d{1,2}(?:\.\d+)?\s*%)?[\s:]*$`)
+	tipRe      = regexp.MustCompile(`(?i)^(?:tip|gratuity)[\s:]*$`)
+	discountRe = regexp.MustCompile(`(?i)^(?:coupon|discount|markdown|promo)\b`)
+	// summaryRe matches amount lines that describe the payment rather than
+	// an item.
+	summaryRe = regexp.MustCompile(`(?i)^(?:cash|change|tender|` +
+		`visa|mastercard|amex|debit|credit|card|balance|amount\s+paid|savings|you\s+saved)\b`)
+	separatorRe = regexp.MustCompile(`^[-=*_#~.\s]+$`)
+
+	dateRe = regexp.MustCompile(`(?i)\b(\d{4}-\d{2}-\d{2}|\d{1,2}/\d{1,2}/\d{2}(?:\d{2})?|` +
+		`(?:jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+\d{1,2},?\s+\d{4}|` +
+		`\d{1,2}\s+(?:jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+\d{4})\b`)
+	timeRe = regexp.MustCompile(`(?i)\b(\d{1,2}:\d{2})(?::\d{2})?(?:\s*([ap])\.?m\.?)?(?:\b|$)`)
+	// labelRe matches the words that may accompany a date or time.
+	labelRe = regexp.MustCompile(`(?i)\b(?:date|time|at|on)\b|[:|,]`)
+)
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"1/2/2006",
+	"1/2/06",
+	"Jan 2 2006",
+	"January 2 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+// Parse reads a printout. It fails only when the reader does; anything it
+// cannot make sense of is reported in Result.Unparsed.
+func Parse(r io.Reader) (Result, error) {
+	var result Result
+	scanner := bufio.NewScanner(r)
+
+	number := 0
+	totalSeen := false
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSpace(strings.ReplaceAll(scanner.Text(), "\t", " "))
+		if text == "" || separatorRe.MatchString(text) {
+			continue
+		}
+
+		if !parseLine(&result.Receipt, text, totalSeen) {
+			if result.Receipt.Retailer == "" && !totalSeen && len(result.Receipt.Items) == 0 {
+				result.Receipt.Retailer = collapseSpaces(text)
+				continue
+			}
+			result.Unparsed = append(result.Unparsed, Line{Number: number, Text: text})
+		}
+		if result.Receipt.Total != "" {
+			totalSeen = true
+		}
+	}
+	return result, scanner.Err()
+}
+
+// parseLine applies one line to the receipt and reports whether it was
+// understood. Once the total has been read, amount lines are assumed to be
+// payment details rather than items, and subtotal, tax, tip and discount
+// lines are taken to repeat ones already read.
+func parseLine(receipt *models.Receipt, text string, totalSeen bool) bool {
+	if match := amountRe.FindStringSubmatch(text); match != nil {
+		label := strings.TrimSpace(match[1])
+		amount := match[3]
+		negative := match[2] != "" || match[4] != ""
+		switch {
+		case totalRe.MatchString(label) && totalRe.ReplaceAllString(label, "") == "":
+			if receipt.Total == "" {
+				receipt.Total = amount
+			}
+			return true
+		case subtotalRe.MatchString(label):
+			if receipt.Subtotal == "" && !totalSeen {
+				receipt.Subtotal = amount
+			}
+			return true
+		case taxRe.MatchString(label):
+			if !totalSeen {
+				receipt.Tax = addAmounts(receipt.Tax, amount)
+			}
+			return true
+		case tipRe.MatchString(label):
+			if !totalSeen {
+				receipt.Tip = addAmounts(receipt.Tip, amount)
+			}
+			return true
+		case discountRe.MatchString(label):
+			if !totalSeen {
+				receipt.Discounts = append(receipt.Discounts, models.Discount{Description: collapseSpaces(label), Amount: amount})
+			}
+			return true
+		case summaryRe.MatchString(label), totalRe.MatchString(label):
+			// Lines such as TOTAL SAVINGS are summaries, not the total.
+			return true
+		case totalSeen || label == "":
+			return false
+		}
+		if !hasDateOrTime(label) {
+			if negative {
+				amount = "-" + amount
+			}
+			receipt.Items = append(receipt.Items, models.Item{ShortDescription: collapseSpaces(label), Price: amount})
+			return true
+		}
+	}
+	return parseDateTime(receipt, text)
+}
+
+// addAmounts adds a printed amount to a running one, so receipts listing
+// several taxes record their sum.
+func addAmounts(sum, amount string) string {
+	if sum == "" {
+		return amount
+	}
+	a, _ := currency.ParseAmount(sum, 2)
+	b, _ := currency.ParseAmount(amount, 2)
+	return currency.FormatAmount(a+b, 2)
+}
+
+// parseDateTime takes the first date and time from a line made up only of
+// a date, a time and their labels.
+func parseDateTime(receipt *models.Receipt, text string) bool {
+	dateMatch := dateRe.FindStringSubmatchIndex(text)
+	timeMatch := timeRe.FindStringSubmatchIndex(text)
+	if dateMatch == nil && timeMatch == nil {
+		return false
+	}
+
+	rest := text
+	var date, clock string
+	if dateMatch != nil {
+		date = parseDate(text[dateMatch[2]:dateMatch[3]])
+		if date == "" {
+			return false
+		}
+		rest = strings.Replace(rest, text[dateMatch[0]:dateMatch[1]], " ", 1)
+	}
+	if timeMatch != nil {
+		meridiem := ""
+		if timeMatch[4] >= 0 {
+			meridiem = text[timeMatch[4]:timeMatch[5]]
+		}
+		clock = parseTime(text[timeMatch[2]:timeMatch[3]], meridiem)
+		if clock == "" {
+			return false
+		}
+		rest = strings.Replace(rest, text[timeMatch[0]:timeMatch[1]], " ", 1)
+	}
+	if strings.TrimSpace(labelRe.ReplaceAllString(rest, "")) != "" {
+		return false
+	}
+
+	if date != "" && receipt.PurchaseDate == "" {
+		receipt.PurchaseDate = date
+	}
+	if clock != "" && receipt.PurchaseTime == "" {
+		receipt.PurchaseTime = clock
+	}
+	return true
+}
+
+func hasDateOrTime(text string) bool {
+	return dateRe.MatchString(text) || timeRe.MatchString(text)
+}
+
+// parseDate normalises a printed date to YYYY-MM-DD, reading slashed dates
+// as month first.
+func parseDate(text string) string {
+	text = strings.NewReplacer(",", "", ".", "").Replace(text)
+	text = collapseSpaces(text)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// parseTime normalises a printed time to 24-hour HH:MM.
+func parseTime(text, meridiem string) string {
+	layout := "15:04"
+	if meridiem != "" {
+		text += strings.ToUpper(meridiem) + "M"
+		layout = "3:04PM"
+	}
+	t, err := time.Parse(layout, text)
+	if err != nil {
+		return ""
+	}
+	return t.Format("15:04")
+}
+
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/receipt-processor/models"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		receipt  models.Receipt
+		unparsed []Line
+	}{
+		{
+			name: "typical printout",
+			text: `
+        TARGET
+   1234 Main Street
+-------------------------
+01/01/2022        1:01 PM
+Pepsi 12PK            $1.25
+Dasani                 6.49 T
+-------------------------
+SUBTOTAL               7.74
+TAX                    0.00
+TOTAL                  7.74
+VISA                   7.74
+  THANK YOU FOR SHOPPING
+`,
+			receipt: models.Receipt{
+				Retailer:     "TARGET",
+				PurchaseDate: "2022-01-01",
+				PurchaseTime: "13:01",
+				Items: []models.Item{
+					{ShortDescription: "Pepsi 12PK", Price: "1.25"},
+					{ShortDescription: "Dasani", Price: "6.49"},
+				},
+				Subtotal: "7.74",
+				Tax:      "0.00",
+				Total:    "7.74",
+			},
+			unparsed: []Line{{Number: 3, Text: "1234 Main Street"}, {Number: 13, Text: "THANK YOU FOR SHOPPING"}},
+		},
+		{
+			name: "discounts, taxes and a tip",
+			text: "Corner Bistro\n" +
+				"2022-01-01 18:30\n" +
+				"Café au lait      4.50\n" +
+				"Croissant         3.25\n" +
+				"Croissant        -3.25\n" +
+				"COUPON CAFE       0.50-\n" +
+				"Subtotal:         4.50\n" +
+				"STATE TAX 6%      0.24\n" +
+				"CITY TAX          0.10\n" +
+				"Tip               1.00\n" +
+				"TOTAL             5.34\n" +
+				"TAX               0.34\n",
+			receipt: models.Receipt{
+				Retailer:     "Corner Bistro",
+				PurchaseDate: "2022-01-01",
+				PurchaseTime: "18:30",
+				Items: []models.Item{
+					{ShortDescription: "Café au lait", Price: "4.50"},
+					{ShortDescription: "Croissant", Price: "3.25"},
+					{ShortDescription: "Croissant", Price: "-3.25"},
+				},
+				Subtotal:  "4.50",
+				Discounts: []models.Discount{{Description: "COUPON CAFE", Amount: "0.50"}},
+				Tax:       "0.34",
+				Tip:       "1.00",
+				Total:     "5.34",
+			},
+		},
+		{
+			name: "labelled date and time on separate lines",
+			text: "M&M Corner Market\r\n" +
+				"Date: 2022-03-20\r\n" +
+				"Time: 14:33:02\r\n" +
+				"Gatorade\t\t2.25\r\n" +
+				"Gatorade  ....  2.25\r\n" +
+				"Total: $4.50\r\n",
+			receipt: models.Receipt{
+				Retailer:     "M&M Corner Market",
+				PurchaseDate: "2022-03-20",
+				PurchaseTime: "14:33",
+				Items: []models.Item{
+					{ShortDescription: "Gatorade", Price: "2.25"},
+					{ShortDescription: "Gatorade", Price: "2.25"},
+				},
+				Total: "4.50",
+			},
+		},
+		{
+			name: "written date after the items",
+			text: "Walgreens\n" +
+				"Mountain   Dew 12PK   6.49\n" +
+				"2 @ 1.00  2.00\n" +
+				"TOTAL SAVINGS   1.00\n" +
+				"GRAND TOTAL     8.49\n" +
+				"Mar 5, 2023 at 9:05 am\n",
+			receipt: models.Receipt{
+				Retailer:     "Walgreens",
+				PurchaseDate: "2023-03-05",
+				PurchaseTime: "09:05",
+				Items: []models.Item{
+					{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+					{ShortDescription: "2 @ 1.00", Price: "2.00"},
+				},
+				Total: "8.49",
+			},
+		},
+		{
+			name:     "nothing recognisable",
+			text:     "Shop\nhello\n13/45/2022\n",
+			receipt:  models.Receipt{Retailer: "Shop"},
+			unparsed: []Line{{Number: 2, Text: "hello"}, {Number: 3, Text: "13/45/2022"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Parse(strings.NewReader(tc.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Receipt, tc.receipt) {
+				t.Errorf("expected receipt %+v, got %+v", tc.receipt, result.Receipt)
+			}
+			if !reflect.DeepEqual(result.Unparsed, tc.unparsed) {
+				t.Errorf("expected unparsed lines %+v, got %+v", tc.unparsed, result.Unparsed)
+			}
+		})
+	}
+}
+
+func TestParseReadError(t *testing.T) {
+	readErr := errors.New("connection reset")
+	if _, err := Parse(iotest.ErrReader(readErr)); !errors.Is(err, readErr) {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
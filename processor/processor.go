@@ -1,59 +1,258 @@
 package processor
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/receipt-processor/currency"
 	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/retailer"
 )
 
 type PointsCalculator interface {
 	CalculatePoints(receipt models.Receipt) int
 }
 
+// Rules are the point values of each scoring rule. RetailerBonuses awards
+// extra points to receipts from canonical retailers, keyed by retailer ID.
+// Version labels the rules in the scores recorded with them.
+type Rules struct {
+	Version string `json:"version,omitempty"`
+
+	RetailerCharPoints    int     `json:"retailerCharPoints"`
+	RoundDollarPoints     int     `json:"roundDollarPoints"`
+	QuarterMultiplePoints int     `json:"quarterMultiplePoints"`
+	ItemPairPoints        int     `json:"itemPairPoints"`
+	DescriptionMultiplier float64 `json:"descriptionMultiplier"`
+	OddDayPoints          int     `json:"oddDayPoints"`
+	AfternoonPoints       int     `json:"afternoonPoints"`
+	AfternoonStart        string  `json:"afternoonStart"`
+	AfternoonEnd          string  `json:"afternoonEnd"`
+
+	RetailerBonuses map[string]int `json:"retailerBonuses,omitempty"`
+}
+
+var DefaultRules = Rules{
+	RetailerCharPoints:    1,
+	RoundDollarPoints:     50,
+	QuarterMultiplePoints: 25,
+	ItemPairPoints:        5,
+	DescriptionMultiplier: 0.2,
+	OddDayPoints:          6,
+	AfternoonPoints:       10,
+	AfternoonStart:        "14:00",
+	AfternoonEnd:          "16:00",
+}
+
+// UnmarshalJSON starts from DefaultRules so rule files only need to list
+// the values they override.
+func (rules *Rules) UnmarshalJSON(data []byte) error {
+	type plain Rules
+	decoded := plain(DefaultRules)
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*rules = Rules(decoded)
+	return nil
+}
+
+func LoadRules(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, err
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return Rules{}, err
+	}
+	if err := rules.Validate(); err != nil {
+		return Rules{}, err
+	}
+	return rules, nil
+}
+
+// Validate reports whether the afternoon window is a pair of HH:MM times
+// with the start before the end.
+func (rules Rules) Validate() error {
+	start, err := time.Parse("15:04", rules.AfternoonStart)
+	if err != nil {
+		return fmt.Errorf("afternoonStart must be HH:MM, got %q", rules.AfternoonStart)
+	}
+	end, err := time.Parse("15:04", rules.AfternoonEnd)
+	if err != nil {
+		return fmt.Errorf("afternoonEnd must be HH:MM, got %q", rules.AfternoonEnd)
+	}
+	if !start.Before(end) {
+		return fmt.Errorf("afternoonStart %s must be before afternoonEnd %s", rules.AfternoonStart, rules.AfternoonEnd)
+	}
+	return nil
+}
+
 func CalculatePoints(receipt models.Receipt) int {
+	return DefaultRules.CalculatePoints(receipt)
+}
+
+// RulePoints is the number of points a single rule awarded.
+type RulePoints = models.RulePoints
+
+// Rule names reported in a breakdown.
+const (
+	RuleRetailerName    = "retailerName"
+	RuleRoundDollar     = "roundDollar"
+	RuleQuarterMultiple = "quarterMultiple"
+	RuleItemPairs       = "itemPairs"
+	RuleItemDescription = "itemDescription"
+	RuleOddDay          = "oddDay"
+	RuleAfternoon       = "afternoon"
+	RuleRetailerBonus   = "retailerBonus"
+)
+
+// CalculatePoints totals the receipt's breakdown. A receipt whose amounts
+// cannot be converted to the base currency scores nothing; callers that
+// need to tell why use Breakdown.
+func (rules Rules) CalculatePoints(receipt models.Receipt) int {
+	breakdown, err := rules.Breakdown(receipt)
+	if err != nil {
+		return 0
+	}
 	points := 0
+	for _, awarded := range breakdown {
+		points += awarded.Points
+	}
+	return points
+}
 
-	points += countAlphanumeric(receipt.Retailer)
+// Breakdown reports the points each rule awarded to the receipt, in rule
+// order. Rules that awarded nothing are omitted. Amounts are scored in the
+// base currency of currency.Default, and a receipt whose amounts cannot
+// be converted is an error. The odd-day and afternoon rules read
+// the purchase date and time as printed, which is the store's local time
+// whatever the receipt's time zone. A retailer name that matches an entry
+// of retailer.Default is scored by its canonical name.
+func (rules Rules) Breakdown(receipt models.Receipt) ([]RulePoints, error) {
+	receipt, err := inBase(receipt)
+	if err != nil {
+		return nil, err
+	}
+	canonical, matched := retailer.Default.Match(receipt.Retailer)
+	if matched {
+		receipt.Retailer = canonical.Name
+	}
+	breakdown := []RulePoints{}
+	award := func(rule string, points int) {
+		if points != 0 {
+			breakdown = append(breakdown, RulePoints{Rule: rule, Points: points})
+		}
+	}
+
+	award(RuleRetailerName, countAlphanumeric(receipt.Retailer)*rules.RetailerCharPoints)
 
 	total, _ := strconv.ParseFloat(receipt.Total, 64)
 	if total == math.Floor(total) {
-		points += 50
+		award(RuleRoundDollar, rules.RoundDollarPoints)
 	}
 
 	if math.Mod(total*100, 25) == 0 {
-		points += 25
+		award(RuleQuarterMultiple, rules.QuarterMultiplePoints)
 	}
 
-	points += (len(receipt.Items) / 2) * 5
+	award(RuleItemPairs, (len(receipt.Items)/2)*rules.ItemPairPoints)
 
+	descriptionPoints := 0
 	for _, item := range receipt.Items {
-		trimDesc := strings.TrimSpace(item.ShortDescription)
-		if len(trimDesc)%3 == 0 && len(trimDesc) > 0 {
+		length := descriptionLength(item.ShortDescription)
+		if length%3 == 0 && length > 0 {
 			price, _ := strconv.ParseFloat(item.Price, 64)
-			points += int(math.Ceil(price * 0.2))
+			descriptionPoints += int(math.Ceil(price * rules.DescriptionMultiplier))
 		}
 	}
+	award(RuleItemDescription, descriptionPoints)
 
 	purchaseDate, _ := time.Parse("2006-01-02", receipt.PurchaseDate)
 	if purchaseDate.Day()%2 == 1 {
-		points += 6
+		award(RuleOddDay, rules.OddDayPoints)
 	}
 
 	purchaseTime, _ := time.Parse("15:04", receipt.PurchaseTime)
-	afternoon2pm, _ := time.Parse("15:04", "14:00")
-	afternoon4pm, _ := time.Parse("15:04", "16:00")
+	afternoonStart, _ := time.Parse("15:04", rules.AfternoonStart)
+	afternoonEnd, _ := time.Parse("15:04", rules.AfternoonEnd)
 
-	if purchaseTime.After(afternoon2pm) && purchaseTime.Before(afternoon4pm) {
-		points += 10
+	if purchaseTime.After(afternoonStart) && purchaseTime.Before(afternoonEnd) {
+		award(RuleAfternoon, rules.AfternoonPoints)
 	}
 
-	return points
+	if matched {
+		award(RuleRetailerBonus, rules.RetailerBonuses[canonical.ID])
+	}
+
+	return breakdown, nil
+}
+
+// inBase converts the total and item prices, which may be negative, to
+// the base currency at the rate in effect on the purchase date. It fails
+// when an amount is malformed or no rate applies; validation rejects such
+// receipts before they are stored, but a rates file reloaded since may no
+// longer cover them.
+func inBase(receipt models.Receipt) (models.Receipt, error) {
+	table := currency.Default
+	code := currency.Code(receipt.Currency)
+	if code == table.Base() {
+		return receipt, nil
+	}
+	from, err := currency.MinorUnits(code)
+	if err != nil {
+		return receipt, err
+	}
+	to, _ := currency.MinorUnits(table.Base())
+
+	convert := func(amount string) (string, error) {
+		minor, err := currency.ParseSignedAmount(amount, from)
+		if err != nil {
+			return "", fmt.Errorf("converting %q: %w", amount, err)
+		}
+		converted, err := table.Convert(minor, code, receipt.PurchaseDate)
+		if err != nil {
+			return "", err
+		}
+		return currency.FormatAmount(converted, to), nil
+	}
+
+	if receipt.Total, err = convert(receipt.Total); err != nil {
+		return receipt, err
+	}
+	items := make([]models.Item, len(receipt.Items))
+	for i, item := range receipt.Items {
+		if item.Price, err = convert(item.Price); err != nil {
+			return receipt, err
+		}
+		items[i] = item
+	}
+	receipt.Items = items
+	receipt.Currency = table.Base()
+	return receipt, nil
+}
+
+// descriptionLength counts the characters of a trimmed item description
+// in NFC, so "Café" is four characters however it was encoded or
+// submitted.
+func descriptionLength(s string) int {
+	return utf8.RuneCountInString(norm.NFC.String(strings.TrimSpace(s)))
 }
 
+// countAlphanumeric counts the letters and digits of any script, one point
+// each: "Café" and "全家" score like "Cafe" and "FM" would. Combining marks
+// are not counted, so a name scores the same whether or not it was
+// submitted in NFC.
 func countAlphanumeric(s string) int {
 	count := 0
 	for _, r := range s {
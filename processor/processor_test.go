@@ -1,9 +1,15 @@
 package processor
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
+	"github.com/receipt-processor/currency"
 	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/retailer"
 )
 
 func TestCalculatePoints(t *testing.T) {
@@ -125,6 +131,11 @@ func TestCountAlphanumeric(t *testing.T) {
 		{"Store-123", 8},
 		{"", 0},
 		{"$%@#@", 0},
+		{"Café Nero", 8},
+		{"Cafe\u0301 Nero", 8},
+		{"Trader Joe's", 10},
+		{"全家便利商店", 6},
+		{"متجر ٧", 5},
 	}
 
 	for _, tc := range tests {
@@ -136,3 +147,257 @@ func TestCountAlphanumeric(t *testing.T) {
 		})
 	}
 }
+
+func TestRulesCalculatePoints(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+		Total: "9.00",
+	}
+
+	t.Run("default rules match CalculatePoints", func(t *testing.T) {
+		if got := DefaultRules.CalculatePoints(receipt); got != CalculatePoints(receipt) {
+			t.Errorf("Expected %d points, got %d", CalculatePoints(receipt), got)
+		}
+	})
+
+	t.Run("custom rules", func(t *testing.T) {
+		rules := DefaultRules
+		rules.RoundDollarPoints = 0
+		rules.AfternoonPoints = 100
+
+		if got := rules.CalculatePoints(receipt); got != 149 {
+			t.Errorf("Expected %d points, got %d", 149, got)
+		}
+	})
+}
+
+func TestBreakdown(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: "2.25"},
+		},
+		Total: "9.00",
+	}
+
+	expected := []RulePoints{
+		{Rule: RuleRetailerName, Points: 14},
+		{Rule: RuleRoundDollar, Points: 50},
+		{Rule: RuleQuarterMultiple, Points: 25},
+		{Rule: RuleItemPairs, Points: 10},
+		{Rule: RuleAfternoon, Points: 10},
+	}
+
+	breakdown, err := DefaultRules.Breakdown(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breakdown) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, breakdown)
+	}
+	for i := range expected {
+		if breakdown[i] != expected[i] {
+			t.Errorf("Expected %v at %d, got %v", expected[i], i, breakdown[i])
+		}
+	}
+}
+
+func TestBreakdownUnicodeDescriptions(t *testing.T) {
+	tests := []struct {
+		description string
+		points      int
+	}{
+		{"Café Nero", 1},
+		{"Cafe\u0301 Nero", 1},
+		{"Cafe Nero", 1},
+		{"  全家便  ", 1},
+		{"全家", 0},
+		{"Crème brûlée", 1},
+		{"Crème", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			receipt := models.Receipt{
+				Retailer:     "",
+				PurchaseDate: "2022-03-20",
+				PurchaseTime: "10:00",
+				Items:        []models.Item{{ShortDescription: tc.description, Price: "5.00"}},
+				Total:        "5.01",
+			}
+			breakdown, err := DefaultRules.Breakdown(receipt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			points := 0
+			for _, awarded := range breakdown {
+				if awarded.Rule == RuleItemDescription {
+					points = awarded.Points
+				}
+			}
+			if points != tc.points {
+				t.Errorf("Expected %d item description points, got %d", tc.points, points)
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(`{"oddDayPoints": 12}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DefaultRules
+	expected.OddDayPoints = 12
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, rules)
+	}
+
+	if _, err := LoadRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for a missing rules file")
+	}
+
+	for _, body := range []string{
+		`{"afternoonStart": "16:00", "afternoonEnd": "14:00"}`,
+		`{"afternoonStart": "14:00", "afternoonEnd": "14:00"}`,
+		`{"afternoonEnd": "4pm"}`,
+	} {
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRules(path); err == nil {
+			t.Errorf("Expected error for rules %s", body)
+		}
+	}
+}
+
+func TestBreakdownConvertsCurrency(t *testing.T) {
+	table, err := currency.NewTable("USD", []currency.Rate{
+		{Currency: "JPY", Rate: "0.0075", Effective: "2022-01-01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := currency.Default
+	currency.Default = table
+	t.Cleanup(func() { currency.Default = previous })
+
+	// 1200 yen is 9.00 dollars, and 300 yen is 2.25 dollars.
+	receipt := models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Currency:     "JPY",
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: "300"},
+			{ShortDescription: "Gatorade", Price: "300"},
+			{ShortDescription: "Gatorade", Price: "300"},
+			{ShortDescription: "Gatorade", Price: "300"},
+		},
+		Total: "1200",
+	}
+	if points := DefaultRules.CalculatePoints(receipt); points != 109 {
+		t.Errorf("Expected 109 points, got %d", points)
+	}
+
+	// Item descriptions are scored on the converted price.
+	receipt.Items = []models.Item{{ShortDescription: "Tea", Price: "2000"}}
+	receipt.Total = "2000"
+	breakdown, err := DefaultRules.Breakdown(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, rule := range breakdown {
+		if rule.Rule == RuleItemDescription {
+			found = true
+			if rule.Points != 3 {
+				t.Errorf("Expected 3 description points for 15.00 dollars, got %d", rule.Points)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected item description points")
+	}
+
+	// Negative amounts are converted too: -500 yen is -3.75 dollars, not a
+	// round -500 dollars.
+	receipt.Items = []models.Item{{ShortDescription: "Refund", Price: "-500"}}
+	receipt.Total = "-500"
+	breakdown, err = DefaultRules.Breakdown(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range breakdown {
+		if rule.Rule == RuleRoundDollar {
+			t.Errorf("Expected -3.75 dollars not to be a round amount, got %v", breakdown)
+		}
+	}
+
+	receipt.PurchaseDate = "2021-12-31"
+	if _, err := DefaultRules.Breakdown(receipt); !errors.Is(err, currency.ErrNoRate) {
+		t.Errorf("Expected ErrNoRate before the first rate, got %v", err)
+	}
+	if points := DefaultRules.CalculatePoints(receipt); points != 0 {
+		t.Errorf("Expected an unconvertible receipt to score nothing, got %d", points)
+	}
+	receipt.PurchaseDate = "2022-03-20"
+	receipt.Total = "12.5"
+	if _, err := DefaultRules.Breakdown(receipt); !errors.Is(err, currency.ErrInvalidAmount) {
+		t.Errorf("Expected ErrInvalidAmount for a malformed total, got %v", err)
+	}
+}
+
+func TestBreakdownCanonicalRetailer(t *testing.T) {
+	registry, err := retailer.NewRegistry([]retailer.Retailer{
+		{ID: "target", Name: "Target", Aliases: []string{"Target #*", "Target Store"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := retailer.Default
+	retailer.Default = registry
+	t.Cleanup(func() { retailer.Default = previous })
+
+	rules := DefaultRules
+	rules.RetailerBonuses = map[string]int{"target": 15}
+
+	receipt := models.Receipt{
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "10:00",
+		Items:        []models.Item{{ShortDescription: "Item", Price: "1.10"}},
+		Total:        "1.10",
+	}
+	for _, name := range []string{"TARGET", "Target ", "Target #1234", "Target Store"} {
+		receipt.Retailer = name
+		breakdown, _ := rules.Breakdown(receipt)
+		expected := []RulePoints{{Rule: RuleRetailerName, Points: 6}, {Rule: RuleRetailerBonus, Points: 15}}
+		if !reflect.DeepEqual(breakdown, expected) {
+			t.Errorf("%q: expected %v, got %v", name, expected, breakdown)
+		}
+	}
+
+	receipt.Retailer = "Walgreens"
+	if points := rules.CalculatePoints(receipt); points != 9 {
+		t.Errorf("expected an unregistered retailer to score its own name only, got %d", points)
+	}
+}
@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/receipt-processor/tenant"
+)
+
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+type Config struct {
+	Default Limit            `json:"default"`
+	Routes  map[string]Limit `json:"routes"`
+}
+
+var DefaultConfig = Config{
+	Routes: map[string]Limit{
+		"/receipts/process":      {Rate: 10, Burst: 20},
+		"/receipts/process/text": {Rate: 10, Burst: 20},
+		"/graphql":               {Rate: 10, Burst: 20},
+	},
+}
+
+type KeyFunc func(r *http.Request) string
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type Limiter struct {
+	limit     Limit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Limit returns the limit the limiter enforces.
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Allow takes a token from the key's bucket. It reports the tokens left and,
+// when the request is rejected, how long until a token becomes available.
+func (l *Limiter) Allow(key string) (bool, int, time.Duration) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN takes n tokens from the key's bucket, or none when fewer are
+// left. A request for more tokens than the burst is never allowed.
+func (l *Limiter) AllowN(key string, n int) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	if b.tokens < float64(n) {
+		wait := time.Duration((float64(n) - b.tokens) / l.limit.Rate * float64(time.Second))
+		return false, int(b.tokens), wait
+	}
+
+	b.tokens -= float64(n)
+	return true, int(b.tokens), 0
+}
+
+// ResetAfter reports how long until the key's bucket is full again.
+func (l *Limiter) ResetAfter(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	missing := float64(l.limit.Burst) - b.tokens
+	return time.Duration(missing / l.limit.Rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, since they are
+// indistinguishable from a fresh bucket.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	full := time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ClientKey identifies the caller by API key, then by non-default tenant,
+// then by client IP.
+func ClientKey(r *http.Request) string {
+	if key := r.Header.Get(tenant.APIKeyHeader); key != "" {
+		return "key:" + key
+	}
+	if id := tenant.FromContext(r.Context()); id != tenant.Default {
+		return "tenant:" + id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Limiters holds one limiter per configured route and a default one for
+// every other path. The HTTP middleware and the gRPC interceptors share a
+// single Limiters, so a client's budget covers both transports.
+type Limiters struct {
+	fallback *Limiter
+	routes   map[string]*Limiter
+}
+
+func NewLimiters(cfg Config) *Limiters {
+	routes := make(map[string]*Limiter, len(cfg.Routes))
+	for route, limit := range cfg.Routes {
+		routes[route] = NewLimiter(limit)
+	}
+	return &Limiters{fallback: NewLimiter(cfg.Default), routes: routes}
+}
+
+// For returns the limiter of the longest configured route that prefixes
+// path, or the default limiter when none does.
+func (ls *Limiters) For(path string) *Limiter {
+	limiter := ls.fallback
+	matched := ""
+	for route, l := range ls.routes {
+		if strings.HasPrefix(path, route) && len(route) > len(matched) {
+			limiter, matched = l, route
+		}
+	}
+	return limiter
+}
+
+func Middleware(limiters *Limiters, key KeyFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := limiters.For(r.URL.Path)
+		if limiter.limit.Unlimited() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		k := key(r)
+		allowed, remaining, retryAfter := limiter.Allow(k)
+		reset := limiter.ResetAfter(k)
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limiter.limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Rate limit exceeded."})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
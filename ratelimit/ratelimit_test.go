@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/tenant"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	limiter := NewLimiter(Limit{Rate: 1, Burst: 2})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	for i, expectedRemaining := range []int{1, 0} {
+		allowed, remaining, _ := limiter.Allow("client")
+		if !allowed || remaining != expectedRemaining {
+			t.Fatalf("request %d: expected allowed with %d remaining, got %v with %d", i, expectedRemaining, allowed, remaining)
+		}
+	}
+
+	allowed, _, retryAfter := limiter.Allow("client")
+	if allowed {
+		t.Fatal("expected request to be rejected once the bucket is empty")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("expected retry after %v, got %v", time.Second, retryAfter)
+	}
+
+	if allowed, _, _ := limiter.Allow("other"); !allowed {
+		t.Error("expected a different key to have its own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if allowed, _, _ := limiter.Allow("client"); !allowed {
+		t.Error("expected a token to be refilled after one second")
+	}
+}
+
+func TestLimiterAllowN(t *testing.T) {
+	limiter := NewLimiter(Limit{Rate: 1, Burst: 3})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	if allowed, remaining, _ := limiter.AllowN("client", 2); !allowed || remaining != 1 {
+		t.Fatalf("expected two tokens to be taken, got %v with %d left", allowed, remaining)
+	}
+	allowed, remaining, retryAfter := limiter.AllowN("client", 2)
+	if allowed || remaining != 1 || retryAfter != time.Second {
+		t.Errorf("expected a rejection leaving the bucket alone, got %v with %d left, retry after %v", allowed, remaining, retryAfter)
+	}
+	if allowed, _, _ := limiter.AllowN("other", 4); allowed {
+		t.Error("expected a request above the burst to be rejected")
+	}
+}
+
+func TestLimiters(t *testing.T) {
+	limiters := NewLimiters(Config{
+		Default: Limit{Rate: 1, Burst: 1},
+		Routes: map[string]Limit{
+			"/receipts/process": {Rate: 10, Burst: 20},
+			"/graphql":          {Rate: 5, Burst: 10},
+		},
+	})
+	testCases := map[string]int{
+		"/receipts/process":      20,
+		"/receipts/process/text": 20,
+		"/graphql":               10,
+		"/receipts/abc/points":   1,
+	}
+	for path, burst := range testCases {
+		if limit := limiters.For(path).Limit(); limit.Burst != burst {
+			t.Errorf("%s: expected burst %d, got %+v", path, burst, limit)
+		}
+	}
+	if limiters.For("/receipts/process") != limiters.For("/receipts/process") {
+		t.Error("expected a route to keep its limiter")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	limiter := NewLimiter(Limit{Rate: 1, Burst: 1})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("a")
+	now = now.Add(2 * time.Minute)
+	limiter.Allow("b")
+
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Error("expected idle full bucket to be swept")
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		setup    func(r *http.Request) *http.Request
+		expected string
+	}{
+		{"client ip", func(r *http.Request) *http.Request { return r }, "ip:192.0.2.1"},
+		{"tenant", func(r *http.Request) *http.Request {
+			return r.WithContext(tenant.NewContext(r.Context(), "acme"))
+		}, "tenant:acme"},
+		{"api key", func(r *http.Request) *http.Request {
+			r.Header.Set(tenant.APIKeyHeader, "secret")
+			return r.WithContext(tenant.NewContext(r.Context(), "acme"))
+		}, "key:secret"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := tc.setup(httptest.NewRequest(http.MethodGet, "/", nil))
+			if got := ClientKey(req); got != tc.expected {
+				t.Errorf("expected key %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	cfg := Config{
+		Routes: map[string]Limit{
+			"/receipts/process": {Rate: 0.5, Burst: 1},
+		},
+	}
+	handler := Middleware(NewLimiters(cfg), ClientKey, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	t.Run("limited route", func(t *testing.T) {
+		codes := []int{http.StatusOK, http.StatusTooManyRequests}
+		for _, expected := range codes {
+			req := httptest.NewRequest(http.MethodPost, "/receipts/process", nil)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != expected {
+				t.Fatalf("expected status %d, got %d", expected, rr.Code)
+			}
+			if rr.Header().Get("RateLimit-Limit") != "1" {
+				t.Errorf("expected RateLimit-Limit 1, got %q", rr.Header().Get("RateLimit-Limit"))
+			}
+		}
+	})
+
+	t.Run("rejection headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/receipts/process", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Header().Get("Retry-After") != "2" {
+			t.Errorf("expected Retry-After 2, got %q", rr.Header().Get("Retry-After"))
+		}
+		if rr.Header().Get("RateLimit-Remaining") != "0" {
+			t.Errorf("expected RateLimit-Remaining 0, got %q", rr.Header().Get("RateLimit-Remaining"))
+		}
+	})
+
+	t.Run("unlimited route", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/receipts/abc/points", nil)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+		}
+	})
+}
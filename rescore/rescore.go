@@ -0,0 +1,394 @@
+// Package rescore recomputes the points of stored receipts with a chosen
+// version of the scoring rules. Jobs run in the background, paging through
+// a tenant's receipts, and can be paused, resumed or cancelled.
+package rescore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/processor"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+// DefaultPageSize is how many receipts a job reads from the store at a
+// time.
+const DefaultPageSize = 100
+
+// DefaultMaxJobs is how many jobs, with their change reports, a tenant
+// keeps.
+const DefaultMaxJobs = 20
+
+// Statuses of a job.
+const (
+	StatusRunning   = "running"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+var (
+	ErrJobNotFound = errors.New("rescore job not found")
+	ErrJobRunning  = errors.New("rescore job already running for tenant")
+	ErrJobFinished = errors.New("rescore job already finished")
+)
+
+// errNotScored stops a job's update of a receipt whose points stopped
+// counting after it was read.
+var errNotScored = errors.New("receipt not scored")
+
+// Progress reports how far a job has got. Total is the number of receipts
+// the tenant had when the job started. Rescored receipts are the held and
+// credited ones; the rest are skipped. PointsBefore and PointsAfter sum
+// the rescored receipts' points under their recorded score and under the
+// job's rules.
+type Progress struct {
+	ID           string     `json:"id"`
+	Tenant       string     `json:"tenant"`
+	Version      string     `json:"version,omitempty"`
+	DryRun       bool       `json:"dryRun"`
+	Status       string     `json:"status"`
+	Total        int        `json:"total"`
+	Scanned      int        `json:"scanned"`
+	Rescored     int        `json:"rescored"`
+	Changed      int        `json:"changed"`
+	Skipped      int        `json:"skipped"`
+	PointsBefore int        `json:"pointsBefore"`
+	PointsAfter  int        `json:"pointsAfter"`
+	StartedAt    time.Time  `json:"startedAt"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Change is a receipt whose points the job changed, or would change in a
+// dry run. OldVersion is the version of the rules that scored it before,
+// empty for unversioned rules or receipts stored before scores were
+// recorded.
+type Change struct {
+	ID         string `json:"id"`
+	OldPoints  int    `json:"oldPoints"`
+	NewPoints  int    `json:"newPoints"`
+	OldVersion string `json:"oldVersion,omitempty"`
+}
+
+// Job is a single re-scoring run over one tenant's receipts. It is safe for
+// concurrent use.
+type Job struct {
+	progress Progress
+	changes  []Change
+	wake     chan struct{}
+	cancel   context.CancelFunc
+	done     chan struct{}
+	mu       sync.Mutex
+}
+
+// Progress returns a snapshot of the job's progress.
+func (j *Job) Progress() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// Changes returns the receipts whose points changed so far, in the order
+// the job reached them.
+func (j *Job) Changes() []Change {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Change{}, j.changes...)
+}
+
+// Pause stops the job once it finishes the page it is on. Pausing a paused
+// job changes nothing.
+func (j *Job) Pause() (Progress, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch j.progress.Status {
+	case StatusRunning:
+		j.progress.Status = StatusPaused
+		j.wake = make(chan struct{})
+	case StatusPaused:
+	default:
+		return j.progress, ErrJobFinished
+	}
+	return j.progress, nil
+}
+
+// Resume continues a paused job from where it stopped. Resuming a running
+// job changes nothing.
+func (j *Job) Resume() (Progress, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch j.progress.Status {
+	case StatusPaused:
+		j.progress.Status = StatusRunning
+		close(j.wake)
+		j.wake = nil
+	case StatusRunning:
+	default:
+		return j.progress, ErrJobFinished
+	}
+	return j.progress, nil
+}
+
+// Cancel stops the job, running or paused, and waits for it to finish.
+// Receipts it already re-scored keep their new scores.
+func (j *Job) Cancel() (Progress, error) {
+	j.mu.Lock()
+	status := j.progress.Status
+	j.mu.Unlock()
+	if status != StatusRunning && status != StatusPaused {
+		return j.Progress(), ErrJobFinished
+	}
+	j.cancel()
+	<-j.done
+	return j.Progress(), nil
+}
+
+// wait blocks while the job is paused, and returns ctx's error once it is
+// cancelled.
+func (j *Job) wait(ctx context.Context) error {
+	for {
+		j.mu.Lock()
+		wake := j.wake
+		j.mu.Unlock()
+		if wake == nil {
+			return ctx.Err()
+		}
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (j *Job) tally(record store.Record, rescored bool, before, after int, version string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress.Scanned++
+	if !rescored {
+		j.progress.Skipped++
+		return
+	}
+	j.progress.Rescored++
+	j.progress.PointsBefore += before
+	j.progress.PointsAfter += after
+	if before != after {
+		j.progress.Changed++
+		j.changes = append(j.changes, Change{ID: record.ID, OldPoints: before, NewPoints: after, OldVersion: version})
+	}
+}
+
+func (j *Job) finish(status string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now().UTC()
+	j.progress.Status = status
+	j.progress.FinishedAt = &now
+	j.wake = nil
+}
+
+// Manager starts re-scoring jobs and keeps them so their progress can be
+// followed. Each tenant runs at most one job at a time and keeps its
+// MaxJobs most recent ones; zero means no limit.
+type Manager struct {
+	Store    *store.Store
+	Tenants  *tenant.Registry
+	PageSize int
+	MaxJobs  int
+
+	jobs map[string]*Job
+	mu   sync.Mutex
+}
+
+func NewManager(s *store.Store, tenants *tenant.Registry) *Manager {
+	return &Manager{Store: s, Tenants: tenants, PageSize: DefaultPageSize, MaxJobs: DefaultMaxJobs, jobs: make(map[string]*Job)}
+}
+
+// Start begins re-scoring the tenant's receipts with rules, or with the
+// tenant's current rules when rules is nil. A dry run reports the changes
+// without recording them. The job outlives ctx but keeps its values.
+func (m *Manager) Start(ctx context.Context, tenantID string, rules *processor.Rules, dryRun bool) (*Job, error) {
+	current := m.Tenants.Rules(tenantID)
+	if rules == nil {
+		rules = &current
+	}
+	ctx, job, err := m.add(ctx, tenantID, rules.Version, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "rescore started", "tenant", tenantID, "job", job.progress.ID,
+		"version", rules.Version, "dry_run", dryRun)
+	go m.run(ctx, job, *rules, current)
+	return job, nil
+}
+
+// add registers a new running job for the tenant, unless it already has
+// one, and returns the context the job runs in.
+func (m *Manager) add(ctx context.Context, tenantID, version string, dryRun bool) (context.Context, *Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if p := job.Progress(); p.Tenant == tenantID && (p.Status == StatusRunning || p.Status == StatusPaused) {
+			return nil, nil, ErrJobRunning
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job := &Job{
+		progress: Progress{
+			ID:        uuid.New().String(),
+			Tenant:    tenantID,
+			Version:   version,
+			DryRun:    dryRun,
+			Status:    StatusRunning,
+			Total:     m.Store.Count(tenantID),
+			StartedAt: time.Now().UTC(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	m.jobs[job.progress.ID] = job
+	m.prune(tenantID)
+	return ctx, job, nil
+}
+
+// prune makes room for a new job by dropping the tenant's oldest finished
+// jobs beyond MaxJobs. The caller holds m.mu.
+func (m *Manager) prune(tenantID string) {
+	if m.MaxJobs <= 0 {
+		return
+	}
+	var tenants []Progress
+	for _, job := range m.jobs {
+		if p := job.Progress(); p.Tenant == tenantID {
+			tenants = append(tenants, p)
+		}
+	}
+	if len(tenants) <= m.MaxJobs {
+		return
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].StartedAt.Before(tenants[j].StartedAt) })
+	excess := len(tenants) - m.MaxJobs
+	for _, p := range tenants {
+		if excess == 0 {
+			break
+		}
+		if p.FinishedAt != nil {
+			delete(m.jobs, p.ID)
+			excess--
+		}
+	}
+}
+
+// Job returns one of the tenant's jobs.
+func (m *Manager) Job(tenantID, id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.progress.Tenant != tenantID {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// Jobs returns the progress of the tenant's jobs, oldest first.
+func (m *Manager) Jobs(tenantID string) []Progress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := []Progress{}
+	for _, job := range m.jobs {
+		if p := job.Progress(); p.Tenant == tenantID {
+			jobs = append(jobs, p)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.Before(jobs[j].StartedAt) })
+	return jobs
+}
+
+func (m *Manager) run(ctx context.Context, job *Job, rules, current processor.Rules) {
+	defer close(job.done)
+	defer job.cancel()
+
+	tenantID, dryRun := job.progress.Tenant, job.progress.DryRun
+	pageSize := m.PageSize
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	after := ""
+	for {
+		if err := job.wait(ctx); err != nil {
+			job.finish(StatusCancelled)
+			break
+		}
+		page := m.Store.Page(ctx, tenantID, after, pageSize)
+		if len(page) == 0 {
+			job.finish(StatusCompleted)
+			break
+		}
+		for _, record := range page {
+			m.rescore(ctx, job, tenantID, record, rules, current, dryRun)
+		}
+		after = page[len(page)-1].ID
+	}
+
+	p := job.Progress()
+	slog.InfoContext(ctx, "rescore finished", "tenant", tenantID, "job", p.ID, "status", p.Status,
+		"rescored", p.Rescored, "changed", p.Changed, "points_before", p.PointsBefore, "points_after", p.PointsAfter)
+}
+
+// rescore recomputes one receipt's points. Only held and credited receipts
+// have points that count; voided, refunded, rejected and pending ones are
+// skipped, as are receipts whose amounts can no longer be converted to the
+// base currency.
+func (m *Manager) rescore(ctx context.Context, job *Job, tenantID string, record store.Record, rules, current processor.Rules, dryRun bool) {
+	breakdown, err := rules.Breakdown(record.Receipt)
+	if err != nil {
+		slog.WarnContext(ctx, "rescoring receipt failed", "tenant", tenantID, "job", job.progress.ID,
+			"receipt_id", record.ID, "error", err)
+		job.tally(record, false, 0, 0, "")
+		return
+	}
+	if !record.Metadata.Reconciliation.Scores() {
+		breakdown = []processor.RulePoints{}
+	}
+	points := 0
+	for _, awarded := range breakdown {
+		points += awarded.Points
+	}
+	var before int
+	var version string
+	read := func(record store.Record) error {
+		if state := record.State(); state != models.StateHeld && state != models.StateCredited {
+			return errNotScored
+		}
+		before = record.Points(current)
+		if record.Metadata.Score != nil {
+			version = record.Metadata.Score.Version
+		}
+		return nil
+	}
+
+	if dryRun {
+		err = read(record)
+	} else {
+		_, err = m.Store.UpdateMetadata(ctx, tenantID, record.ID, func(metadata *models.Metadata) error {
+			if err := read(store.Record{ID: record.ID, Receipt: record.Receipt, Metadata: *metadata}); err != nil {
+				return err
+			}
+			metadata.Score = &models.Score{Points: points, Breakdown: breakdown, Version: rules.Version, At: time.Now().UTC()}
+			return nil
+		})
+	}
+	if err != nil && !errors.Is(err, errNotScored) {
+		slog.WarnContext(ctx, "rescoring receipt failed", "tenant", tenantID, "job", job.progress.ID,
+			"receipt_id", record.ID, "error", err)
+	}
+	job.tally(record, err == nil, before, points, version)
+}
@@ -0,0 +1,261 @@
+package rescore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/processor"
+	"github.com/receipt-processor/store"
+	"github.com/receipt-processor/tenant"
+)
+
+// newTestManager stores four receipts worth 37 points under the default
+// rules: credited and held ones scored with v1, a credited one stored
+// before scores were recorded, and a voided one.
+func newTestManager(t *testing.T) (*Manager, map[string]string) {
+	t.Helper()
+	s := store.NewStore()
+	ctx := context.Background()
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.25"}},
+		Total:        "1.25",
+	}
+	now := time.Now().UTC()
+	scored := models.NewLifecycle(now).To(models.StateValidated, now).To(models.StateScored, now)
+	v1 := &models.Score{Points: 37, Version: "v1", At: now}
+
+	ids := make(map[string]string)
+	for name, metadata := range map[string]models.Metadata{
+		"credited": {Lifecycle: scored.To(models.StateCredited, now), Score: v1},
+		"held":     {Lifecycle: scored.To(models.StateHeld, now), Score: v1},
+		"voided":   {Lifecycle: scored.To(models.StateHeld, now).To(models.StateVoided, now), Score: v1},
+		"legacy":   {},
+	} {
+		id, err := s.SaveRecord(ctx, "acme", receipt, metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = id
+	}
+
+	m := NewManager(s, tenant.NewRegistry())
+	m.PageSize = 1
+	return m, ids
+}
+
+func v2Rules() *processor.Rules {
+	rules := processor.DefaultRules
+	rules.Version = "v2"
+	rules.RetailerCharPoints = 2
+	return &rules
+}
+
+func TestRescoreDryRun(t *testing.T) {
+	m, ids := newTestManager(t)
+	job, err := m.Start(context.Background(), "acme", v2Rules(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-job.done
+
+	p := job.Progress()
+	if p.Status != StatusCompleted || p.Total != 4 || p.Scanned != 4 || p.Rescored != 3 || p.Skipped != 1 || p.Changed != 3 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+	if p.Version != "v2" || !p.DryRun || p.PointsBefore != 111 || p.PointsAfter != 129 || p.FinishedAt == nil {
+		t.Errorf("unexpected report %+v", p)
+	}
+	versions := make(map[string]string)
+	for _, change := range job.Changes() {
+		if change.OldPoints != 37 || change.NewPoints != 43 {
+			t.Errorf("unexpected change %+v", change)
+		}
+		versions[change.ID] = change.OldVersion
+	}
+	if len(versions) != 3 || versions[ids["credited"]] != "v1" || versions[ids["legacy"]] != "" {
+		t.Errorf("unexpected changed receipts %v", versions)
+	}
+
+	record, _ := m.Store.GetRecord(context.Background(), "acme", ids["credited"])
+	if record.Metadata.Score.Version != "v1" {
+		t.Errorf("expected a dry run to leave scores alone, got %+v", record.Metadata.Score)
+	}
+}
+
+func TestRescore(t *testing.T) {
+	m, ids := newTestManager(t)
+	job, err := m.Start(context.Background(), "acme", v2Rules(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-job.done
+
+	if p := job.Progress(); p.Status != StatusCompleted || p.Rescored != 3 || p.Changed != 3 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+	for name, id := range ids {
+		record, _ := m.Store.GetRecord(context.Background(), "acme", id)
+		score := record.Metadata.Score
+		if name == "voided" {
+			if score.Version != "v1" {
+				t.Errorf("expected the voided receipt to be skipped, got %+v", score)
+			}
+			continue
+		}
+		if score == nil || score.Points != 43 || score.Version != "v2" || record.Points(processor.DefaultRules) != 43 {
+			t.Errorf("%s: expected a v2 score of 43, got %+v", name, score)
+		}
+	}
+
+	// Without rules the tenant's current ones are used.
+	job, err = m.Start(context.Background(), "acme", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-job.done
+	if p := job.Progress(); p.Version != "" || p.PointsBefore != 129 || p.PointsAfter != 111 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+}
+
+func TestRescoreWarnedMismatch(t *testing.T) {
+	s := store.NewStore()
+	ctx := context.Background()
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Pepsi", Price: "1.00"}},
+		Total:        "1000.00",
+	}
+	now := time.Now().UTC()
+	id, err := s.SaveRecord(ctx, "acme", receipt, models.Metadata{
+		Lifecycle:      models.NewLifecycle(now).To(models.StateValidated, now).To(models.StateScored, now).To(models.StateCredited, now),
+		Reconciliation: &models.Reconciliation{Expected: "1.00", Difference: "999.00", Outcome: models.OutcomeWarned},
+		Score:          &models.Score{Points: 0, Breakdown: []models.RulePoints{}, Version: "v1", At: now},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := NewManager(s, tenant.NewRegistry()).Start(ctx, "acme", v2Rules(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-job.done
+
+	if p := job.Progress(); p.Rescored != 1 || p.Changed != 0 || p.PointsAfter != 0 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+	record, _ := s.GetRecord(ctx, "acme", id)
+	if score := record.Metadata.Score; score.Points != 0 || score.Version != "v2" {
+		t.Errorf("expected the warned receipt to stay at 0 points, got %+v", score)
+	}
+}
+
+func TestRescorePauseResume(t *testing.T) {
+	m, _ := newTestManager(t)
+	rules := *v2Rules()
+	ctx, job, err := m.add(context.Background(), "acme", rules.Version, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := job.Pause(); err != nil || p.Status != StatusPaused {
+		t.Fatalf("expected the job to pause, got %s %v", p.Status, err)
+	}
+	go m.run(ctx, job, rules, processor.DefaultRules)
+
+	time.Sleep(10 * time.Millisecond)
+	if p := job.Progress(); p.Scanned != 0 {
+		t.Errorf("expected a paused job to wait, got %+v", p)
+	}
+	if _, err := m.Start(context.Background(), "acme", nil, true); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("expected a second job to be refused, got %v", err)
+	}
+	if _, err := m.Start(context.Background(), "other", nil, true); err != nil {
+		t.Errorf("expected another tenant's job to start, got %v", err)
+	}
+
+	if p, err := job.Resume(); err != nil || p.Status != StatusRunning {
+		t.Fatalf("expected the job to resume, got %s %v", p.Status, err)
+	}
+	<-job.done
+	if p := job.Progress(); p.Status != StatusCompleted || p.Scanned != 4 {
+		t.Errorf("unexpected progress %+v", p)
+	}
+	if _, err := job.Pause(); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("expected a finished job not to pause, got %v", err)
+	}
+	if _, err := job.Cancel(); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("expected a finished job not to cancel, got %v", err)
+	}
+}
+
+func TestRescoreCancel(t *testing.T) {
+	m, ids := newTestManager(t)
+	rules := *v2Rules()
+	ctx, job, err := m.add(context.Background(), "acme", rules.Version, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.Pause()
+	go m.run(ctx, job, rules, processor.DefaultRules)
+
+	p, err := job.Cancel()
+	if err != nil || p.Status != StatusCancelled || p.Scanned != 0 || p.FinishedAt == nil {
+		t.Errorf("expected the job to be cancelled, got %+v %v", p, err)
+	}
+	if _, err := job.Resume(); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("expected a cancelled job not to resume, got %v", err)
+	}
+	record, _ := m.Store.GetRecord(context.Background(), "acme", ids["credited"])
+	if record.Metadata.Score.Version != "v1" {
+		t.Errorf("expected the cancelled job to leave scores alone, got %+v", record.Metadata.Score)
+	}
+
+	if _, err := m.Job("other", p.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected jobs to be scoped to their tenant, got %v", err)
+	}
+	if jobs := m.Jobs("acme"); len(jobs) != 1 || jobs[0].ID != p.ID {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+	if _, err := m.Start(context.Background(), "acme", nil, true); err != nil {
+		t.Errorf("expected a new job once the last was cancelled, got %v", err)
+	}
+}
+
+func TestRescoreKeepsRecentJobs(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.MaxJobs = 2
+	var started []string
+	for range 4 {
+		job, err := m.Start(context.Background(), "acme", nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-job.done
+		started = append(started, job.Progress().ID)
+	}
+	other, err := m.Start(context.Background(), "other", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-other.done
+
+	jobs := m.Jobs("acme")
+	if len(jobs) != 2 || jobs[0].ID != started[2] || jobs[1].ID != started[3] {
+		t.Errorf("expected the two most recent jobs, got %+v", jobs)
+	}
+	if _, err := m.Job("acme", started[0]); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("expected the oldest job to be dropped, got %v", err)
+	}
+	if jobs := m.Jobs("other"); len(jobs) != 1 {
+		t.Errorf("expected other tenants' jobs to be kept, got %+v", jobs)
+	}
+}
@@ -0,0 +1,134 @@
+// Package retailer maps the retailer names printed on receipts, such as
+// "TARGET" or "Target #1234", to canonical retailers so rules and reports
+// treat them as one.
+package retailer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/receipt-processor/models"
+)
+
+// Retailer is a canonical retailer. A receipt matches it when its retailer
+// name equals Name or one of Aliases, ignoring case and runs of spaces. An
+// alias may use * to stand for any characters, as in "Target #*".
+type Retailer struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Category string   `json:"category,omitempty"`
+	Chain    string   `json:"chain,omitempty"`
+	Aliases  []string `json:"aliases,omitempty"`
+}
+
+type pattern struct {
+	re    *regexp.Regexp
+	index int
+}
+
+// Registry matches retailer names to canonical retailers. It is read-only
+// once built.
+type Registry struct {
+	retailers []Retailer
+	byID      map[string]int
+	exact     map[string]int
+	patterns  []pattern
+}
+
+// Default is the registry used at ingestion and for scoring. It matches
+// nothing until main installs the configured retailers.
+var Default = &Registry{}
+
+// NewRegistry builds a registry. Exact names and aliases take precedence
+// over wildcard aliases; among wildcard aliases the first listed wins.
+func NewRegistry(retailers []Retailer) (*Registry, error) {
+	reg := &Registry{
+		retailers: retailers,
+		byID:      make(map[string]int, len(retailers)),
+		exact:     make(map[string]int),
+	}
+	for i, r := range retailers {
+		if r.ID == "" || strings.TrimSpace(r.Name) == "" {
+			return nil, errors.New("retailers need an id and a name")
+		}
+		if _, ok := reg.byID[r.ID]; ok {
+			return nil, fmt.Errorf("duplicate retailer id %q", r.ID)
+		}
+		reg.byID[r.ID] = i
+
+		for _, name := range append([]string{r.Name}, r.Aliases...) {
+			key := Key(name)
+			if key == "" {
+				return nil, fmt.Errorf("retailer %q: empty alias", r.ID)
+			}
+			if !strings.Contains(key, "*") {
+				if other, ok := reg.exact[key]; ok && other != i {
+					return nil, fmt.Errorf("alias %q belongs to both %q and %q", name, retailers[other].ID, r.ID)
+				}
+				reg.exact[key] = i
+				continue
+			}
+			parts := strings.Split(key, "*")
+			for j, part := range parts {
+				parts[j] = regexp.QuoteMeta(part)
+			}
+			re := regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+			reg.patterns = append(reg.patterns, pattern{re: re, index: i})
+		}
+	}
+	return reg, nil
+}
+
+// LoadFile reads a registry from a JSON array of Retailer.
+func LoadFile(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var retailers []Retailer
+	if err := json.Unmarshal(data, &retailers); err != nil {
+		return nil, fmt.Errorf("parsing retailers %s: %w", path, err)
+	}
+	return NewRegistry(retailers)
+}
+
+// Key is the form names are compared in: lower case, trimmed, with runs of
+// spaces collapsed to one.
+func Key(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Match finds the canonical retailer for a printed retailer name.
+func (reg *Registry) Match(name string) (Retailer, bool) {
+	key := Key(name)
+	if i, ok := reg.exact[key]; ok {
+		return reg.retailers[i], true
+	}
+	for _, p := range reg.patterns {
+		if p.re.MatchString(key) {
+			return reg.retailers[p.index], true
+		}
+	}
+	return Retailer{}, false
+}
+
+// Canonical is the form recorded in a stored receipt's metadata.
+func (r Retailer) Canonical() *models.CanonicalRetailer {
+	return &models.CanonicalRetailer{ID: r.ID, Name: r.Name, Category: r.Category, Chain: r.Chain}
+}
+
+func (reg *Registry) Get(id string) (Retailer, bool) {
+	i, ok := reg.byID[id]
+	if !ok {
+		return Retailer{}, false
+	}
+	return reg.retailers[i], true
+}
+
+func (reg *Registry) All() []Retailer {
+	return append([]Retailer(nil), reg.retailers...)
+}
@@ -0,0 +1,105 @@
+package retailer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testRetailers = []Retailer{
+	{ID: "target", Name: "Target", Category: "general", Chain: "Target Corporation", Aliases: []string{"Target Store", "Target #*", "Target - *"}},
+	{ID: "target-optical", Name: "Target Optical", Category: "optical"},
+	{ID: "heb", Name: "H-E-B", Category: "grocery", Aliases: []string{"HEB", "H.E.B.", "HEB *"}},
+}
+
+func TestMatch(t *testing.T) {
+	reg, err := NewRegistry(testRetailers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"Target", "target"},
+		{"TARGET", "target"},
+		{"Target ", "target"},
+		{"  target   store ", "target"},
+		{"Target #1234", "target"},
+		{"Target - Downtown", "target"},
+		{"Target Optical", "target-optical"},
+		{"H.E.B.", "heb"},
+		{"heb plus 42", "heb"},
+		{"Targeted Marketing", ""},
+		{"Walgreens", ""},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, ok := reg.Match(tc.name)
+			if ok != (tc.expected != "") || r.ID != tc.expected {
+				t.Errorf("Match(%q) = %q, %v; expected %q", tc.name, r.ID, ok, tc.expected)
+			}
+		})
+	}
+
+	if _, ok := Default.Match("Target"); ok {
+		t.Error("expected the empty default registry to match nothing")
+	}
+}
+
+func TestExactAliasWinsOverWildcard(t *testing.T) {
+	reg, err := NewRegistry([]Retailer{
+		{ID: "shell", Name: "Shell", Aliases: []string{"Shell *"}},
+		{ID: "shell-select", Name: "Shell Select"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := reg.Match("Shell Select"); r.ID != "shell-select" {
+		t.Errorf("expected the exact name to win, got %q", r.ID)
+	}
+	if r, _ := reg.Match("Shell 0042"); r.ID != "shell" {
+		t.Errorf("expected the wildcard alias to match, got %q", r.ID)
+	}
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		retailers []Retailer
+	}{
+		{"missing id", []Retailer{{Name: "Target"}}},
+		{"missing name", []Retailer{{ID: "target", Name: " "}}},
+		{"duplicate id", []Retailer{{ID: "target", Name: "Target"}, {ID: "target", Name: "Target Store"}}},
+		{"shared alias", []Retailer{{ID: "a", Name: "Target"}, {ID: "b", Name: "B", Aliases: []string{"TARGET"}}}},
+		{"empty alias", []Retailer{{ID: "target", Name: "Target", Aliases: []string{"  "}}}},
+	}
+
+	for _, tc := range testCases {
+		if _, err := NewRegistry(tc.retailers); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retailers.json")
+	data := `[{"id": "target", "name": "Target", "aliases": ["Target #*"]}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := reg.Get("target"); !ok || r.Name != "Target" {
+		t.Errorf("expected target to be registered, got %+v", r)
+	}
+	if len(reg.All()) != 1 {
+		t.Errorf("expected one retailer, got %d", len(reg.All()))
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/receipt-processor/store"
+)
+
+type Timeouts struct {
+	Read     time.Duration
+	Write    time.Duration
+	Idle     time.Duration
+	Shutdown time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Read:     10 * time.Second,
+	Write:    30 * time.Second,
+	Idle:     120 * time.Second,
+	Shutdown: 30 * time.Second,
+}
+
+type Server struct {
+	http     *http.Server
+	store    *store.Store
+	shutdown time.Duration
+	tls      bool
+	drains   []func(context.Context)
+}
+
+func New(addr string, handler http.Handler, s *store.Store, timeouts Timeouts) *Server {
+	return &Server{
+		http: &http.Server{
+			Addr:         addr,
+			Handler:      handler,
+			ReadTimeout:  timeouts.Read,
+			WriteTimeout: timeouts.Write,
+			IdleTimeout:  timeouts.Idle,
+		},
+		store:    s,
+		shutdown: timeouts.Shutdown,
+	}
+}
+
+// UseTLS serves HTTPS with the given configuration, which must supply
+// certificates through GetCertificate or GetConfigForClient.
+func (s *Server) UseTLS(cfg *tls.Config) {
+	s.http.TLSConfig = cfg
+	s.tls = true
+}
+
+// OnShutdown registers a function to call as soon as shutdown begins, before
+// in-flight requests have drained.
+func (s *Server) OnShutdown(f func()) {
+	s.http.RegisterOnShutdown(f)
+}
+
+// OnDrain registers a function that drains another listener, such as the
+// gRPC server, while HTTP requests drain. It receives the shutdown deadline
+// and must return before the store is flushed.
+func (s *Server) OnDrain(f func(ctx context.Context)) {
+	s.drains = append(s.drains, f)
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve accepts connections on listener until ctx is cancelled, then stops
+// accepting new requests, waits for in-flight requests to finish and
+// flushes the store.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", listener.Addr().String(), "tls", s.tls)
+		if s.tls {
+			serveErr <- s.http.ServeTLS(listener, "", "")
+			return
+		}
+		serveErr <- s.http.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdown)
+	defer cancel()
+
+	var drained sync.WaitGroup
+	for _, drain := range s.drains {
+		drained.Add(1)
+		go func() {
+			defer drained.Done()
+			drain(shutdownCtx)
+		}()
+	}
+
+	shutdownErr := s.http.Shutdown(shutdownCtx)
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		shutdownErr = errors.Join(shutdownErr, err)
+	}
+	drained.Wait()
+
+	if err := s.store.Flush(); err != nil {
+		shutdownErr = errors.Join(shutdownErr, err)
+	}
+	return shutdownErr
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/events"
+	"github.com/receipt-processor/handlers"
+	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/store"
+)
+
+func TestServeGracefulShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.json")
+	s := store.Open(path)
+	if err := s.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := s.SaveReceipt(context.Background(), "default", models.Receipt{Retailer: "Target", Total: "1.00"})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := New("", handler, s, DefaultTimeouts)
+	shutdownStarted := make(chan struct{})
+	srv.OnShutdown(func() { close(shutdownStarted) })
+	var drained bool
+	srv.OnDrain(func(context.Context) {
+		time.Sleep(10 * time.Millisecond)
+		drained = true
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveDone := make(chan error, 1)
+	go func() { serveDone <- srv.Serve(ctx, listener) }()
+
+	responseBody := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responseBody <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		responseBody <- string(body)
+	}()
+
+	<-started
+	cancel()
+	<-shutdownStarted
+	close(release)
+
+	if body := <-responseBody; body != "done" {
+		t.Errorf("expected in-flight request to complete, got %q", body)
+	}
+
+	select {
+	case err := <-serveDone:
+		if err != nil {
+			t.Fatalf("unexpected shutdown error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+	if !drained {
+		t.Error("expected Serve to wait for drain functions")
+	}
+
+	recovered := store.Open(path)
+	if err := recovered.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recovered.GetReceipt(context.Background(), "default", id); err != nil {
+		t.Errorf("expected store to be flushed on shutdown: %v", err)
+	}
+}
+
+func TestRunListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	srv := New(listener.Addr().String(), http.NotFoundHandler(), store.NewStore(), DefaultTimeouts)
+	if err := srv.Run(context.Background()); err == nil {
+		t.Error("expected error when the address is already in use")
+	}
+}
+
+func TestServeShutdownWithOpenStream(t *testing.T) {
+	bus := events.NewBus(0, 10)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeouts := DefaultTimeouts
+	timeouts.Shutdown = 2 * time.Second
+	srv := New("", handlers.NewStreamHandler(bus), store.NewStore(), timeouts)
+	srv.OnShutdown(bus.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveDone := make(chan error, 1)
+	go func() { serveDone <- srv.Serve(ctx, listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if bus.Subscribers() != 1 {
+		t.Fatalf("expected the stream to subscribe, got %d subscribers", bus.Subscribers())
+	}
+
+	started := time.Now()
+	cancel()
+	select {
+	case err := <-serveDone:
+		if err != nil {
+			t.Fatalf("unexpected shutdown error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+	if elapsed := time.Since(started); elapsed >= timeouts.Shutdown {
+		t.Errorf("expected the stream not to hold up shutdown, took %v", elapsed)
+	}
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("expected the stream to end cleanly, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/receipt-processor/models"
+)
+
+var (
+	ErrInvalidTransition = errors.New("invalid lifecycle transition")
+	ErrNotCredited       = errors.New("receipt points not credited")
+)
+
+// transitions lists the states each state may move to. Rejected, voided
+// and refunded receipts stay that way.
+var transitions = map[string][]string{
+	models.StateReceived:  {models.StateValidated, models.StateRejected},
+	models.StateValidated: {models.StateScored},
+	models.StateScored:    {models.StateHeld, models.StateCredited},
+	models.StateHeld:      {models.StateCredited, models.StateVoided},
+	models.StateCredited:  {models.StateRefunded},
+}
+
+// CanTransition reports whether a receipt in state from may move to state
+// to.
+func CanTransition(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// checkLifecycle verifies that next continues previous, which is nil for a
+// receipt being saved, through allowed transitions only: history already
+// recorded cannot be rewritten or dropped, and a new lifecycle starts in
+// the received state.
+func checkLifecycle(previous, next *models.Lifecycle) error {
+	if next == nil {
+		if previous != nil {
+			return fmt.Errorf("%w: lifecycle cannot be removed", ErrInvalidTransition)
+		}
+		return nil
+	}
+	if len(next.History) == 0 || next.State != next.History[len(next.History)-1].State {
+		return fmt.Errorf("%w: state %q does not match its history", ErrInvalidTransition, next.State)
+	}
+
+	var recorded []models.Transition
+	if previous != nil {
+		recorded = previous.History
+	}
+	if len(next.History) < len(recorded) || !slices.Equal(next.History[:len(recorded)], recorded) {
+		return fmt.Errorf("%w: history cannot be rewritten", ErrInvalidTransition)
+	}
+	for i := len(recorded); i < len(next.History); i++ {
+		to := next.History[i].State
+		if i == 0 {
+			if to != models.StateReceived {
+				return fmt.Errorf("%w: receipts start %s, not %s", ErrInvalidTransition, models.StateReceived, to)
+			}
+			continue
+		}
+		if from := next.History[i-1].State; !CanTransition(from, to) {
+			return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+		}
+	}
+	return nil
+}
+
+// Transition moves a stored receipt to state, stamped with the store's
+// clock.
+func (s *Store) Transition(ctx context.Context, tenantID, id, state string) (Record, error) {
+	return s.UpdateMetadata(ctx, tenantID, id, func(m *models.Metadata) error {
+		if m.Lifecycle == nil {
+			return fmt.Errorf("%w: receipt has no lifecycle", ErrInvalidTransition)
+		}
+		m.Lifecycle = m.Lifecycle.To(state, s.now().UTC())
+		return nil
+	})
+}
+
+// Refund takes a credited receipt's points back, moving it to refunded and
+// recording refund with the store's clock. Receipts in any other state,
+// including credited ones stored before lifecycles were recorded, fail
+// with ErrNotCredited.
+func (s *Store) Refund(ctx context.Context, tenantID, id string, refund models.Refund) (Record, error) {
+	return s.UpdateMetadata(ctx, tenantID, id, func(m *models.Metadata) error {
+		if m.Lifecycle == nil || m.Lifecycle.State != models.StateCredited {
+			return ErrNotCredited
+		}
+		refund.At = s.now().UTC()
+		m.Refund = &refund
+		m.Lifecycle = m.Lifecycle.To(models.StateRefunded, refund.At)
+		return nil
+	})
+}
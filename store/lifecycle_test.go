@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/receipt-processor/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	allowed := [][2]string{
+		{models.StateReceived, models.StateValidated},
+		{models.StateReceived, models.StateRejected},
+		{models.StateValidated, models.StateScored},
+		{models.StateScored, models.StateHeld},
+		{models.StateScored, models.StateCredited},
+		{models.StateHeld, models.StateCredited},
+		{models.StateHeld, models.StateVoided},
+		{models.StateCredited, models.StateRefunded},
+	}
+	for _, move := range allowed {
+		if !CanTransition(move[0], move[1]) {
+			t.Errorf("Expected %s to %s to be allowed", move[0], move[1])
+		}
+	}
+
+	disallowed := [][2]string{
+		{models.StateReceived, models.StateCredited},
+		{models.StateScored, models.StateVoided},
+		{models.StateCredited, models.StateHeld},
+		{models.StateVoided, models.StateCredited},
+		{models.StateRefunded, models.StateCredited},
+		{models.StateHeld, models.StateHeld},
+		{models.StateValidated, models.StateRejected},
+		{models.StateRejected, models.StateValidated},
+	}
+	for _, move := range disallowed {
+		if CanTransition(move[0], move[1]) {
+			t.Errorf("Expected %s to %s to be disallowed", move[0], move[1])
+		}
+	}
+}
+
+func TestStoreLifecycle(t *testing.T) {
+	store := NewStore()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	receipt := models.Receipt{Retailer: "TestStore", Total: "1.00"}
+
+	lifecycle := models.NewLifecycle(now).To(models.StateValidated, now).To(models.StateScored, now)
+	if _, err := store.SaveRecord(ctx, "tenant-a", receipt, models.Metadata{Lifecycle: lifecycle.To(models.StateVoided, now)}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected a skipped review to be rejected, got %v", err)
+	}
+	skipped := &models.Lifecycle{State: models.StateCredited, History: []models.Transition{{State: models.StateCredited, At: now}}}
+	if _, err := store.SaveRecord(ctx, "tenant-a", receipt, models.Metadata{Lifecycle: skipped}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected a lifecycle not starting received to be rejected, got %v", err)
+	}
+	if store.Count("tenant-a") != 0 {
+		t.Fatalf("Expected invalid lifecycles not to be saved")
+	}
+
+	id, err := store.SaveRecord(ctx, "tenant-a", receipt, models.Metadata{Lifecycle: lifecycle.To(models.StateHeld, now)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Transition(ctx, "tenant-a", id, models.StateRefunded); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected held to refunded to be rejected, got %v", err)
+	}
+	now = now.Add(time.Hour)
+	record, err := store.Transition(ctx, "tenant-a", id, models.StateCredited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := record.History()
+	if record.State() != models.StateCredited || len(history) != 5 || !history[4].At.Equal(now) {
+		t.Errorf("Expected a timestamped move to credited, got %s %+v", record.State(), history)
+	}
+
+	if _, err := store.UpdateMetadata(ctx, "tenant-a", id, func(m *models.Metadata) error {
+		m.Lifecycle = models.NewLifecycle(now)
+		return nil
+	}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected rewriting history to be rejected, got %v", err)
+	}
+	if _, err := store.UpdateMetadata(ctx, "tenant-a", id, func(m *models.Metadata) error {
+		m.Lifecycle = nil
+		return nil
+	}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected dropping the lifecycle to be rejected, got %v", err)
+	}
+	if stored, _ := store.GetRecord(ctx, "tenant-a", id); stored.State() != models.StateCredited {
+		t.Errorf("Expected rejected updates to leave the state credited, got %s", stored.State())
+	}
+
+	legacy, _ := store.SaveReceipt(ctx, "tenant-a", receipt)
+	if _, err := store.Transition(ctx, "tenant-a", legacy, models.StateRefunded); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected receipts without a lifecycle not to transition, got %v", err)
+	}
+	if record, _ := store.GetRecord(ctx, "tenant-a", legacy); record.State() != models.StateCredited || record.History() != nil {
+		t.Errorf("Expected a legacy receipt to be credited without history, got %s %+v", record.State(), record.History())
+	}
+}
+
+func TestStoreRefund(t *testing.T) {
+	store := NewStore()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	receipt := models.Receipt{Retailer: "TestStore", Total: "1.00"}
+	scored := models.NewLifecycle(now).To(models.StateValidated, now).To(models.StateScored, now)
+
+	held, _ := store.SaveRecord(ctx, "tenant-a", receipt, models.Metadata{Lifecycle: scored.To(models.StateHeld, now)})
+	if _, err := store.Refund(ctx, "tenant-a", held, models.Refund{Reviewer: "alice", Reason: "Returned"}); !errors.Is(err, ErrNotCredited) {
+		t.Errorf("Expected a held receipt not to be refunded, got %v", err)
+	}
+	legacy, _ := store.SaveReceipt(ctx, "tenant-a", receipt)
+	if _, err := store.Refund(ctx, "tenant-a", legacy, models.Refund{Reviewer: "alice", Reason: "Returned"}); !errors.Is(err, ErrNotCredited) {
+		t.Errorf("Expected a receipt without a lifecycle not to be refunded, got %v", err)
+	}
+
+	credited, _ := store.SaveRecord(ctx, "tenant-a", receipt, models.Metadata{Lifecycle: scored.To(models.StateCredited, now)})
+	now = now.Add(time.Hour)
+	record, err := store.Refund(ctx, "tenant-a", credited, models.Refund{Reviewer: "alice", Reason: "Returned"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &models.Refund{Reviewer: "alice", Reason: "Returned", At: now}
+	if record.State() != models.StateRefunded || !reflect.DeepEqual(record.Metadata.Refund, expected) {
+		t.Errorf("Expected a refund recorded at %s, got %s %+v", now, record.State(), record.Metadata.Refund)
+	}
+	if _, err := store.Refund(ctx, "tenant-a", credited, models.Refund{Reviewer: "alice", Reason: "Again"}); !errors.Is(err, ErrNotCredited) {
+		t.Errorf("Expected a refunded receipt not to be refunded again, got %v", err)
+	}
+}
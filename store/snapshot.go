@@ -0,0 +1,110 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/receipt-processor/models"
+)
+
+type snapshot struct {
+	Receipts map[string]map[string]models.Receipt  `json:"receipts"`
+	Metadata map[string]map[string]models.Metadata `json:"metadata,omitempty"`
+}
+
+// Open returns a store backed by a snapshot file at path. The store is not
+// ready until Recover has loaded the snapshot.
+func Open(path string) *Store {
+	s := NewStore()
+	s.path = path
+	s.ready.Store(false)
+	return s
+}
+
+func (s *Store) Ready() bool {
+	return s.ready.Load()
+}
+
+// Recover loads the snapshot file, if one exists, and marks the store ready.
+// Receipts saved before recovery finishes are kept.
+func (s *Store) Recover() error {
+	if s.path == "" {
+		s.ready.Store(true)
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.ready.Store(true)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for tenantID, receipts := range snap.Receipts {
+		if s.receipts[tenantID] == nil {
+			s.receipts[tenantID] = make(map[string]models.Receipt, len(receipts))
+		}
+		for id, receipt := range receipts {
+			if _, exists := s.receipts[tenantID][id]; !exists {
+				s.receipts[tenantID][id] = receipt
+				s.bytes += len(id) + receiptSize(receipt)
+				if metadata, ok := snap.Metadata[tenantID][id]; ok {
+					if s.metadata[tenantID] == nil {
+						s.metadata[tenantID] = make(map[string]models.Metadata)
+					}
+					s.metadata[tenantID][id] = metadata
+					s.bytes += metadataSize(metadata)
+				}
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	s.ready.Store(true)
+	return nil
+}
+
+// Flush writes every stored receipt to the snapshot file. The file is
+// replaced atomically so a crash mid-write leaves the previous snapshot.
+func (s *Store) Flush() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	data, err := json.Marshal(snapshot{Receipts: s.receipts, Metadata: s.metadata})
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
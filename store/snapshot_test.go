@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/receipt-processor/models"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.json")
+	receipt := models.Receipt{
+		Retailer:     "TestStore",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []models.Item{{ShortDescription: "Test Item", Price: "10.00"}},
+		Total:        "10.00",
+	}
+
+	original := Open(path)
+	if original.Ready() {
+		t.Fatal("Expected store not to be ready before recovery")
+	}
+	if err := original.Recover(); err != nil {
+		t.Fatalf("Unexpected error recovering without a snapshot: %v", err)
+	}
+	if !original.Ready() {
+		t.Fatal("Expected store to be ready after recovery")
+	}
+
+	id, _ := original.SaveReceipt(context.Background(), "tenant-a", receipt)
+	reconciliation := &models.Reconciliation{Expected: "9.00", Difference: "1.00", Outcome: "flagged"}
+	flaggedID, _ := original.SaveRecord(context.Background(), "tenant-a", receipt, models.Metadata{Reconciliation: reconciliation})
+	if err := original.Flush(); err != nil {
+		t.Fatalf("Unexpected error flushing: %v", err)
+	}
+
+	recovered := Open(path)
+	if err := recovered.Recover(); err != nil {
+		t.Fatalf("Unexpected error recovering: %v", err)
+	}
+
+	saved, err := recovered.GetReceipt(context.Background(), "tenant-a", id)
+	if err != nil {
+		t.Fatalf("Expected receipt to survive a restart: %v", err)
+	}
+	if saved.Retailer != receipt.Retailer || len(saved.Items) != 1 {
+		t.Errorf("Unexpected recovered receipt: %+v", saved)
+	}
+	record, err := recovered.GetRecord(context.Background(), "tenant-a", flaggedID)
+	if err != nil {
+		t.Fatalf("Expected flagged receipt to survive a restart: %v", err)
+	}
+	if record.Metadata.Reconciliation == nil || *record.Metadata.Reconciliation != *reconciliation {
+		t.Errorf("Expected metadata %+v, got %+v", reconciliation, record.Metadata.Reconciliation)
+	}
+	if recovered.Stats() != original.Stats() {
+		t.Errorf("Expected stats %+v, got %+v", original.Stats(), recovered.Stats())
+	}
+}
+
+func TestRecoverCorruptSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipts.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Open(path)
+	if err := s.Recover(); err == nil {
+		t.Error("Expected error recovering a corrupt snapshot")
+	}
+	if s.Ready() {
+		t.Error("Expected store to stay unready after a failed recovery")
+	}
+}
+
+func TestFlushWithoutPath(t *testing.T) {
+	s := NewStore()
+	if !s.Ready() {
+		t.Error("Expected in-memory store to be ready")
+	}
+	if err := s.Flush(); err != nil {
+		t.Errorf("Expected flush without a path to be a no-op, got %v", err)
+	}
+}
@@ -1,41 +1,434 @@
 package store
 
 import (
+	"context"
 	"errors"
+	"log/slog"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"github.com/google/uuid"
 	"github.com/receipt-processor/models"
+	"github.com/receipt-processor/processor"
+	"github.com/receipt-processor/retailer"
+	"github.com/receipt-processor/timezone"
 )
 
-var ErrReceiptNotFound = errors.New("receipt not found")
+var (
+	ErrReceiptNotFound = errors.New("receipt not found")
+	ErrQuotaExceeded   = errors.New("tenant receipt quota exceeded")
+	ErrDailyQuota      = errors.New("tenant daily submission quota exceeded")
+)
+
+type dailyCount struct {
+	day   string
+	count int
+}
 
 type Store struct {
-	receipts map[string]models.Receipt
-	mu       sync.RWMutex
+	receipts    map[string]map[string]models.Receipt
+	metadata    map[string]map[string]models.Metadata
+	quotas      map[string]int
+	dailyQuotas map[string]int
+	dailyCounts map[string]dailyCount
+	bytes       int
+	path        string
+	ready       atomic.Bool
+	now         func() time.Time
+	mu          sync.RWMutex
+}
+
+// Record is a stored receipt together with its ID and metadata.
+type Record struct {
+	ID       string
+	Receipt  models.Receipt
+	Metadata models.Metadata
+}
+
+// PurchasedAt returns the purchase instant recorded with the receipt, or
+// derives it for receipts stored before instants were recorded. Receipts
+// whose date cannot be read yield the zero time.
+func (r Record) PurchasedAt() time.Time {
+	if r.Metadata.PurchasedAt != nil {
+		return *r.Metadata.PurchasedAt
+	}
+	instant, _ := timezone.Instant(r.Receipt.PurchaseDate, r.Receipt.PurchaseTime, r.Receipt.TimeZone)
+	return instant
+}
+
+// State returns the receipt's lifecycle state. For receipts stored before
+// lifecycles were recorded it is derived from their review, or their fraud
+// assessment before that, and is otherwise credited.
+func (r Record) State() string {
+	if l := r.Metadata.Lifecycle; l != nil {
+		return l.State
+	}
+	if review := r.Metadata.Review; review != nil {
+		switch review.Status {
+		case models.ReviewPending:
+			return models.StateHeld
+		case models.ReviewRejected:
+			return models.StateVoided
+		}
+		return models.StateCredited
+	}
+	if r.Metadata.Risk != nil && r.Metadata.Risk.Held {
+		return models.StateHeld
+	}
+	return models.StateCredited
+}
+
+// History returns the receipt's lifecycle transitions, oldest first, or nil
+// for receipts stored before lifecycles were recorded.
+func (r Record) History() []models.Transition {
+	if l := r.Metadata.Lifecycle; l != nil {
+		return l.History
+	}
+	return nil
+}
+
+// Held reports whether the receipt's points are held pending review.
+func (r Record) Held() bool {
+	return r.State() == models.StateHeld
+}
+
+// Points returns the points recorded when the receipt was last scored. For
+// receipts stored before scores were recorded they are calculated with
+// rules.
+func (r Record) Points(rules processor.PointsCalculator) int {
+	if r.Metadata.Score != nil {
+		return r.Metadata.Score.Points
+	}
+	if !r.Metadata.Reconciliation.Scores() {
+		return 0
+	}
+	return rules.CalculatePoints(r.Receipt)
+}
+
+// Breakdown returns how each rule contributed to the points recorded when
+// the receipt was last scored, so it always adds up to Points. For
+// receipts scored before breakdowns were recorded it is calculated with
+// rules.
+func (r Record) Breakdown(rules processor.Rules) ([]processor.RulePoints, error) {
+	if r.Metadata.Score != nil && r.Metadata.Score.Breakdown != nil {
+		return r.Metadata.Score.Breakdown, nil
+	}
+	if !r.Metadata.Reconciliation.Scores() {
+		return []processor.RulePoints{}, nil
+	}
+	return rules.Breakdown(r.Receipt)
+}
+
+// CanonicalRetailer returns the canonical retailer recorded with the
+// receipt. Receipts that matched none when stored are matched against the
+// current registry, so aliases added later apply to them too. It returns
+// nil when the retailer is not in the registry.
+func (r Record) CanonicalRetailer() *models.CanonicalRetailer {
+	if r.Metadata.Retailer != nil {
+		return r.Metadata.Retailer
+	}
+	if canonical, ok := retailer.Default.Match(r.Receipt.Retailer); ok {
+		return canonical.Canonical()
+	}
+	return nil
+}
+
+type Stats struct {
+	Receipts int
+	Bytes    int
 }
 
 func NewStore() *Store {
-	return &Store{
-		receipts: make(map[string]models.Receipt),
+	s := &Store{
+		receipts:    make(map[string]map[string]models.Receipt),
+		metadata:    make(map[string]map[string]models.Metadata),
+		quotas:      make(map[string]int),
+		dailyQuotas: make(map[string]int),
+		dailyCounts: make(map[string]dailyCount),
+		now:         time.Now,
 	}
+	s.ready.Store(true)
+	return s
 }
 
-func (s *Store) SaveReceipt(receipt models.Receipt) string {
-	id := uuid.New().String()
+func (s *Store) SetQuota(tenantID string, maxReceipts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maxReceipts <= 0 {
+		delete(s.quotas, tenantID)
+		return
+	}
+	s.quotas[tenantID] = maxReceipts
+}
+
+func (s *Store) SetDailyQuota(tenantID string, maxSubmissions int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maxSubmissions <= 0 {
+		delete(s.dailyQuotas, tenantID)
+		return
+	}
+	s.dailyQuotas[tenantID] = maxSubmissions
+}
+
+// DailySubmissions reports how many receipts the tenant has saved today (UTC).
+func (s *Store) DailySubmissions(tenantID string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counted := s.dailyCounts[tenantID]
+	if counted.day != s.now().UTC().Format("2006-01-02") {
+		return 0
+	}
+	return counted.count
+}
+
+func (s *Store) SaveReceipt(ctx context.Context, tenantID string, receipt models.Receipt) (string, error) {
+	return s.SaveRecord(ctx, tenantID, receipt, models.Metadata{})
+}
+
+// SaveRecord stores a receipt along with its metadata and returns the new
+// receipt's ID. A lifecycle in the metadata must start received and
+// follow allowed transitions.
+func (s *Store) SaveRecord(ctx context.Context, tenantID string, receipt models.Receipt, metadata models.Metadata) (string, error) {
+	if err := checkLifecycle(nil, metadata.Lifecycle); err != nil {
+		return "", err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.receipts[id] = receipt
-	return id
+
+	receipts, ok := s.receipts[tenantID]
+	if !ok {
+		receipts = make(map[string]models.Receipt)
+		s.receipts[tenantID] = receipts
+	}
+
+	if quota, ok := s.quotas[tenantID]; ok && len(receipts) >= quota {
+		slog.WarnContext(ctx, "receipt quota exceeded", "tenant", tenantID, "quota", quota)
+		return "", ErrQuotaExceeded
+	}
+
+	today := s.now().UTC().Format("2006-01-02")
+	counted := s.dailyCounts[tenantID]
+	if counted.day != today {
+		counted = dailyCount{day: today}
+	}
+	if quota, ok := s.dailyQuotas[tenantID]; ok && counted.count >= quota {
+		slog.WarnContext(ctx, "daily submission quota exceeded", "tenant", tenantID, "quota", quota)
+		return "", ErrDailyQuota
+	}
+	counted.count++
+	s.dailyCounts[tenantID] = counted
+
+	id := uuid.New().String()
+	receipts[id] = receipt
+	s.bytes += len(id) + receiptSize(receipt)
+	if metadata != (models.Metadata{}) {
+		if s.metadata[tenantID] == nil {
+			s.metadata[tenantID] = make(map[string]models.Metadata)
+		}
+		s.metadata[tenantID][id] = metadata
+		s.bytes += metadataSize(metadata)
+	}
+	slog.DebugContext(ctx, "receipt saved", "tenant", tenantID, "receipt_id", id)
+	return id, nil
 }
 
-func (s *Store) GetReceipt(id string) (models.Receipt, error) {
+func (s *Store) GetReceipt(ctx context.Context, tenantID, id string) (models.Receipt, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	receipt, ok := s.receipts[id]
+	receipt, ok := s.receipts[tenantID][id]
 	if !ok {
+		slog.DebugContext(ctx, "receipt not found", "tenant", tenantID, "receipt_id", id)
 		return models.Receipt{}, ErrReceiptNotFound
 	}
 	return receipt, nil
 }
+
+// GetRecord returns a receipt together with its metadata.
+func (s *Store) GetRecord(ctx context.Context, tenantID, id string) (Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	receipt, ok := s.receipts[tenantID][id]
+	if !ok {
+		slog.DebugContext(ctx, "receipt not found", "tenant", tenantID, "receipt_id", id)
+		return Record{}, ErrReceiptNotFound
+	}
+	return Record{ID: id, Receipt: receipt, Metadata: s.metadata[tenantID][id]}, nil
+}
+
+// UpdateMetadata replaces a stored receipt's metadata with what update
+// makes of it, under the store's lock so concurrent updates to a receipt
+// apply one after the other. Records already handed out share the
+// metadata's pointers, so update must replace what they point to rather
+// than modify it. An error from update, or a lifecycle change that is not
+// an allowed transition, leaves the metadata unchanged.
+func (s *Store) UpdateMetadata(ctx context.Context, tenantID, id string, update func(*models.Metadata) error) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receipt, ok := s.receipts[tenantID][id]
+	if !ok {
+		slog.DebugContext(ctx, "receipt not found", "tenant", tenantID, "receipt_id", id)
+		return Record{}, ErrReceiptNotFound
+	}
+	previous := s.metadata[tenantID][id]
+	metadata := previous
+	if err := update(&metadata); err != nil {
+		return Record{}, err
+	}
+	if metadata.Lifecycle != previous.Lifecycle {
+		if err := checkLifecycle(previous.Lifecycle, metadata.Lifecycle); err != nil {
+			return Record{}, err
+		}
+	}
+
+	if s.metadata[tenantID] == nil {
+		s.metadata[tenantID] = make(map[string]models.Metadata)
+	}
+	s.metadata[tenantID][id] = metadata
+	s.bytes += metadataSize(metadata) - metadataSize(previous)
+	return Record{ID: id, Receipt: receipt, Metadata: metadata}, nil
+}
+
+// List returns the tenant's receipts, newest purchase instant first, so
+// receipts from different time zones interleave correctly. Receipts
+// purchased at the same instant are ordered by ID so pages are stable.
+func (s *Store) List(ctx context.Context, tenantID string) []Record {
+	s.mu.RLock()
+	records := make([]Record, 0, len(s.receipts[tenantID]))
+	for id, receipt := range s.receipts[tenantID] {
+		records = append(records, Record{ID: id, Receipt: receipt, Metadata: s.metadata[tenantID][id]})
+	}
+	s.mu.RUnlock()
+
+	instants := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		instants[record.ID] = record.PurchasedAt()
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := instants[records[i].ID], instants[records[j].ID]
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return records[i].ID < records[j].ID
+	})
+	slog.DebugContext(ctx, "receipts listed", "tenant", tenantID, "count", len(records))
+	return records
+}
+
+// Page returns up to limit of the tenant's receipts with IDs after the
+// given one, in ID order. Passing the last ID of one page fetches the next,
+// so receipts stored while paging are neither repeated nor skipped before
+// the cursor.
+func (s *Store) Page(ctx context.Context, tenantID, after string, limit int) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.receipts[tenantID]))
+	for id := range s.receipts[tenantID] {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	records := make([]Record, len(ids))
+	for i, id := range ids {
+		records[i] = Record{ID: id, Receipt: s.receipts[tenantID][id], Metadata: s.metadata[tenantID][id]}
+	}
+	return records
+}
+
+// Tenants returns the IDs of the tenants with stored receipts, sorted.
+func (s *Store) Tenants() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.receipts))
+	for id, receipts := range s.receipts {
+		if len(receipts) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Store) Count(tenantID string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.receipts[tenantID])
+}
+
+// Stats reports the number of stored receipts across all tenants and an
+// estimate of the memory they occupy.
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := Stats{Bytes: s.bytes}
+	for _, receipts := range s.receipts {
+		stats.Receipts += len(receipts)
+	}
+	return stats
+}
+
+func receiptSize(receipt models.Receipt) int {
+	size := int(unsafe.Sizeof(receipt)) + len(receipt.Retailer) + len(receipt.PurchaseDate) +
+		len(receipt.PurchaseTime) + len(receipt.Total) + len(receipt.Subtotal) + len(receipt.Tax) + len(receipt.Tip) + len(receipt.Currency) +
+		len(receipt.TimeZone)
+	for _, item := range receipt.Items {
+		size += int(unsafe.Sizeof(item)) + len(item.ShortDescription) + len(item.Price) + len(item.Quantity) +
+			len(item.UnitPrice) + len(item.SKU) + len(item.UPC)
+	}
+	for _, discount := range receipt.Discounts {
+		size += int(unsafe.Sizeof(discount)) + len(discount.Description) + len(discount.Amount)
+	}
+	return size
+}
+
+func metadataSize(metadata models.Metadata) int {
+	size := 0
+	if r := metadata.Reconciliation; r != nil {
+		size += int(unsafe.Sizeof(*r)) + len(r.Expected) + len(r.Difference) + len(r.Outcome)
+	}
+	if metadata.PurchasedAt != nil {
+		size += int(unsafe.Sizeof(*metadata.PurchasedAt))
+	}
+	if r := metadata.Retailer; r != nil {
+		size += int(unsafe.Sizeof(*r)) + len(r.ID) + len(r.Name) + len(r.Category) + len(r.Chain)
+	}
+	if r := metadata.Risk; r != nil {
+		size += int(unsafe.Sizeof(*r))
+		for _, reason := range r.Reasons {
+			size += len(reason)
+		}
+	}
+	if l := metadata.Lifecycle; l != nil {
+		size += int(unsafe.Sizeof(*l)) + len(l.State)
+		for _, t := range l.History {
+			size += int(unsafe.Sizeof(t)) + len(t.State)
+		}
+	}
+	if r := metadata.Rejection; r != nil {
+		size += int(unsafe.Sizeof(*r)) + len(r.Code) + len(r.Message)
+	}
+	if s := metadata.Score; s != nil {
+		size += int(unsafe.Sizeof(*s)) + len(s.Version)
+	}
+	if r := metadata.Review; r != nil {
+		size += int(unsafe.Sizeof(*r)) + len(r.Status) + len(r.Reviewer)
+		for _, reason := range r.Reasons {
+			size += len(reason)
+		}
+		for _, entry := range r.Audit {
+			size += int(unsafe.Sizeof(entry)) + len(entry.Action) + len(entry.Reviewer) + len(entry.Reason)
+		}
+	}
+	return size
+}
@@ -1,9 +1,11 @@
 package store
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/receipt-processor/models"
 )
@@ -22,12 +24,15 @@ func TestStoreOperations(t *testing.T) {
 	}
 
 	t.Run("SaveReceipt", func(t *testing.T) {
-		id := store.SaveReceipt(receipt)
+		id, err := store.SaveReceipt(context.Background(), "tenant-a", receipt)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
 		if id == "" {
 			t.Errorf("Expected non-empty ID, got empty string")
 		}
 
-		savedReceipt, err := store.GetReceipt(id)
+		savedReceipt, err := store.GetReceipt(context.Background(), "tenant-a", id)
 		if err != nil {
 			t.Errorf("Unexpected error: %v", err)
 		}
@@ -46,7 +51,7 @@ func TestStoreOperations(t *testing.T) {
 	})
 
 	t.Run("GetNonExistentReceipt", func(t *testing.T) {
-		_, err := store.GetReceipt("non-existent-id")
+		_, err := store.GetReceipt(context.Background(), "tenant-a", "non-existent-id")
 		if err == nil {
 			t.Errorf("Expected error, got nil")
 		}
@@ -62,13 +67,13 @@ func TestStoreOperations(t *testing.T) {
 		for i := 0; i < numGoroutines; i++ {
 			go func() {
 				defer wg.Done()
-				id := store.SaveReceipt(receipt)
-				if id == "" {
-					errorCh <- fmt.Errorf("got empty ID during concurrent operation")
+				id, err := store.SaveReceipt(context.Background(), "tenant-a", receipt)
+				if err != nil || id == "" {
+					errorCh <- fmt.Errorf("unable to save receipt during concurrent operation: %v", err)
 					return
 				}
 
-				_, err := store.GetReceipt(id)
+				_, err = store.GetReceipt(context.Background(), "tenant-a", id)
 				if err != nil {
 					errorCh <- fmt.Errorf("unable to retrieve receipt during concurrent operation: %v", err)
 					return
@@ -101,7 +106,10 @@ func TestStoreIDUniqueness(t *testing.T) {
 	ids := make(map[string]bool)
 
 	for range idCount {
-		id := store.SaveReceipt(receipt)
+		id, err := store.SaveReceipt(context.Background(), "tenant-a", receipt)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
 		if id == "" {
 			t.Errorf("Expected non-empty ID, got empty string")
 		}
@@ -113,3 +121,169 @@ func TestStoreIDUniqueness(t *testing.T) {
 		ids[id] = true
 	}
 }
+
+func TestStoreTenantIsolation(t *testing.T) {
+	store := NewStore()
+	receipt := models.Receipt{
+		Retailer:     "TestStore",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []models.Item{
+			{ShortDescription: "Test Item", Price: "10.00"},
+		},
+		Total: "10.00",
+	}
+
+	id, err := store.SaveReceipt(context.Background(), "tenant-a", receipt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := store.GetReceipt(context.Background(), "tenant-b", id); err != ErrReceiptNotFound {
+		t.Errorf("Expected %v for another tenant's receipt, got %v", ErrReceiptNotFound, err)
+	}
+
+	if store.Count("tenant-a") != 1 || store.Count("tenant-b") != 0 {
+		t.Errorf("Expected counts 1 and 0, got %d and %d", store.Count("tenant-a"), store.Count("tenant-b"))
+	}
+}
+
+func TestStoreQuota(t *testing.T) {
+	store := NewStore()
+	store.SetQuota("tenant-a", 2)
+	receipt := models.Receipt{Retailer: "TestStore", Total: "10.00"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := store.SaveReceipt(context.Background(), "tenant-a", receipt); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if _, err := store.SaveReceipt(context.Background(), "tenant-a", receipt); err != ErrQuotaExceeded {
+		t.Errorf("Expected %v, got %v", ErrQuotaExceeded, err)
+	}
+
+	if _, err := store.SaveReceipt(context.Background(), "tenant-b", receipt); err != nil {
+		t.Errorf("Expected other tenant to be unaffected, got %v", err)
+	}
+}
+
+func TestStoreDailyQuota(t *testing.T) {
+	store := NewStore()
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	store.SetDailyQuota("tenant-a", 1)
+	receipt := models.Receipt{Retailer: "TestStore", Total: "10.00"}
+
+	if _, err := store.SaveReceipt(context.Background(), "tenant-a", receipt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.SaveReceipt(context.Background(), "tenant-a", receipt); err != ErrDailyQuota {
+		t.Errorf("Expected %v, got %v", ErrDailyQuota, err)
+	}
+	if got := store.DailySubmissions("tenant-a"); got != 1 {
+		t.Errorf("Expected 1 submission today, got %d", got)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if got := store.DailySubmissions("tenant-a"); got != 0 {
+		t.Errorf("Expected 0 submissions on a new day, got %d", got)
+	}
+	if _, err := store.SaveReceipt(context.Background(), "tenant-a", receipt); err != nil {
+		t.Errorf("Expected quota to reset on a new day, got %v", err)
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+
+	older, _ := store.SaveReceipt(ctx, "tenant-a", models.Receipt{Retailer: "Old", PurchaseDate: "2022-01-01", PurchaseTime: "09:00"})
+	newer, _ := store.SaveReceipt(ctx, "tenant-a", models.Receipt{Retailer: "New", PurchaseDate: "2022-01-02", PurchaseTime: "08:00"})
+	later, _ := store.SaveReceipt(ctx, "tenant-a", models.Receipt{Retailer: "Later", PurchaseDate: "2022-01-02", PurchaseTime: "18:00"})
+	// Dated later than the others, but 17:00 UTC on 2022-01-02.
+	tokyo, _ := store.SaveReceipt(ctx, "tenant-a", models.Receipt{Retailer: "Tokyo", PurchaseDate: "2022-01-03", PurchaseTime: "02:00", TimeZone: "Asia/Tokyo"})
+	store.SaveReceipt(ctx, "tenant-b", models.Receipt{Retailer: "Other", PurchaseDate: "2022-01-03", PurchaseTime: "08:00"})
+
+	records := store.List(ctx, "tenant-a")
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 receipts for tenant-a, got %d", len(records))
+	}
+	for i, id := range []string{later, tokyo, newer, older} {
+		if records[i].ID != id {
+			t.Errorf("Expected %s at position %d, got %s (%s)", id, i, records[i].ID, records[i].Receipt.Retailer)
+		}
+	}
+
+	if records := store.List(ctx, "tenant-c"); len(records) != 0 {
+		t.Errorf("Expected no receipts for an unknown tenant, got %d", len(records))
+	}
+}
+
+func TestStoreStats(t *testing.T) {
+	store := NewStore()
+	receipt := models.Receipt{
+		Retailer: "TestStore",
+		Items:    []models.Item{{ShortDescription: "Test Item", Price: "10.00"}},
+		Total:    "10.00",
+	}
+
+	if stats := store.Stats(); stats.Receipts != 0 || stats.Bytes != 0 {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+
+	store.SaveReceipt(context.Background(), "tenant-a", receipt)
+	store.SaveReceipt(context.Background(), "tenant-b", receipt)
+
+	stats := store.Stats()
+	if stats.Receipts != 2 {
+		t.Errorf("Expected 2 receipts, got %d", stats.Receipts)
+	}
+	if stats.Bytes < 2*receiptSize(receipt) {
+		t.Errorf("Expected at least %d bytes, got %d", 2*receiptSize(receipt), stats.Bytes)
+	}
+}
+
+func TestStoreUpdateMetadata(t *testing.T) {
+	store := NewStore()
+	ctx := context.Background()
+	review := &models.Review{Status: models.ReviewPending, Reasons: []string{"fraud_risk"}}
+	id, _ := store.SaveRecord(ctx, "tenant-a", models.Receipt{Retailer: "TestStore", Total: "1.00"}, models.Metadata{Review: review})
+	before := store.Stats().Bytes
+
+	record, err := store.UpdateMetadata(ctx, "tenant-a", id, func(m *models.Metadata) error {
+		m.Review = m.Review.With(models.ReviewEntry{Action: models.ReviewActionClaimed, Reviewer: "alice"})
+		m.Review.Reviewer = "alice"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Metadata.Review.Reviewer != "alice" || len(record.Metadata.Review.Audit) != 1 {
+		t.Errorf("Expected the updated review, got %+v", record.Metadata.Review)
+	}
+	if review.Reviewer != "" || len(review.Audit) != 0 {
+		t.Errorf("Expected the original review to be untouched, got %+v", review)
+	}
+	if stored, _ := store.GetRecord(ctx, "tenant-a", id); stored.Metadata.Review.Reviewer != "alice" {
+		t.Errorf("Expected the update to be stored, got %+v", stored.Metadata.Review)
+	}
+	if after := store.Stats().Bytes; after <= before {
+		t.Errorf("Expected the estimate to grow from %d bytes, got %d", before, after)
+	}
+
+	failed := fmt.Errorf("not allowed")
+	if _, err := store.UpdateMetadata(ctx, "tenant-a", id, func(m *models.Metadata) error {
+		m.Review = nil
+		return failed
+	}); err != failed {
+		t.Errorf("Expected the update's error, got %v", err)
+	}
+	if stored, _ := store.GetRecord(ctx, "tenant-a", id); stored.Metadata.Review == nil {
+		t.Error("Expected a failed update to leave the metadata unchanged")
+	}
+
+	if _, err := store.UpdateMetadata(ctx, "tenant-b", id, func(*models.Metadata) error { return nil }); err != ErrReceiptNotFound {
+		t.Errorf("Expected ErrReceiptNotFound for another tenant, got %v", err)
+	}
+}
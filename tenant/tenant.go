@@ -0,0 +1,204 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/receipt-processor/processor"
+)
+
+const (
+	Default      = "default"
+	Header       = "X-Tenant-ID"
+	APIKeyHeader = "X-API-Key"
+)
+
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+type contextKey struct{}
+
+type Tenant struct {
+	ID             string           `json:"id"`
+	APIKeys        []string         `json:"apiKeys"`
+	ClientSubjects []string         `json:"clientSubjects,omitempty"`
+	Rules          *processor.Rules `json:"rules,omitempty"`
+	MaxReceipts    int              `json:"maxReceipts,omitempty"`
+	DailyQuota     int              `json:"dailyQuota,omitempty"`
+}
+
+type Registry struct {
+	tenants      map[string]Tenant
+	apiKeys      map[string]string
+	subjects     map[string]string
+	defaultRules processor.Rules
+	mu           sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		tenants:      make(map[string]Tenant),
+		apiKeys:      make(map[string]string),
+		subjects:     make(map[string]string),
+		defaultRules: processor.DefaultRules,
+	}
+}
+
+func LoadFile(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, err
+	}
+
+	registry := NewRegistry()
+	for _, t := range tenants {
+		if t.Rules != nil {
+			if err := t.Rules.Validate(); err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", t.ID, err)
+			}
+		}
+		registry.Add(t)
+	}
+	return registry, nil
+}
+
+func (reg *Registry) Add(t Tenant) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.tenants[t.ID] = t
+	for _, key := range t.APIKeys {
+		reg.apiKeys[key] = t.ID
+	}
+	for _, subject := range t.ClientSubjects {
+		reg.subjects[subject] = t.ID
+	}
+}
+
+// SetDefaultRules replaces the rules used for tenants without their own.
+func (reg *Registry) SetDefaultRules(rules processor.Rules) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.defaultRules = rules
+}
+
+func (reg *Registry) Get(id string) (Tenant, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	t, ok := reg.tenants[id]
+	return t, ok
+}
+
+func (reg *Registry) All() []Tenant {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	tenants := make([]Tenant, 0, len(reg.tenants))
+	for _, t := range reg.tenants {
+		tenants = append(tenants, t)
+	}
+	return tenants
+}
+
+// Calculator returns the points rules for a tenant, falling back to the
+// registry's default rules when the tenant has none configured.
+func (reg *Registry) Calculator(id string) processor.PointsCalculator {
+	return reg.Rules(id)
+}
+
+// Rules is Calculator for callers that need more than the total, such as a
+// per-rule breakdown.
+func (reg *Registry) Rules(id string) processor.Rules {
+	if reg == nil {
+		return processor.DefaultRules
+	}
+	if t, ok := reg.Get(id); ok && t.Rules != nil {
+		return *t.Rules
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.defaultRules
+}
+
+// Resolve determines the tenant for a request. A verified client
+// certificate mapped to a tenant takes precedence, then an API key, then the
+// tenant header; requests carrying none belong to the default tenant. The
+// header alone only selects tenants without API keys or client subjects,
+// so it cannot stand in for their credentials.
+func (reg *Registry) Resolve(r *http.Request) (string, error) {
+	return reg.ResolveCredentials(ClientSubject(r), r.Header.Get(APIKeyHeader), r.Header.Get(Header))
+}
+
+// ResolveCredentials applies the same precedence as Resolve to credentials
+// that did not arrive on an HTTP request, such as gRPC metadata.
+func (reg *Registry) ResolveCredentials(subject, apiKey, tenantID string) (string, error) {
+	if subject != "" {
+		reg.mu.RLock()
+		id, ok := reg.subjects[subject]
+		reg.mu.RUnlock()
+		if ok {
+			return id, nil
+		}
+	}
+
+	if apiKey != "" {
+		reg.mu.RLock()
+		id, ok := reg.apiKeys[apiKey]
+		reg.mu.RUnlock()
+		if !ok {
+			return "", ErrUnknownTenant
+		}
+		return id, nil
+	}
+
+	if tenantID != "" {
+		t, ok := reg.Get(tenantID)
+		if !ok || len(t.APIKeys) > 0 || len(t.ClientSubjects) > 0 {
+			return "", ErrUnknownTenant
+		}
+		return tenantID, nil
+	}
+
+	return Default, nil
+}
+
+// ClientSubject returns the subject of the verified client certificate, or
+// an empty string when the connection has none. Subjects are matched by
+// common name.
+func ClientSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
+
+func Middleware(reg *Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := reg.Resolve(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unknown tenant or API key."})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
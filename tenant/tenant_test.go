@@ -0,0 +1,191 @@
+package tenant
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/receipt-processor/processor"
+)
+
+func TestRegistryResolve(t *testing.T) {
+	registry := NewRegistry()
+	registry.Add(Tenant{ID: "acme", APIKeys: []string{"acme-key"}})
+	registry.Add(Tenant{ID: "globex"})
+
+	testCases := []struct {
+		name     string
+		headers  map[string]string
+		expected string
+		wantErr  bool
+	}{
+		{"no headers", nil, Default, false},
+		{"api key", map[string]string{APIKeyHeader: "acme-key"}, "acme", false},
+		{"tenant header", map[string]string{Header: "globex"}, "globex", false},
+		{"api key wins over header", map[string]string{APIKeyHeader: "acme-key", Header: "globex"}, "acme", false},
+		{"unknown api key", map[string]string{APIKeyHeader: "nope"}, "", true},
+		{"unknown tenant header", map[string]string{Header: "nope"}, "", true},
+		{"header without credentials", map[string]string{Header: "acme"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			id, err := registry.Resolve(req)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if id != tc.expected {
+				t.Errorf("expected tenant %q, got %q", tc.expected, id)
+			}
+		})
+	}
+}
+
+func TestRegistryResolveClientCertificate(t *testing.T) {
+	registry := NewRegistry()
+	registry.Add(Tenant{ID: "acme", ClientSubjects: []string{"pos.acme.example"}})
+	registry.Add(Tenant{ID: "globex", APIKeys: []string{"globex-key"}})
+
+	withCert := func(commonName string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	t.Run("mapped subject", func(t *testing.T) {
+		req := withCert("pos.acme.example")
+		req.Header.Set(APIKeyHeader, "globex-key")
+		if id, err := registry.Resolve(req); err != nil || id != "acme" {
+			t.Errorf("expected certificate to resolve to acme, got %q, %v", id, err)
+		}
+	})
+
+	t.Run("unmapped subject falls back to API key", func(t *testing.T) {
+		req := withCert("unknown.example")
+		req.Header.Set(APIKeyHeader, "globex-key")
+		if id, err := registry.Resolve(req); err != nil || id != "globex" {
+			t.Errorf("expected fallback to globex, got %q, %v", id, err)
+		}
+	})
+
+	t.Run("unverified certificate is ignored", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+			{Subject: pkix.Name{CommonName: "pos.acme.example"}},
+		}}
+		if id, _ := registry.Resolve(req); id != Default {
+			t.Errorf("expected default tenant, got %q", id)
+		}
+	})
+}
+
+func TestRegistryCalculator(t *testing.T) {
+	rules := processor.DefaultRules
+	rules.OddDayPoints = 60
+	registry := NewRegistry()
+	registry.Add(Tenant{ID: "acme", Rules: &rules})
+
+	if got := registry.Calculator("acme"); !reflect.DeepEqual(got, rules) {
+		t.Errorf("expected tenant rules, got %+v", got)
+	}
+	if got := registry.Calculator("other"); !reflect.DeepEqual(got, processor.DefaultRules) {
+		t.Errorf("expected default rules, got %+v", got)
+	}
+
+	defaults := processor.DefaultRules
+	defaults.ItemPairPoints = 50
+	registry.SetDefaultRules(defaults)
+	if got := registry.Calculator("other"); !reflect.DeepEqual(got, defaults) {
+		t.Errorf("expected configured default rules, got %+v", got)
+	}
+	if got := registry.Calculator("acme"); !reflect.DeepEqual(got, rules) {
+		t.Errorf("expected tenant rules to win over defaults, got %+v", got)
+	}
+
+	var nilRegistry *Registry
+	if got := nilRegistry.Calculator("acme"); !reflect.DeepEqual(got, processor.DefaultRules) {
+		t.Errorf("expected default rules from nil registry, got %+v", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	registry := NewRegistry()
+	registry.Add(Tenant{ID: "acme", APIKeys: []string{"acme-key"}})
+
+	var seen string
+	handler := Middleware(registry, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	t.Run("resolved tenant in context", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(APIKeyHeader, "acme-key")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if seen != "acme" {
+			t.Errorf("expected tenant %q, got %q", "acme", seen)
+		}
+	})
+
+	t.Run("unknown credential", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(APIKeyHeader, "bad-key")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestFromContextDefault(t *testing.T) {
+	if got := FromContext(context.Background()); got != Default {
+		t.Errorf("expected %q, got %q", Default, got)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	data := `[{"id": "acme", "apiKeys": ["k1"], "maxReceipts": 5, "rules": {"retailerCharPoints": 2}}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acme, ok := registry.Get("acme")
+	if !ok {
+		t.Fatal("expected tenant acme to be loaded")
+	}
+	if acme.MaxReceipts != 5 || acme.Rules == nil || acme.Rules.RetailerCharPoints != 2 ||
+		acme.Rules.RoundDollarPoints != processor.DefaultRules.RoundDollarPoints {
+		t.Errorf("unexpected tenant: %+v", acme)
+	}
+	data = `[{"id": "acme", "rules": {"afternoonStart": "16:00", "afternoonEnd": "14:00"}}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("expected an inverted afternoon window to be rejected")
+	}
+}
@@ -0,0 +1,73 @@
+// Package timezone turns a receipt's local purchase date and time into an
+// instant, given the IANA time zone or UTC offset the receipt was printed
+// in.
+package timezone
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	// Embed the zone database so names resolve on hosts without one.
+	_ "time/tzdata"
+)
+
+var (
+	ErrUnknownZone     = errors.New("unknown time zone")
+	ErrNonexistentTime = errors.New("local time does not exist in its time zone")
+)
+
+var offsetPattern = regexp.MustCompile(`^([+-])(\d{2}):(\d{2})$`)
+
+// Load resolves an IANA name such as "America/Chicago" or a UTC offset such
+// as "+05:30". An empty zone is UTC, which is how receipts were read before
+// they carried one.
+func Load(zone string) (*time.Location, error) {
+	if zone == "" {
+		return time.UTC, nil
+	}
+	if m := offsetPattern.FindStringSubmatch(zone); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		if hours > 14 || minutes > 59 || hours == 14 && minutes > 0 {
+			return nil, fmt.Errorf("%w %q", ErrUnknownZone, zone)
+		}
+		offset := hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(zone, offset), nil
+	}
+	// "Local" would make receipts depend on the server's own zone.
+	if zone == "Local" {
+		return nil, fmt.Errorf("%w %q", ErrUnknownZone, zone)
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownZone, zone)
+	}
+	return loc, nil
+}
+
+// Instant returns the UTC instant of a purchase date (YYYY-MM-DD) and time
+// (HH:MM) read in zone. A wall-clock time skipped by a daylight saving
+// change is an error; one that occurs twice is taken at its first
+// occurrence.
+func Instant(date, clock, zone string) (time.Time, error) {
+	loc, err := Load(zone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	const layout = "2006-01-02 15:04"
+	local := date + " " + clock
+	t, err := time.ParseInLocation(layout, local, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.Format(layout) != local {
+		return time.Time{}, fmt.Errorf("%w: %s in %s", ErrNonexistentTime, local, zone)
+	}
+	return t.UTC(), nil
+}
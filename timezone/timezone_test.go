@@ -0,0 +1,52 @@
+package timezone
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	for _, zone := range []string{"", "UTC", "America/Chicago", "Asia/Kolkata", "+05:30", "-08:00", "+14:00", "-00:00"} {
+		if _, err := Load(zone); err != nil {
+			t.Errorf("Load(%q): %v", zone, err)
+		}
+	}
+	for _, zone := range []string{"Local", "Mars/Olympus", "+5:30", "+0530", "+15:00", "+14:30", "-08:60", "CST6"} {
+		if _, err := Load(zone); !errors.Is(err, ErrUnknownZone) {
+			t.Errorf("Load(%q): expected unknown zone, got %v", zone, err)
+		}
+	}
+}
+
+func TestInstant(t *testing.T) {
+	testCases := []struct {
+		name     string
+		date     string
+		clock    string
+		zone     string
+		expected string
+		err      error
+	}{
+		{"no zone is UTC", "2022-01-01", "13:01", "", "2022-01-01T13:01:00Z", nil},
+		{"offset", "2022-01-01", "13:01", "+05:30", "2022-01-01T07:31:00Z", nil},
+		{"crosses midnight", "2022-01-01", "20:00", "-08:00", "2022-01-02T04:00:00Z", nil},
+		{"standard time", "2022-01-01", "14:30", "America/Chicago", "2022-01-01T20:30:00Z", nil},
+		{"daylight time", "2022-07-01", "14:30", "America/Chicago", "2022-07-01T19:30:00Z", nil},
+		{"repeated hour takes the first", "2022-11-06", "01:30", "America/Chicago", "2022-11-06T06:30:00Z", nil},
+		{"skipped hour", "2022-03-13", "02:30", "America/Chicago", "", ErrNonexistentTime},
+		{"unknown zone", "2022-01-01", "13:01", "Nowhere/Special", "", ErrUnknownZone},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			instant, err := Instant(tc.date, tc.clock, tc.zone)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err == nil && instant.Format(time.RFC3339) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, instant.Format(time.RFC3339))
+			}
+		})
+	}
+}
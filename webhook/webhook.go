@@ -0,0 +1,436 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	EventReceiptProcessed = "receipt.processed"
+	EventReceiptHeld      = "receipt.held"
+	EventReceiptVoided    = "receipt.voided"
+	EventReceiptRefunded  = "receipt.refunded"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrDeliveryNotFound     = errors.New("dead-lettered delivery not found")
+	ErrInvalidURL           = errors.New("webhook URL must be an absolute http or https URL")
+	ErrForbiddenDestination = errors.New("webhook destination is not a public address")
+	ErrTooManySubscriptions = errors.New("tenant webhook subscription limit reached")
+)
+
+// forbiddenPrefixes are the non-public ranges not covered by the netip
+// predicates used in Public: this network, shared carrier-grade NAT (home
+// to some cloud metadata services), IETF protocol assignments, the
+// documentation and benchmarking ranges, and NAT64.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// Public reports whether webhooks may be delivered to addr. Loopback,
+// private (RFC 1918 and unique local), link-local (including the cloud
+// metadata address 169.254.169.254), multicast and other reserved
+// addresses are refused.
+func Public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL validates a subscription URL: it must be absolute http or
+// https, and must not name localhost or a non-public IP address. Host
+// names are resolved when delivering, where NewClient refuses non-public
+// addresses, so a name cannot later be pointed inside the network.
+func CheckURL(raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenDestination
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !Public(addr) {
+		return ErrForbiddenDestination
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client for deliveries that only connects to
+// public addresses. The check runs on the resolved address of every
+// connection, redirects included, and proxies from the environment are
+// not used since they would hide the destination.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !Public(addrPort.Addr()) {
+				return fmt.Errorf("dialing %s: %w", address, ErrForbiddenDestination)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+type Subscription struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Tenant    string    `json:"tenant"`
+	ReceiptID string    `json:"receiptId"`
+	Points    int       `json:"points"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Delivery struct {
+	ID           string       `json:"id"`
+	Subscription Subscription `json:"subscription"`
+	Event        Event        `json:"event"`
+	Attempts     int          `json:"attempts"`
+	LastError    string       `json:"lastError,omitempty"`
+	FailedAt     time.Time    `json:"failedAt,omitempty"`
+}
+
+// Sign computes the signature sent in SignatureHeader: an HMAC-SHA256 over
+// the timestamp and body, so receivers can reject replayed payloads.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Dispatcher delivers events to subscriptions. Each tenant may hold up to
+// MaxSubscriptions subscriptions and keeps its MaxDeadLetters most recent
+// dead-lettered deliveries; zero means no limit.
+type Dispatcher struct {
+	MaxAttempts      int
+	BaseBackoff      time.Duration
+	MaxBackoff       time.Duration
+	MaxSubscriptions int
+	MaxDeadLetters   int
+
+	client        *http.Client
+	queue         chan *Delivery
+	subscriptions map[string]Subscription
+	deadLetters   map[string]*Delivery
+	mu            sync.Mutex
+}
+
+func NewDispatcher(client *http.Client, queueSize int) *Dispatcher {
+	return &Dispatcher{
+		MaxAttempts:      5,
+		BaseBackoff:      time.Second,
+		MaxBackoff:       5 * time.Minute,
+		MaxSubscriptions: 10,
+		MaxDeadLetters:   1000,
+		client:           client,
+		queue:            make(chan *Delivery, queueSize),
+		subscriptions:    make(map[string]Subscription),
+		deadLetters:      make(map[string]*Delivery),
+	}
+}
+
+// Subscribe adds a subscription for the tenant, failing with
+// ErrTooManySubscriptions once it holds MaxSubscriptions.
+func (d *Dispatcher) Subscribe(tenantID, url, secret string) (Subscription, error) {
+	if secret == "" {
+		buf := make([]byte, 32)
+		rand.Read(buf)
+		secret = hex.EncodeToString(buf)
+	}
+
+	sub := Subscription{
+		ID:        uuid.New().String(),
+		Tenant:    tenantID,
+		URL:       url,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.MaxSubscriptions > 0 {
+		count := 0
+		for _, existing := range d.subscriptions {
+			if existing.Tenant == tenantID {
+				count++
+			}
+		}
+		if count >= d.MaxSubscriptions {
+			return Subscription{}, ErrTooManySubscriptions
+		}
+	}
+	d.subscriptions[sub.ID] = sub
+	return sub, nil
+}
+
+func (d *Dispatcher) Unsubscribe(tenantID, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sub, ok := d.subscriptions[id]
+	if !ok || sub.Tenant != tenantID {
+		return ErrSubscriptionNotFound
+	}
+	delete(d.subscriptions, id)
+	return nil
+}
+
+// Subscriptions lists a tenant's subscriptions without their secrets.
+func (d *Dispatcher) Subscriptions(tenantID string) []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	subs := []Subscription{}
+	for _, sub := range d.subscriptions {
+		if sub.Tenant == tenantID {
+			sub.Secret = ""
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs
+}
+
+// Publish queues a delivery of the event to each of its tenant's
+// subscriptions. It never blocks; if the queue is full the delivery goes
+// straight to the dead-letter list.
+func (d *Dispatcher) Publish(event Event) {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	d.mu.Lock()
+	var deliveries []*Delivery
+	for _, sub := range d.subscriptions {
+		if sub.Tenant == event.Tenant {
+			deliveries = append(deliveries, &Delivery{ID: uuid.New().String(), Subscription: sub, Event: event})
+		}
+	}
+	d.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		d.enqueue(delivery)
+	}
+}
+
+func (d *Dispatcher) enqueue(delivery *Delivery) {
+	select {
+	case d.queue <- delivery:
+	default:
+		delivery.LastError = "delivery queue full"
+		d.deadLetter(delivery)
+	}
+}
+
+func (d *Dispatcher) deadLetter(delivery *Delivery) {
+	delivery.FailedAt = time.Now().UTC()
+	slog.Warn("webhook delivery dead-lettered",
+		"delivery_id", delivery.ID, "url", delivery.Subscription.URL,
+		"attempts", delivery.Attempts, "error", delivery.LastError)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deadLetters[delivery.ID] = delivery
+	if d.MaxDeadLetters <= 0 {
+		return
+	}
+
+	// Make room by dropping the tenant's oldest dead letters.
+	var tenants []*Delivery
+	for _, dead := range d.deadLetters {
+		if dead.Subscription.Tenant == delivery.Subscription.Tenant {
+			tenants = append(tenants, dead)
+		}
+	}
+	if len(tenants) <= d.MaxDeadLetters {
+		return
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		if a, b := tenants[i], tenants[j]; !a.FailedAt.Equal(b.FailedAt) {
+			return a.FailedAt.Before(b.FailedAt)
+		}
+		return tenants[j] == delivery
+	})
+	for _, dropped := range tenants[:len(tenants)-d.MaxDeadLetters] {
+		delete(d.deadLetters, dropped.ID)
+	}
+}
+
+func (d *Dispatcher) DeadLetters(tenantID string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deliveries := []Delivery{}
+	for _, delivery := range d.deadLetters {
+		if delivery.Subscription.Tenant == tenantID {
+			copied := *delivery
+			copied.Subscription.Secret = ""
+			deliveries = append(deliveries, copied)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].FailedAt.Before(deliveries[j].FailedAt) })
+	return deliveries
+}
+
+// Redeliver moves a dead-lettered delivery back onto the queue with a fresh
+// set of attempts.
+func (d *Dispatcher) Redeliver(tenantID, id string) error {
+	d.mu.Lock()
+	delivery, ok := d.deadLetters[id]
+	if !ok || delivery.Subscription.Tenant != tenantID {
+		d.mu.Unlock()
+		return ErrDeliveryNotFound
+	}
+	delete(d.deadLetters, id)
+	d.mu.Unlock()
+
+	delivery.Attempts = 0
+	delivery.LastError = ""
+	delivery.FailedAt = time.Time{}
+	d.enqueue(delivery)
+	return nil
+}
+
+// Run delivers queued events with the given number of workers until ctx is
+// cancelled.
+func (d *Dispatcher) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery := <-d.queue:
+					d.attempt(ctx, delivery)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	delivery.Attempts++
+	err := d.send(ctx, delivery)
+	if err == nil {
+		slog.Debug("webhook delivered", "delivery_id", delivery.ID, "attempts", delivery.Attempts)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.MaxAttempts {
+		d.deadLetter(delivery)
+		return
+	}
+
+	time.AfterFunc(d.backoff(delivery.Attempts), func() {
+		if ctx.Err() == nil {
+			d.enqueue(delivery)
+		}
+	})
+}
+
+// backoff doubles the delay after every failed attempt, up to MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseBackoff << (attempts - 1)
+	if delay <= 0 || delay > d.MaxBackoff {
+		return d.MaxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery) error {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(delivery.Subscription.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
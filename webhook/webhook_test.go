@@ -0,0 +1,298 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type receiver struct {
+	server   *httptest.Server
+	failures atomic.Int32
+	mu       sync.Mutex
+	events   []Event
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, failures int32) *receiver {
+	rcv := &receiver{}
+	rcv.failures.Store(failures)
+	rcv.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rcv.failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var event Event
+		json.Unmarshal(body, &event)
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.events = append(rcv.events, event)
+		rcv.headers = append(rcv.headers, r.Header.Clone())
+		rcv.bodies = append(rcv.bodies, body)
+	}))
+	t.Cleanup(rcv.server.Close)
+	return rcv
+}
+
+func (rcv *receiver) received() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.events)
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func startDispatcher(t *testing.T) *Dispatcher {
+	d := NewDispatcher(http.DefaultClient, 16)
+	d.BaseBackoff = time.Millisecond
+	d.MaxBackoff = 5 * time.Millisecond
+	d.MaxAttempts = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, 2)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return d
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"receiptId":"abc"}`)
+	signature := Sign("secret", "1700000000", body)
+
+	if !Verify("secret", "1700000000", body, signature) {
+		t.Error("expected signature to verify")
+	}
+	if Verify("other", "1700000000", body, signature) {
+		t.Error("expected signature with a different secret to fail")
+	}
+	if Verify("secret", "1700000001", body, signature) {
+		t.Error("expected signature with a different timestamp to fail")
+	}
+}
+
+func TestDispatcherDeliversSignedEvent(t *testing.T) {
+	rcv := newReceiver(t, 0)
+	d := startDispatcher(t)
+	sub, _ := d.Subscribe("acme", rcv.server.URL, "top-secret")
+	d.Subscribe("globex", rcv.server.URL, "")
+
+	d.Publish(Event{Type: EventReceiptProcessed, Tenant: "acme", ReceiptID: "r-1", Points: 28})
+	waitFor(t, func() bool { return rcv.received() == 1 })
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	event, header, body := rcv.events[0], rcv.headers[0], rcv.bodies[0]
+	if event.ReceiptID != "r-1" || event.Points != 28 || event.ID == "" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if !Verify(sub.Secret, header.Get(TimestampHeader), body, header.Get(SignatureHeader)) {
+		t.Error("expected a valid signature")
+	}
+	if header.Get(DeliveryHeader) == "" {
+		t.Error("expected a delivery ID header")
+	}
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	rcv := newReceiver(t, 2)
+	d := startDispatcher(t)
+	d.Subscribe("acme", rcv.server.URL, "secret")
+
+	d.Publish(Event{Type: EventReceiptProcessed, Tenant: "acme", ReceiptID: "r-1"})
+	waitFor(t, func() bool { return rcv.received() == 1 })
+
+	if dead := d.DeadLetters("acme"); len(dead) != 0 {
+		t.Errorf("expected no dead letters, got %d", len(dead))
+	}
+}
+
+func TestDispatcherDeadLetterAndRedeliver(t *testing.T) {
+	rcv := newReceiver(t, 3)
+	d := startDispatcher(t)
+	d.Subscribe("acme", rcv.server.URL, "secret")
+
+	d.Publish(Event{Type: EventReceiptProcessed, Tenant: "acme", ReceiptID: "r-1"})
+	waitFor(t, func() bool { return len(d.DeadLetters("acme")) == 1 })
+
+	dead := d.DeadLetters("acme")[0]
+	if dead.Attempts != 3 || dead.LastError == "" || dead.Subscription.Secret != "" {
+		t.Errorf("unexpected dead letter: %+v", dead)
+	}
+
+	if err := d.Redeliver("globex", dead.ID); err != ErrDeliveryNotFound {
+		t.Errorf("expected another tenant's redelivery to fail, got %v", err)
+	}
+	if err := d.Redeliver("acme", dead.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitFor(t, func() bool { return rcv.received() == 1 })
+	if got := len(d.DeadLetters("acme")); got != 0 {
+		t.Errorf("expected dead letter to be removed, got %d", got)
+	}
+}
+
+func TestDispatcherSubscriptions(t *testing.T) {
+	d := NewDispatcher(http.DefaultClient, 1)
+	sub, _ := d.Subscribe("acme", "http://example.com/hook", "")
+	if sub.Secret == "" {
+		t.Error("expected a generated secret")
+	}
+
+	subs := d.Subscriptions("acme")
+	if len(subs) != 1 || subs[0].Secret != "" {
+		t.Errorf("expected one subscription without its secret, got %+v", subs)
+	}
+	if len(d.Subscriptions("globex")) != 0 {
+		t.Error("expected subscriptions to be scoped per tenant")
+	}
+
+	if err := d.Unsubscribe("globex", sub.ID); err != ErrSubscriptionNotFound {
+		t.Errorf("expected %v, got %v", ErrSubscriptionNotFound, err)
+	}
+	if err := d.Unsubscribe("acme", sub.ID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	d := NewDispatcher(http.DefaultClient, 1)
+	d.Subscribe("acme", "http://example.com/hook", "")
+
+	d.Publish(Event{Tenant: "acme", ReceiptID: "r-1"})
+	d.Publish(Event{Tenant: "acme", ReceiptID: "r-2"})
+
+	dead := d.DeadLetters("acme")
+	if len(dead) != 1 || dead[0].Event.ReceiptID != "r-2" {
+		t.Errorf("expected the overflowing delivery to be dead-lettered, got %+v", dead)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(http.DefaultClient, 1)
+	d.BaseBackoff = time.Second
+	d.MaxBackoff = 10 * time.Second
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		if got := d.backoff(i + 1); got != want {
+			t.Errorf("attempt %d: expected %v, got %v", i+1, want, got)
+		}
+	}
+}
+
+func TestPublic(t *testing.T) {
+	testCases := map[string]bool{
+		"93.184.216.34":        true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.100.100.200":      false,
+		"0.0.0.0":              false,
+		"fd00:ec2::254":        false,
+		"fe80::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+		"::ffff:93.184.216.34": true,
+	}
+	for addr, public := range testCases {
+		if got := Public(netip.MustParseAddr(addr)); got != public {
+			t.Errorf("%s: expected public %v, got %v", addr, public, got)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	testCases := map[string]error{
+		"https://crm.example.com/hook":   nil,
+		"http://93.184.216.34:8080/hook": nil,
+		"ftp://example.com/hook":         ErrInvalidURL,
+		"/hook":                          ErrInvalidURL,
+		"http://localhost/hook":          ErrForbiddenDestination,
+		"http://api.LOCALHOST./hook":     ErrForbiddenDestination,
+		"http://127.0.0.1:9090/hook":     ErrForbiddenDestination,
+		"http://[::1]/hook":              ErrForbiddenDestination,
+		"http://169.254.169.254/latest":  ErrForbiddenDestination,
+		"https://192.168.0.10/hook":      ErrForbiddenDestination,
+	}
+	for raw, expected := range testCases {
+		if err := CheckURL(raw); !errors.Is(err, expected) {
+			t.Errorf("%s: expected %v, got %v", raw, expected, err)
+		}
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	rcv := newReceiver(t, 0)
+	resp, err := NewClient(time.Second).Post(rcv.server.URL, "application/json", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrForbiddenDestination) {
+		t.Errorf("expected a loopback delivery to be refused, got %v", err)
+	}
+	if rcv.received() != 0 {
+		t.Error("expected nothing to reach the receiver")
+	}
+}
+
+func TestDispatcherLimits(t *testing.T) {
+	d := NewDispatcher(http.DefaultClient, 0)
+	d.MaxSubscriptions = 2
+	d.MaxDeadLetters = 2
+
+	for range 2 {
+		if _, err := d.Subscribe("acme", "http://example.com/hook", ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := d.Subscribe("acme", "http://example.com/hook", ""); !errors.Is(err, ErrTooManySubscriptions) {
+		t.Errorf("expected %v, got %v", ErrTooManySubscriptions, err)
+	}
+	if _, err := d.Subscribe("globex", "http://example.com/hook", ""); err != nil {
+		t.Errorf("expected the limit to be per tenant, got %v", err)
+	}
+
+	// With no queue every delivery is dead-lettered straight away.
+	d.Publish(Event{Tenant: "acme", ReceiptID: "r-1"})
+	d.Publish(Event{Tenant: "acme", ReceiptID: "r-2"})
+	d.Publish(Event{Tenant: "globex", ReceiptID: "r-3"})
+	dead := d.DeadLetters("acme")
+	if len(dead) != 2 || dead[0].Event.ReceiptID != "r-2" || dead[1].Event.ReceiptID != "r-2" {
+		t.Errorf("expected only the newest dead letters to be kept, got %+v", dead)
+	}
+	if len(d.DeadLetters("globex")) != 1 {
+		t.Error("expected dead letters to be bounded per tenant")
+	}
+}